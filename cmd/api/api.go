@@ -1,24 +1,43 @@
 package api
 
 import (
-	"database/sql"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/apikey"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
 	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/service/cache"
 	"github.com/sebastian-nunez/golang-store-api/service/cart"
+	"github.com/sebastian-nunez/golang-store-api/service/lockout"
+	"github.com/sebastian-nunez/golang-store-api/service/mail"
+	"github.com/sebastian-nunez/golang-store-api/service/metrics"
+	"github.com/sebastian-nunez/golang-store-api/service/middleware"
 	"github.com/sebastian-nunez/golang-store-api/service/order"
+	"github.com/sebastian-nunez/golang-store-api/service/password"
+	"github.com/sebastian-nunez/golang-store-api/service/privacy"
 	"github.com/sebastian-nunez/golang-store-api/service/product"
+	"github.com/sebastian-nunez/golang-store-api/service/ratelimit"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/service/totp"
 	"github.com/sebastian-nunez/golang-store-api/service/user"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
 )
 
 type Server struct {
 	addr string
-	db   *sql.DB
+	db   *db.DB
 }
 
-func NewServer(addr string, db *sql.DB) *Server {
+func NewServer(addr string, db *db.DB) *Server {
 	return &Server{
 		addr: addr,
 		db:   db,
@@ -26,29 +45,244 @@ func NewServer(addr string, db *sql.DB) *Server {
 }
 
 func (s *Server) Run() error {
+	handler, err := s.Handler()
+	if err != nil {
+		return err
+	}
+
+	log.Println("Server: listening on port", s.addr)
+	return http.ListenAndServe(s.addr, handler)
+}
+
+// Handler returns the API with its middlewares, as served by `Run`.
+func (s *Server) Handler() (http.Handler, error) {
+	router, err := s.newRouter()
+	if err != nil {
+		return nil, err
+	}
+	return newMiddlewareChain(router), nil
+}
+
+func (s *Server) newRouter() (*mux.Router, error) {
 	router := mux.NewRouter()
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
+	subrouter.Use(newBodyLimiter().Middleware)
+
+	if config.Envs.RateLimitEnabled {
+		subrouter.Use(newRateLimiter().Middleware)
+	}
+
+	auditStore := audit.NewStore(s.db)
+	apiKeyStore := apikey.NewStore(s.db)
+	subrouter.Use(auth.WithAPIKeys(apiKeyStore))
+	subrouter.Use(mux.MiddlewareFunc(newReadYourWrites()))
+	subrouter.Use(auth.AuditImpersonation(auditStore))
+
+	mailer, err := newMailer()
+	if err != nil {
+		return nil, err
+	}
+
+	passwordPolicy, err := newPasswordPolicy()
+	if err != nil {
+		return nil, err
+	}
 
 	// Users
 	userStore := user.NewStore(s.db)
+	orderStore := order.NewStore(s.db)
+	loginGuard := lockout.NewGuard(lockout.NewStore(s.db), auditStore, lockout.Policy{
+		MaxAccountFailures: int(config.Envs.LoginMaxAccountFailures),
+		MaxIPFailures:      int(config.Envs.LoginMaxIPFailures),
+		Window:             time.Duration(config.Envs.LoginFailureWindowInSeconds) * time.Second,
+		LockoutDuration:    time.Duration(config.Envs.LoginLockoutInSeconds) * time.Second,
+		BaseDelay:          time.Duration(config.Envs.LoginBaseDelayInMilliseconds) * time.Millisecond,
+		MaxDelay:           time.Duration(config.Envs.LoginMaxDelayInMilliseconds) * time.Millisecond,
+	})
+	passwordHasher := auth.NewHasher(auth.Argon2Params{
+		Memory:      uint32(config.Envs.PasswordArgon2MemoryInKiB),
+		Iterations:  uint32(config.Envs.PasswordArgon2Iterations),
+		Parallelism: uint8(config.Envs.PasswordArgon2Parallelism),
+	})
 	userHandler := user.NewHandler(
 		userStore,
-		auth.HashPassword,
-		auth.ComparePasswords,
+		passwordHasher,
+		passwordPolicy,
 		auth.CreateJWTToken,
+		loginGuard,
+		token.NewStore(s.db),
+		mailer,
+		totp.NewStore(s.db),
+		orderStore,
+		auditStore,
 	)
 	userHandler.RegisterRoutes(subrouter)
 
-	// Products
-	productStore := product.NewStore(s.db)
-	productHandler := product.NewHandler(productStore, userStore)
+	// Products, with the catalog read from the replicas unless the request must see the latest
+	// writes. The cache is filled from the primary for as long as the replicas may lag after a
+	// write, so it isn't filled again with the rows from before it.
+	var productStore types.ProductStore = product.NewStore(s.db)
+	primaryProductStore := product.NewStore(s.db.Primary())
+	if config.Envs.ProductCacheEnabled {
+		replicationLag := time.Duration(config.Envs.DBReadYourWritesInSeconds) * time.Second
+		productStore = product.NewCachedStore(productStore, primaryProductStore, replicationLag, cache.NewLRU(
+			int(config.Envs.ProductCacheMaxEntries),
+			time.Duration(config.Envs.ProductCacheTTLInSeconds)*time.Second,
+		))
+	}
+	productHandler := product.NewHandler(productStore, primaryProductStore, userStore)
 	productHandler.RegisterRoutes(subrouter)
 
 	// Cart/Orders
-	orderStore := order.NewStore(s.db)
-	cartHandler := cart.NewHandler(productStore, orderStore, userStore)
+	cartHandler := cart.NewHandler(
+		productStore,
+		orderStore,
+		userStore,
+		config.Envs.RequireVerifiedEmailForCheckout,
+	)
 	cartHandler.RegisterRoutes(subrouter)
 
-	log.Println("Server: listening on port", s.addr)
-	return http.ListenAndServe(s.addr, router)
+	// Data subject requests
+	privacyHandler := privacy.NewHandler(userStore, orderStore, auditStore, passwordHasher)
+	privacyHandler.RegisterRoutes(subrouter)
+
+	// Audit log
+	auditHandler := audit.NewHandler(auditStore, userStore)
+	auditHandler.RegisterRoutes(subrouter)
+
+	// API keys
+	apiKeyHandler := apikey.NewHandler(apiKeyStore, userStore, auditStore)
+	apiKeyHandler.RegisterRoutes(subrouter)
+
+	// Metrics
+	metricsHandler := metrics.NewHandler(userStore)
+	metricsHandler.RegisterRoutes(subrouter)
+
+	return router, nil
+}
+
+// newMiddlewareChain wraps the router with the middlewares which must run even when no route
+// matches, e.g. to answer CORS preflights and tag 404s with a request ID.
+func newMiddlewareChain(router http.Handler) http.Handler {
+	return middleware.Chain(
+		router,
+		utils.RequestID,
+		middleware.Recover,
+		middleware.SecurityHeaders(int(config.Envs.HSTSMaxAgeInSeconds)),
+		middleware.CORS(middleware.CORSPolicy{
+			AllowedOrigins:   config.Envs.CORSAllowedOrigins,
+			AllowedMethods:   config.Envs.CORSAllowedMethods,
+			AllowedHeaders:   config.Envs.CORSAllowedHeaders,
+			ExposedHeaders:   []string{utils.RequestIDHeader, "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+			AllowCredentials: config.Envs.CORSAllowCredentials,
+			MaxAge:           int(config.Envs.CORSMaxAgeInSeconds),
+		}),
+		middleware.Compress,
+		middleware.RequireJSON,
+	)
+}
+
+// authRoutes take credentials, they get stricter rate and body limits than the rest of the API.
+var authRoutes = []string{
+	"/api/v1/login",
+	"/api/v1/login/2fa",
+	"/api/v1/register",
+	"/api/v1/auth/verify-email",
+	"/api/v1/auth/resend-verification",
+	"/api/v1/auth/forgot-password",
+	"/api/v1/auth/reset-password",
+	"/api/v1/users/me/password",
+	"/api/v1/users/me/email",
+}
+
+// authBodyBytes fits any credentials payload with plenty of room.
+const authBodyBytes = 16 << 10
+
+// newBodyLimiter limits request bodies to `MAX_BODY_BYTES`, and much less on the auth routes
+// which are reachable without an account.
+func newBodyLimiter() *middleware.BodyLimiter {
+	limiter := middleware.NewBodyLimiter(config.Envs.MaxBodyBytes)
+	limiter.Route(authBodyBytes, authRoutes...)
+	return limiter
+}
+
+func newMailer() (mail.Mailer, error) {
+	switch config.Envs.MailDriver {
+	case "smtp":
+		addr := net.JoinHostPort(config.Envs.SMTPHost, config.Envs.SMTPPort)
+		return mail.NewSMTPMailer(addr, config.Envs.SMTPUsername, config.Envs.SMTPPassword, config.Envs.MailFrom), nil
+	case "log":
+		if config.Envs.MailLogFile == "" {
+			return mail.NewWriterMailer(os.Stdout, config.Envs.MailFrom), nil
+		}
+
+		f, err := os.OpenFile(config.Envs.MailLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open mail log file: %v", err)
+		}
+		return mail.NewWriterMailer(f, config.Envs.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", config.Envs.MailDriver)
+	}
+}
+
+func newPasswordPolicy() (password.Policy, error) {
+	policy := password.Policy{MinLength: int(config.Envs.PasswordMinLength)}
+	if config.Envs.PasswordBreachedListFile == "" {
+		policy.Breached = password.BundledBreachedList()
+		return policy, nil
+	}
+
+	breached, err := password.LoadBreachedList(config.Envs.PasswordBreachedListFile)
+	if err != nil {
+		return policy, fmt.Errorf("unable to load breached password list: %v", err)
+	}
+	policy.Breached = breached
+	return policy, nil
+}
+
+// newReadYourWrites sends the reads of a user to the primary for `DB_READ_YOUR_WRITES_IN_SECONDS`
+// after they wrote. Users are identified by their JWT or API key, so it must run after
+// `auth.WithAPIKeys`.
+func newReadYourWrites() middleware.Middleware {
+	return middleware.ReadYourWrites(
+		db.NewRecentWrites(time.Duration(config.Envs.DBReadYourWritesInSeconds)*time.Second),
+		func(r *http.Request) string {
+			if key, ok := auth.GetAPIKeyFromContext(r.Context()); ok {
+				return fmt.Sprintf("user:%d", key.UserID)
+			}
+			if userID, ok := auth.UserIDFromRequest(r); ok {
+				return fmt.Sprintf("user:%d", userID)
+			}
+			return ""
+		},
+	)
+}
+
+// newRateLimiter limits authenticated clients by user ID and everyone else by IP address. The
+// auth routes get a stricter limit to slow down credential stuffing and signup spam.
+func newRateLimiter() *ratelimit.Limiter {
+	limiter := ratelimit.NewLimiter(
+		ratelimit.NewMemoryStore(),
+		func(r *http.Request) string {
+			if userID, ok := auth.UserIDFromRequest(r); ok {
+				return fmt.Sprintf("user:%d", userID)
+			}
+			return "ip:" + utils.ClientIP(r)
+		},
+		ratelimit.Policy{
+			Name:  "api",
+			Limit: ratelimit.PerMinute(int(config.Envs.RateLimitAPIPerMinute), int(config.Envs.RateLimitAPIBurst)),
+		},
+	)
+
+	limiter.Route(
+		ratelimit.Policy{
+			Name:  "auth",
+			Limit: ratelimit.PerMinute(int(config.Envs.RateLimitAuthPerMinute), int(config.Envs.RateLimitAuthBurst)),
+		},
+		authRoutes...,
+	)
+
+	return limiter
 }
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/service/middleware"
+)
+
+// TestRoutesDoNotPanic drives malformed tokens, path params and payloads through every route of
+// the real router. The database fails every query, so handlers past their input checks error out.
+func TestRoutesDoNotPanic(t *testing.T) {
+	config.Envs.RateLimitEnabled = false
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	sqlDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	router, err := NewServer(":0", db.New(sqlDB, db.MySQL)).newRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newMiddlewareChain(router)
+
+	type route struct {
+		method string
+		path   string
+	}
+	var routes []route
+	err = router.Walk(func(r *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := r.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := r.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			routes = append(routes, route{method: method, path: tpl})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) == 0 {
+		t.Fatal("expected the router to have routes")
+	}
+
+	pathParams := []string{"1", "abc", "-1", "99999999999999999999999", "%00"}
+	headers := map[string]http.Header{
+		"no token":             {},
+		"empty bearer":         {"Authorization": {"Bearer"}},
+		"garbage bearer":       {"Authorization": {"Bearer not.a.jwt"}},
+		"numeric userId":       {"Authorization": {"Bearer " + signToken(t, jwt.MapClaims{"userId": 1})}},
+		"missing userId":       {"Authorization": {"Bearer " + signToken(t, jwt.MapClaims{})}},
+		"malformed act":        {"Authorization": {"Bearer " + signToken(t, jwt.MapClaims{"userId": "1", "act": "2"})}},
+		"numeric act sub":      {"Authorization": {"Bearer " + signToken(t, jwt.MapClaims{"userId": "1", "act": map[string]any{"sub": 2}})}},
+		"valid token":          {"Authorization": {"Bearer " + signToken(t, jwt.MapClaims{"userId": "1"})}},
+		"garbage api key":      {"Authorization": {auth.APIKeyScheme + "sk_garbage"}},
+		"cookie without csrf":  {"Cookie": {auth.SessionCookieName + "=" + signToken(t, jwt.MapClaims{"userId": "1"})}},
+		"unsigned token":       {"Authorization": {"Bearer " + unsignedToken(t)}},
+		"oversized request id": {"X-Request-ID": {strings.Repeat("a", 1000)}},
+	}
+	payloads := []string{
+		"",
+		"null",
+		"{",
+		"[]",
+		`"text"`,
+		"0",
+		`{"unknown":true}`,
+		`{"items":null}`,
+		`{"items":[]}`,
+		`{"items":[{"productId":-1,"quantity":99999999999999999999}]}`,
+		`{"email":123,"password":["a"]}`,
+		`{"scopes":[null],"expiresAt":"yesterday"}`,
+		`{"page":-1} {}`,
+		strings.Repeat("[", 10000),
+	}
+
+	before := middleware.PanicsRecovered.Value()
+	for _, rt := range routes {
+		for _, param := range pathParams {
+			path := substitutePathParams(rt.path, param)
+			for name, header := range headers {
+				for _, payload := range payloads {
+					req := httptest.NewRequest(rt.method, path, strings.NewReader(payload))
+					req.Header = header.Clone()
+					req.Header.Set("Content-Type", "application/json")
+					rr := httptest.NewRecorder()
+
+					handler.ServeHTTP(rr, req)
+
+					if got := middleware.PanicsRecovered.Value(); got != before {
+						t.Fatalf("%s %s with %s and payload %.40q panicked", rt.method, path, name, payload)
+					}
+					if rr.Code < 200 || rr.Code > 599 {
+						t.Fatalf("%s %s with %s and payload %.40q returned status code %d", rt.method, path, name, payload, rr.Code)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRecoverThroughTheMiddlewareChain(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var claims map[string]any
+		_ = claims["userId"].(string)
+	})
+
+	before := middleware.PanicsRecovered.Value()
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	rr := httptest.NewRecorder()
+	newMiddlewareChain(router).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d and got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Errorf("expected the response to carry the request ID")
+	}
+	if got := middleware.PanicsRecovered.Value(); got != before+1 {
+		t.Errorf("expected the panic to be counted, got %d after %d", got, before)
+	}
+}
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Envs.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func unsignedToken(t *testing.T) string {
+	t.Helper()
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"userId": "1"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+// substitutePathParams replaces every `{param}` of the path template with the value.
+func substitutePathParams(tpl string, value string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(tpl, "{")
+		end := strings.Index(tpl, "}")
+		if start < 0 || end < start {
+			b.WriteString(tpl)
+			return b.String()
+		}
+		b.WriteString(tpl[:start])
+		b.WriteString(value)
+		tpl = tpl[end+1:]
+	}
+}
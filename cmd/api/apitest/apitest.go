@@ -0,0 +1,261 @@
+// Package apitest serves the whole API, middlewares included, against a throwaway SQLite
+// database migrated from the migrations, so scenarios can be tested end to end without any
+// external service.
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sebastian-nunez/golang-store-api/cmd/api"
+	"github.com/sebastian-nunez/golang-store-api/cmd/migrate/migrations"
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/product"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// Password is the password of the users registered by `Harness.NewCustomer`.
+const Password = "correct-horse-battery-staple"
+
+// Harness is a running API. Tests using it must not run in parallel with each other, as it
+// changes `config.Envs` for the duration of the test.
+type Harness struct {
+	Server *httptest.Server
+	// DB is the database of the API, to seed or inspect it directly.
+	DB *db.DB
+	// Replica is the read replica of `NewWithLaggingReplica`, nil otherwise.
+	Replica *db.DB
+	users   atomic.Int64
+}
+
+// New starts the API on a new database. Everything is torn down at the end of the test.
+func New(t *testing.T) *Harness {
+	t.Helper()
+	return start(t, false)
+}
+
+// NewWithLaggingReplica starts the API on a new database with a read replica of its own, which
+// gets the products seeded but none of the writes of the API, as if it lagged behind them all.
+func NewWithLaggingReplica(t *testing.T) *Harness {
+	t.Helper()
+	return start(t, true)
+}
+
+func start(t *testing.T, withReplica bool) *Harness {
+	t.Helper()
+	dir := t.TempDir()
+
+	previous := config.Envs
+	t.Cleanup(func() { config.Envs = previous })
+	config.Envs.RateLimitEnabled = false
+	config.Envs.MailDriver = "log"
+	config.Envs.MailLogFile = filepath.Join(dir, "mail.log")
+	// Hashing with the production cost would make every login take a noticeable time.
+	config.Envs.PasswordArgon2MemoryInKiB = 1024
+	config.Envs.PasswordArgon2Iterations = 1
+	config.Envs.PasswordArgon2Parallelism = 1
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	h := &Harness{}
+	var replicaDSNs []string
+	if withReplica {
+		replicaDSN := "file:" + filepath.Join(dir, "replica.db")
+		h.Replica = open(t, replicaDSN)
+		replicaDSNs = append(replicaDSNs, replicaDSN)
+	}
+	h.DB = open(t, "file:"+filepath.Join(dir, "store.db"), replicaDSNs...)
+
+	handler, err := api.NewServer(":0", h.DB).Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Server = httptest.NewServer(handler)
+	t.Cleanup(h.Server.Close)
+
+	return h
+}
+
+// open opens the database and migrates it, but not its replicas.
+func open(t *testing.T, dsn string, replicaDSNs ...string) *db.DB {
+	t.Helper()
+	database, err := db.Open("sqlite", dsn, replicaDSNs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	m, err := migrations.New(database.SQL(), "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return database
+}
+
+// SeedProduct adds a product straight to the database, and to the replica if any, and returns
+// its ID. The API caches products, so seed them before reading them through it.
+func (h *Harness) SeedProduct(t *testing.T, name string, price float64, quantity int) int {
+	t.Helper()
+	databases := []*db.DB{h.DB}
+	if h.Replica != nil {
+		databases = append(databases, h.Replica)
+	}
+
+	var id int
+	for _, database := range databases {
+		seeded, err := product.NewStore(database).CreateProduct(
+			types.CreateProductRequest{Name: name, Price: price, Quantity: quantity},
+			types.AuditEvent{Action: product.ActionCreated},
+		)
+		if err != nil {
+			t.Fatalf("unable to seed product %s: %v", name, err)
+		}
+		if id != 0 && seeded != id {
+			t.Fatalf("expected product %s to have the same ID on the replica, but got %d and %d", name, id, seeded)
+		}
+		id = seeded
+	}
+	return id
+}
+
+// Client returns a client without credentials.
+func (h *Harness) Client() *Client {
+	return &Client{baseURL: h.Server.URL + "/api/v1", http: h.Server.Client()}
+}
+
+// NewCustomer registers a customer with a unique email and returns a client logged in as them.
+func (h *Harness) NewCustomer(t *testing.T) *Client {
+	t.Helper()
+	email := fmt.Sprintf("customer-%d@example.com", h.users.Add(1))
+
+	client := h.Client()
+	if res := client.Register(t, email, Password); res.Status != http.StatusCreated {
+		t.Fatalf("unable to register %s: %d %s", email, res.Status, res.Body)
+	}
+	if res := client.Login(t, email, Password); res.Status != http.StatusOK {
+		t.Fatalf("unable to log in as %s: %d %s", email, res.Status, res.Body)
+	}
+
+	return client
+}
+
+// Client calls the API, with the token of its last successful login if any.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+}
+
+// Response is a response read in full.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// JSON decodes the body into v, failing the test if it can't.
+func (r *Response) JSON(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("unable to decode %s: %v", r.Body, err)
+	}
+}
+
+// Do sends the payload, if any, as JSON. It may be called from other goroutines than the test's.
+func (c *Client) Do(t *testing.T, method string, path string, payload any) *Response {
+	t.Helper()
+
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			t.Errorf("unable to encode %v: %v", payload, err)
+			return &Response{}
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		t.Errorf("unable to create request: %v", err)
+		return &Response{}
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		t.Errorf("%s %s failed: %v", method, path, err)
+		return &Response{}
+	}
+	defer res.Body.Close()
+
+	read, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("unable to read the response of %s %s: %v", method, path, err)
+	}
+
+	return &Response{Status: res.StatusCode, Header: res.Header, Body: read}
+}
+
+func (c *Client) Register(t *testing.T, email string, password string) *Response {
+	t.Helper()
+	return c.Do(t, http.MethodPost, "/register", types.RegisterUserRequest{
+		FirstName: "Test",
+		LastName:  "Customer",
+		Email:     email,
+		Password:  password,
+	})
+}
+
+// Login keeps the token of a successful login for the next requests.
+func (c *Client) Login(t *testing.T, email string, password string) *Response {
+	t.Helper()
+	res := c.Do(t, http.MethodPost, "/login", types.LoginUserRequest{Email: email, Password: password})
+	if res.Status == http.StatusOK {
+		var session struct {
+			Token string `json:"token"`
+		}
+		res.JSON(t, &session)
+		c.token = session.Token
+	}
+	return res
+}
+
+func (c *Client) Checkout(t *testing.T, items ...types.CartCheckoutItem) *Response {
+	t.Helper()
+	return c.Do(t, http.MethodPost, "/cart/checkout", types.CartCheckoutRequest{Items: items})
+}
+
+// Product returns the product as served by the API.
+func (c *Client) Product(t *testing.T, id int) types.Product {
+	t.Helper()
+	res := c.Do(t, http.MethodGet, fmt.Sprintf("/products/%d", id), nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("unable to get product %d: %d %s", id, res.Status, res.Body)
+	}
+
+	var product types.Product
+	res.JSON(t, &product)
+	return product
+}
@@ -0,0 +1,191 @@
+package apitest
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/order"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestCheckout(t *testing.T) {
+	h := New(t)
+	productID := h.SeedProduct(t, "Jordans", 109.99, 5)
+	customer := h.NewCustomer(t)
+
+	res := customer.Checkout(t, types.CartCheckoutItem{ProductID: productID, Quantity: 2})
+	if res.Status != http.StatusOK {
+		t.Fatalf("expected status code %d and got %d: %s", http.StatusOK, res.Status, res.Body)
+	}
+
+	var checkout struct {
+		OrderID    int     `json:"orderId"`
+		TotalPrice float64 `json:"totalPrice"`
+	}
+	res.JSON(t, &checkout)
+	if checkout.OrderID == 0 || checkout.TotalPrice != 219.98 {
+		t.Errorf("expected an order of 219.98, but got %+v", checkout)
+	}
+
+	if product := customer.Product(t, productID); product.Quantity != 3 {
+		t.Errorf("expected 3 units left, but got %d", product.Quantity)
+	}
+}
+
+// TestCatalogAfterACheckoutWithALaggingReplica checks that the product cache, invalidated by a
+// checkout, isn't filled again with the stock from before it by a replica which lags behind.
+func TestCatalogAfterACheckoutWithALaggingReplica(t *testing.T) {
+	h := NewWithLaggingReplica(t)
+	productID := h.SeedProduct(t, "Jordans", 109.99, 5)
+	customer := h.NewCustomer(t)
+	visitor := h.Client()
+
+	if product := visitor.Product(t, productID); product.Quantity != 5 {
+		t.Fatalf("expected 5 units, but got %d", product.Quantity)
+	}
+	if res := customer.Checkout(t, types.CartCheckoutItem{ProductID: productID, Quantity: 2}); res.Status != http.StatusOK {
+		t.Fatalf("expected status code %d and got %d: %s", http.StatusOK, res.Status, res.Body)
+	}
+
+	for range 2 {
+		if product := visitor.Product(t, productID); product.Quantity != 3 {
+			t.Errorf("expected 3 units left, but got %d", product.Quantity)
+		}
+	}
+}
+
+// TestCatalogIsReadFromTheReplicaWithTheCache checks that the product cache is filled from the
+// replica, when no write is recent enough for it to lag behind.
+func TestCatalogIsReadFromTheReplicaWithTheCache(t *testing.T) {
+	if !config.Envs.ProductCacheEnabled {
+		t.Fatal("expected the product cache to be enabled by default")
+	}
+	h := NewWithLaggingReplica(t)
+	productID := h.SeedProduct(t, "Jordans", 109.99, 5)
+	if _, err := h.Replica.Exec("UPDATE products SET name = ? WHERE id = ?", "Jordans on the replica", productID); err != nil {
+		t.Fatal(err)
+	}
+
+	visitor := h.Client()
+	for range 2 {
+		if product := visitor.Product(t, productID); product.Name != "Jordans on the replica" {
+			t.Errorf("expected the product read from the replica, but got %q", product.Name)
+		}
+	}
+}
+
+func TestCheckoutRequiresLogin(t *testing.T) {
+	h := New(t)
+	productID := h.SeedProduct(t, "Jordans", 109.99, 5)
+
+	res := h.Client().Checkout(t, types.CartCheckoutItem{ProductID: productID, Quantity: 1})
+	if res.Status != http.StatusForbidden {
+		t.Errorf("expected status code %d and got %d: %s", http.StatusForbidden, res.Status, res.Body)
+	}
+}
+
+func TestLoginWithWrongPassword(t *testing.T) {
+	h := New(t)
+	client := h.Client()
+	client.Register(t, "ada@example.com", Password)
+
+	if res := client.Login(t, "ada@example.com", "wrong-password"); res.Status != http.StatusBadRequest {
+		t.Errorf("expected status code %d and got %d: %s", http.StatusBadRequest, res.Status, res.Body)
+	}
+}
+
+// TestConcurrentCheckoutsForTheLastUnit races customers for the last unit in stock: exactly one
+// of them gets it and the others are told it's unavailable.
+func TestConcurrentCheckoutsForTheLastUnit(t *testing.T) {
+	h := New(t)
+	productID := h.SeedProduct(t, "Jordans", 109.99, 1)
+
+	customers := make([]*Client, 10)
+	for i := range customers {
+		customers[i] = h.NewCustomer(t)
+	}
+
+	statuses := checkoutConcurrently(t, customers, types.CartCheckoutItem{ProductID: productID, Quantity: 1})
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusBadRequest] != len(customers)-1 {
+		t.Errorf("expected a single checkout to succeed, but got the status codes %v", statuses)
+	}
+
+	if product := customers[0].Product(t, productID); product.Quantity != 0 {
+		t.Errorf("expected no units left, but got %d", product.Quantity)
+	}
+	assertOrders(t, h, 1)
+}
+
+// TestConcurrentCheckoutsAreAllOrNothing races carts which each take the last unit of one product
+// and a unit of another: the losers mustn't take any stock of the other product.
+func TestConcurrentCheckoutsAreAllOrNothing(t *testing.T) {
+	h := New(t)
+	scarce := h.SeedProduct(t, "Jordans", 109.99, 1)
+	plenty := h.SeedProduct(t, "Socks", 4.99, 100)
+
+	customers := make([]*Client, 10)
+	for i := range customers {
+		customers[i] = h.NewCustomer(t)
+	}
+
+	statuses := checkoutConcurrently(t, customers,
+		types.CartCheckoutItem{ProductID: plenty, Quantity: 1},
+		types.CartCheckoutItem{ProductID: scarce, Quantity: 1},
+	)
+	if statuses[http.StatusOK] != 1 {
+		t.Errorf("expected a single checkout to succeed, but got the status codes %v", statuses)
+	}
+
+	if product := customers[0].Product(t, plenty); product.Quantity != 99 {
+		t.Errorf("expected only the successful checkout to take a unit, but %d are left", product.Quantity)
+	}
+	assertOrders(t, h, 1)
+}
+
+// checkoutConcurrently checks out the same cart for every customer at once and counts the
+// responses by status code.
+func checkoutConcurrently(t *testing.T, customers []*Client, items ...types.CartCheckoutItem) map[int]int {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	start := make(chan struct{})
+	statuses := make(map[int]int)
+	for _, customer := range customers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			res := customer.Checkout(t, items...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			statuses[res.Status]++
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	return statuses
+}
+
+// assertOrders checks the number of orders of all the customers registered by the harness.
+func assertOrders(t *testing.T, h *Harness, want int) {
+	t.Helper()
+
+	orders := order.NewStore(h.DB)
+	got := 0
+	for id := 1; id <= int(h.users.Load()); id++ {
+		placed, err := orders.GetOrdersByUserID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got += len(placed)
+	}
+
+	if got != want {
+		t.Errorf("expected %d orders, but got %d", want, got)
+	}
+}
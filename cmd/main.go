@@ -1,28 +1,21 @@
 package main
 
 import (
-	"database/sql"
 	"log"
+	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/sebastian-nunez/golang-store-api/cmd/api"
 	"github.com/sebastian-nunez/golang-store-api/config"
 	"github.com/sebastian-nunez/golang-store-api/db"
 )
 
 func main() {
-	db, err := db.NewMySQLStorage(mysql.Config{
-		User:                 config.Envs.DBUser,
-		Passwd:               config.Envs.DBPassword,
-		Addr:                 config.Envs.DBAddress,
-		DBName:               config.Envs.DBName,
-		Net:                  "tcp",
-		AllowNativePasswords: true,
-		ParseTime:            true,
-	})
+	opts := db.ConfiguredOptions()
+	db, err := db.Open(config.Envs.DBDriver, db.ConfiguredDSN(), config.Envs.DBReplicaDSNs...)
 	if err != nil {
 		log.Fatal("DB: unable to connect to the database. ", err)
 	}
+	db.Configure(opts)
 
 	initStorage(db)
 
@@ -32,11 +25,12 @@ func main() {
 	}
 }
 
-func initStorage(db *sql.DB) {
-	err := db.Ping()
+func initStorage(db *db.DB) {
+	err := db.WaitForConnection(time.Duration(config.Envs.DBConnectTimeoutInSeconds) * time.Second)
 	if err != nil {
 		log.Fatal("DB: unable to ping! ", err)
 	}
+	db.CheckReplicas(time.Duration(config.Envs.DBReplicaHealthCheckInSeconds) * time.Second)
 
-	log.Println("DB: successfully connected!")
+	log.Printf("DB: successfully connected to %s!", db.Dialect().Name())
 }
@@ -3,41 +3,36 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	mysqlDriver "github.com/go-sql-driver/mysql"
 	"github.com/golang-migrate/migrate/v4"
-	mysqlMigrate "github.com/golang-migrate/migrate/v4/database/mysql"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/sebastian-nunez/golang-store-api/cmd/migrate/migrations"
 	"github.com/sebastian-nunez/golang-store-api/config"
 	"github.com/sebastian-nunez/golang-store-api/db"
 )
 
 func main() {
-	cfg := mysqlDriver.Config{
-		User:                 config.Envs.DBUser,
-		Passwd:               config.Envs.DBPassword,
-		Addr:                 config.Envs.DBAddress,
-		DBName:               config.Envs.DBName,
-		Net:                  "tcp",
-		AllowNativePasswords: true,
-		ParseTime:            true,
+	driver := config.Envs.DBDriver
+	dsn := db.ConfiguredDSN()
+	if driver == db.MySQL.Name() {
+		cfg, err := mysqlDriver.ParseDSN(dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.MultiStatements = true
+		dsn = cfg.FormatDSN()
 	}
 
-	db, err := db.NewMySQLStorage(cfg)
+	db, err := db.Open(driver, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	driver, err := mysqlMigrate.WithInstance(db, &mysqlMigrate.Config{})
-	if err != nil {
+	if err := db.WaitForConnection(time.Duration(config.Envs.DBConnectTimeoutInSeconds) * time.Second); err != nil {
 		log.Fatal(err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://cmd/migrate/migrations",
-		"mysql",
-		driver,
-	)
+	m, err := migrations.New(db.SQL(), driver)
 	if err != nil {
 		log.Fatal(err)
 	}
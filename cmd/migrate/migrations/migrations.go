@@ -0,0 +1,45 @@
+// Package migrations embeds a set of schema migrations per database driver.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	mysqlMigrate "github.com/golang-migrate/migrate/v4/database/mysql"
+	postgresMigrate "github.com/golang-migrate/migrate/v4/database/postgres"
+	sqliteMigrate "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// New returns a migrator applying the migrations of the driver to the database. MySQL
+// connections must allow multiple statements per query.
+func New(db *sql.DB, driver string) (*migrate.Migrate, error) {
+	var instance database.Driver
+	var err error
+	switch driver {
+	case "mysql":
+		instance, err = mysqlMigrate.WithInstance(db, &mysqlMigrate.Config{})
+	case "postgres":
+		instance, err = postgresMigrate.WithInstance(db, &postgresMigrate.Config{})
+	case "sqlite":
+		instance, err = sqliteMigrate.WithInstance(db, &sqliteMigrate.Config{})
+	default:
+		return nil, fmt.Errorf("migrations: unsupported driver %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := iofs.New(files, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.NewWithInstance("iofs", source, driver, instance)
+}
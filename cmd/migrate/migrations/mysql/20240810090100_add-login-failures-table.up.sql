@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+    `subject` VARCHAR(255) PRIMARY KEY,
+    `failures` INT UNSIGNED NOT NULL DEFAULT 0,
+    `lastFailureAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `lockedUntil` TIMESTAMP NULL DEFAULT NULL
+);
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `actorId` INT NULL,
+    `action` VARCHAR(255) NOT NULL,
+    `entityType` VARCHAR(255) NOT NULL,
+    `entityId` VARCHAR(255) NOT NULL,
+    `ip` VARCHAR(45) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX (`entityType`, `entityId`)
+);
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_tokens (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `userId` INT NOT NULL,
+    `purpose` ENUM('email_verification') NOT NULL,
+    `tokenHash` CHAR(64) UNIQUE NOT NULL,
+    `expiresAt` TIMESTAMP NOT NULL,
+    `usedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DELETE FROM user_tokens WHERE `purpose` = 'password_reset';
+ALTER TABLE user_tokens MODIFY COLUMN `purpose` ENUM('email_verification') NOT NULL;
\ No newline at end of file
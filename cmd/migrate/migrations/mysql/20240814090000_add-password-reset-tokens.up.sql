@@ -0,0 +1 @@
+ALTER TABLE user_tokens MODIFY COLUMN `purpose` ENUM('email_verification', 'password_reset') NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `sessionsRevokedAt`;
\ No newline at end of file
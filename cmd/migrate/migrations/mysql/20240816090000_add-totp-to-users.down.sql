@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN `totpSecret`,
+    DROP COLUMN `totpEnabledAt`,
+    DROP COLUMN `totpLastUsedStep`;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN `totpSecret` VARCHAR(64) NULL DEFAULT NULL,
+    ADD COLUMN `totpEnabledAt` TIMESTAMP NULL DEFAULT NULL,
+    ADD COLUMN `totpLastUsedStep` BIGINT NULL DEFAULT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `deletedAt`;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `disabledAt`;
\ No newline at end of file
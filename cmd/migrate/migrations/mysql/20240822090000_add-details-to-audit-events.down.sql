@@ -0,0 +1 @@
+ALTER TABLE audit_events DROP COLUMN `details`;
\ No newline at end of file
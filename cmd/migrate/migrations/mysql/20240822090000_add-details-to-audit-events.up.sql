@@ -0,0 +1 @@
+ALTER TABLE audit_events ADD COLUMN `details` VARCHAR(255) NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE audit_events
+    DROP INDEX `createdAt`,
+    DROP INDEX `actorId`,
+    DROP COLUMN `requestId`,
+    DROP COLUMN `after`,
+    DROP COLUMN `before`;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE audit_events
+    ADD COLUMN `before` JSON NULL,
+    ADD COLUMN `after` JSON NULL,
+    ADD COLUMN `requestId` VARCHAR(64) NOT NULL DEFAULT '',
+    ADD INDEX (`actorId`),
+    ADD INDEX (`createdAt`);
\ No newline at end of file
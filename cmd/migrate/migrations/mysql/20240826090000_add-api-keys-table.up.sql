@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `userId` INT NOT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `prefix` VARCHAR(16) NOT NULL,
+    `keyHash` CHAR(64) UNIQUE NOT NULL,
+    `scopes` VARCHAR(255) NOT NULL,
+    `expiresAt` TIMESTAMP NULL DEFAULT NULL,
+    `lastUsedAt` TIMESTAMP NULL DEFAULT NULL,
+    `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE products DROP COLUMN `updatedAt`;
\ No newline at end of file
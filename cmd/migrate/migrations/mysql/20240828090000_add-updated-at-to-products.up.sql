@@ -0,0 +1,3 @@
+ALTER TABLE products ADD COLUMN `updatedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+
+UPDATE products SET `updatedAt` = `createdAt`;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users MODIFY COLUMN `sessionsRevokedAt` TIMESTAMP NULL DEFAULT NULL;
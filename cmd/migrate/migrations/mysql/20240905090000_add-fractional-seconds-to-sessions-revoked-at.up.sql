@@ -0,0 +1,2 @@
+-- Tokens carry `iat` with microseconds, the revocation must too. PostgreSQL and SQLite already keep them.
+ALTER TABLE users MODIFY COLUMN `sessionsRevokedAt` TIMESTAMP(6) NULL DEFAULT NULL;
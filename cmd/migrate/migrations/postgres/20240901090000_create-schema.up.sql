@@ -0,0 +1,102 @@
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    firstName VARCHAR(255) NOT NULL,
+    lastName VARCHAR(255) NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    role VARCHAR(16) NOT NULL DEFAULT 'customer' CHECK (role IN ('customer', 'admin')),
+    emailVerifiedAt TIMESTAMPTZ NULL DEFAULT NULL,
+    sessionsRevokedAt TIMESTAMPTZ NULL DEFAULT NULL,
+    totpSecret VARCHAR(64) NULL DEFAULT NULL,
+    totpEnabledAt TIMESTAMPTZ NULL DEFAULT NULL,
+    totpLastUsedStep BIGINT NULL DEFAULT NULL,
+    deletedAt TIMESTAMPTZ NULL DEFAULT NULL,
+    disabledAt TIMESTAMPTZ NULL DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS products (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    image VARCHAR(255) NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity >= 0),
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version INT NOT NULL DEFAULT 1 CHECK (version >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL REFERENCES users (id),
+    total DECIMAL(10, 2) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'completed', 'cancelled')),
+    address TEXT NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id SERIAL PRIMARY KEY,
+    orderId INT NOT NULL REFERENCES orders (id),
+    productId INT NOT NULL REFERENCES products (id),
+    quantity INT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    subject VARCHAR(255) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0 CHECK (failures >= 0),
+    lastFailureAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lockedUntil TIMESTAMPTZ NULL DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id SERIAL PRIMARY KEY,
+    actorId INT NULL,
+    action VARCHAR(255) NOT NULL,
+    entityType VARCHAR(255) NOT NULL,
+    entityId VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    details VARCHAR(255) NOT NULL DEFAULT '',
+    before JSON NULL,
+    after JSON NULL,
+    requestId VARCHAR(64) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_entity ON audit_events (entityType, entityId);
+CREATE INDEX IF NOT EXISTS audit_events_actor ON audit_events (actorId);
+CREATE INDEX IF NOT EXISTS audit_events_created_at ON audit_events (createdAt);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL REFERENCES users (id),
+    purpose VARCHAR(32) NOT NULL CHECK (purpose IN ('email_verification', 'password_reset')),
+    tokenHash CHAR(64) UNIQUE NOT NULL,
+    expiresAt TIMESTAMPTZ NOT NULL,
+    usedAt TIMESTAMPTZ NULL DEFAULT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL REFERENCES users (id),
+    codeHash CHAR(64) NOT NULL,
+    usedAt TIMESTAMPTZ NULL DEFAULT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (userId, codeHash)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL REFERENCES users (id),
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    keyHash CHAR(64) UNIQUE NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    expiresAt TIMESTAMPTZ NULL DEFAULT NULL,
+    lastUsedAt TIMESTAMPTZ NULL DEFAULT NULL,
+    revokedAt TIMESTAMPTZ NULL DEFAULT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -11,14 +12,95 @@ import (
 const SEVEN_DAYS_IN_SECONDS int64 = 3600 * 24 * 7
 
 type Config struct {
-	PublicHost             string
-	Port                   string
-	DBUser                 string
-	DBPassword             string
-	DBAddress              string
-	DBName                 string
-	JWTExpirationInSeconds int64
-	JWTSecret              string
+	PublicHost string
+	Port       string
+	// DBDriver is `mysql`, `postgres` or `sqlite`.
+	DBDriver string
+	// DBDSN is the data source name of the driver, for MySQL it defaults to one built from the
+	// `DB_*` connection settings.
+	DBDSN      string
+	DBUser     string
+	DBPassword string
+	DBAddress  string
+	DBName     string
+	// DBMaxOpenConns, DBMaxIdleConns and the lifetimes tune the connection pool, zero keeps the
+	// defaults of `database/sql`.
+	DBMaxOpenConns             int64
+	DBMaxIdleConns             int64
+	DBConnMaxLifetimeInSeconds int64
+	DBConnMaxIdleTimeInSeconds int64
+	// DBConnectTimeoutInSeconds is how long the API waits for the database to answer on startup.
+	DBConnectTimeoutInSeconds int64
+	// DBTxMaxRetries is how many times a transaction is run again after a deadlock or a
+	// serialization failure.
+	DBTxMaxRetries int64
+	// DBReplicaDSNs are the data source names of the read replicas of `DB_DSN`, which serve the
+	// catalog reads.
+	DBReplicaDSNs []string
+	// DBReplicaHealthCheckInSeconds is how often the replicas are pinged, one which
+	// doesn't answer gets no reads until it does.
+	DBReplicaHealthCheckInSeconds int64
+	// DBReadYourWritesInSeconds is how long the reads of a user go to the primary after they
+	// wrote, it should cover the replication lag.
+	DBReadYourWritesInSeconds int64
+	JWTExpirationInSeconds    int64
+	JWTSecret                 string
+	// TrustedProxies is a list of CIDRs whose `X-Forwarded-For` header is trusted.
+	TrustedProxies               []string
+	RateLimitEnabled             bool
+	RateLimitAuthPerMinute       int64
+	RateLimitAuthBurst           int64
+	RateLimitAPIPerMinute        int64
+	RateLimitAPIBurst            int64
+	LoginMaxAccountFailures      int64
+	LoginMaxIPFailures           int64
+	LoginFailureWindowInSeconds  int64
+	LoginLockoutInSeconds        int64
+	LoginBaseDelayInMilliseconds int64
+	LoginMaxDelayInMilliseconds  int64
+	// FrontendURL is the base URL of the links sent by email.
+	FrontendURL string
+	// MailDriver is either `log`, which writes the emails to `MailLogFile` or stdout, or `smtp`.
+	MailDriver                      string
+	MailFrom                        string
+	MailLogFile                     string
+	SMTPHost                        string
+	SMTPPort                        string
+	SMTPUsername                    string
+	SMTPPassword                    string
+	EmailVerificationTTLInSeconds   int64
+	PasswordResetTTLInSeconds       int64
+	RequireVerifiedEmailForCheckout bool
+	TOTPIssuer                      string
+	RequireTwoFactorForAdmins       bool
+	// Argon2 cost parameters of new password hashes. Older hashes are upgraded on login.
+	PasswordArgon2MemoryInKiB int64
+	PasswordArgon2Iterations  int64
+	PasswordArgon2Parallelism int64
+	PasswordMinLength         int64
+	// PasswordBreachedListFile replaces the bundled list of breached passwords when set.
+	PasswordBreachedListFile string
+	// ImpersonationTTLInSeconds is how long an admin can act as a user with a single token.
+	ImpersonationTTLInSeconds int64
+	// AllowTokenInQuery accepts the JWT in the `token` query param, which ends up in access logs.
+	AllowTokenInQuery bool
+	// SessionCookieSecure only sends session cookies over HTTPS. Disable it for local development over HTTP.
+	SessionCookieSecure bool
+	// CORSAllowedOrigins are the browser origins allowed to call the API, `*` for any. Empty disables CORS.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	// CORSMaxAgeInSeconds is how long browsers cache preflight responses.
+	CORSMaxAgeInSeconds int64
+	// HSTSMaxAgeInSeconds is sent in `Strict-Transport-Security`. Zero disables the header.
+	HSTSMaxAgeInSeconds int64
+	// MaxBodyBytes limits request bodies of the routes without a limit of their own.
+	MaxBodyBytes int64
+	// ProductCacheEnabled caches product reads in process, for `ProductCacheTTLInSeconds` at most.
+	ProductCacheEnabled      bool
+	ProductCacheTTLInSeconds int64
+	ProductCacheMaxEntries   int64
 	// When adding new fields, make sure to update `.env.template`
 }
 
@@ -29,14 +111,68 @@ func initConfig() Config {
 	godotenv.Load()
 
 	return Config{
-		PublicHost:             getEnv("PUBLIC_HOST", "http://localhost"),
-		Port:                   getEnv("PORT", "8080"),
-		DBUser:                 getEnv("DB_USER", "root"),
-		DBPassword:             getEnv("DB_PASSWORD", "1234"),
-		DBAddress:              fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.1"), getEnv("DB_PORT", "3306")),
-		DBName:                 getEnv("DB_NAME", "ecommerceDb"),
-		JWTExpirationInSeconds: getEnvInt("JWT_EXPIRATION_IN_SECONDS", SEVEN_DAYS_IN_SECONDS),
-		JWTSecret:              getEnv("JWT_SECRET", "super-secret"),
+		PublicHost:                      getEnv("PUBLIC_HOST", "http://localhost"),
+		Port:                            getEnv("PORT", "8080"),
+		DBDriver:                        getEnv("DB_DRIVER", "mysql"),
+		DBDSN:                           getEnv("DB_DSN", ""),
+		DBUser:                          getEnv("DB_USER", "root"),
+		DBPassword:                      getEnv("DB_PASSWORD", "1234"),
+		DBAddress:                       fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.1"), getEnv("DB_PORT", "3306")),
+		DBName:                          getEnv("DB_NAME", "ecommerceDb"),
+		DBMaxOpenConns:                  getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:                  getEnvInt("DB_MAX_IDLE_CONNS", 25),
+		DBConnMaxLifetimeInSeconds:      getEnvInt("DB_CONN_MAX_LIFETIME_IN_SECONDS", 5*60),
+		DBConnMaxIdleTimeInSeconds:      getEnvInt("DB_CONN_MAX_IDLE_TIME_IN_SECONDS", 60),
+		DBConnectTimeoutInSeconds:       getEnvInt("DB_CONNECT_TIMEOUT_IN_SECONDS", 30),
+		DBTxMaxRetries:                  getEnvInt("DB_TX_MAX_RETRIES", 3),
+		DBReplicaDSNs:                   getEnvList("DB_REPLICA_DSNS", []string{}),
+		DBReplicaHealthCheckInSeconds:   getEnvInt("DB_REPLICA_HEALTH_CHECK_IN_SECONDS", 5),
+		DBReadYourWritesInSeconds:       getEnvInt("DB_READ_YOUR_WRITES_IN_SECONDS", 5),
+		JWTExpirationInSeconds:          getEnvInt("JWT_EXPIRATION_IN_SECONDS", SEVEN_DAYS_IN_SECONDS),
+		JWTSecret:                       getEnv("JWT_SECRET", "super-secret"),
+		TrustedProxies:                  getEnvList("TRUSTED_PROXIES", []string{}),
+		RateLimitEnabled:                getEnvBool("RATE_LIMIT_ENABLED", true),
+		RateLimitAuthPerMinute:          getEnvInt("RATE_LIMIT_AUTH_PER_MINUTE", 10),
+		RateLimitAuthBurst:              getEnvInt("RATE_LIMIT_AUTH_BURST", 5),
+		RateLimitAPIPerMinute:           getEnvInt("RATE_LIMIT_API_PER_MINUTE", 300),
+		RateLimitAPIBurst:               getEnvInt("RATE_LIMIT_API_BURST", 60),
+		LoginMaxAccountFailures:         getEnvInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		LoginMaxIPFailures:              getEnvInt("LOGIN_MAX_IP_FAILURES", 50),
+		LoginFailureWindowInSeconds:     getEnvInt("LOGIN_FAILURE_WINDOW_IN_SECONDS", 15*60),
+		LoginLockoutInSeconds:           getEnvInt("LOGIN_LOCKOUT_IN_SECONDS", 15*60),
+		LoginBaseDelayInMilliseconds:    getEnvInt("LOGIN_BASE_DELAY_IN_MILLISECONDS", 250),
+		LoginMaxDelayInMilliseconds:     getEnvInt("LOGIN_MAX_DELAY_IN_MILLISECONDS", 4000),
+		FrontendURL:                     getEnv("FRONTEND_URL", "http://localhost:3000"),
+		MailDriver:                      getEnv("MAIL_DRIVER", "log"),
+		MailFrom:                        getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailLogFile:                     getEnv("MAIL_LOG_FILE", ""),
+		SMTPHost:                        getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                        getEnv("SMTP_PORT", "1025"),
+		SMTPUsername:                    getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                    getEnv("SMTP_PASSWORD", ""),
+		EmailVerificationTTLInSeconds:   getEnvInt("EMAIL_VERIFICATION_TTL_IN_SECONDS", 3600*24),
+		PasswordResetTTLInSeconds:       getEnvInt("PASSWORD_RESET_TTL_IN_SECONDS", 3600),
+		RequireVerifiedEmailForCheckout: getEnvBool("REQUIRE_VERIFIED_EMAIL_FOR_CHECKOUT", false),
+		TOTPIssuer:                      getEnv("TOTP_ISSUER", "Golang Store API"),
+		RequireTwoFactorForAdmins:       getEnvBool("REQUIRE_2FA_FOR_ADMINS", false),
+		PasswordArgon2MemoryInKiB:       getEnvInt("PASSWORD_ARGON2_MEMORY_IN_KIB", 64*1024),
+		PasswordArgon2Iterations:        getEnvInt("PASSWORD_ARGON2_ITERATIONS", 3),
+		PasswordArgon2Parallelism:       getEnvInt("PASSWORD_ARGON2_PARALLELISM", 2),
+		PasswordMinLength:               getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordBreachedListFile:        getEnv("PASSWORD_BREACHED_LIST_FILE", ""),
+		ImpersonationTTLInSeconds:       getEnvInt("IMPERSONATION_TTL_IN_SECONDS", 15*60),
+		AllowTokenInQuery:               getEnvBool("ALLOW_TOKEN_IN_QUERY", false),
+		SessionCookieSecure:             getEnvBool("SESSION_COOKIE_SECURE", true),
+		CORSAllowedOrigins:              getEnvList("CORS_ALLOWED_ORIGINS", []string{}),
+		CORSAllowedMethods:              getEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"}),
+		CORSAllowedHeaders:              getEnvList("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "X-CSRF-Token", "X-Request-ID", "If-Match", "If-None-Match"}),
+		CORSAllowCredentials:            getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAgeInSeconds:             getEnvInt("CORS_MAX_AGE_IN_SECONDS", 600),
+		HSTSMaxAgeInSeconds:             getEnvInt("HSTS_MAX_AGE_IN_SECONDS", 3600*24*365),
+		MaxBodyBytes:                    getEnvInt("MAX_BODY_BYTES", 1<<20),
+		ProductCacheEnabled:             getEnvBool("PRODUCT_CACHE_ENABLED", true),
+		ProductCacheTTLInSeconds:        getEnvInt("PRODUCT_CACHE_TTL_IN_SECONDS", 60),
+		ProductCacheMaxEntries:          getEnvInt("PRODUCT_CACHE_MAX_ENTRIES", 10000),
 	}
 }
 
@@ -57,3 +193,28 @@ func getEnvInt(key string, fallback int64) int64 {
 	}
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fallback
+		}
+		return b
+	}
+	return fallback
+}
+
+// getEnvList returns a comma-separated environment variable as a list.
+func getEnvList(key string, fallback []string) []string {
+	if value, ok := os.LookupEnv(key); ok {
+		list := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return fallback
+}
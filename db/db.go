@@ -2,16 +2,212 @@ package db
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/go-sql-driver/mysql"
+	"github.com/sebastian-nunez/golang-store-api/config"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
-func NewMySQLStorage(cfg mysql.Config) (*sql.DB, error) {
-	db, err := sql.Open("mysql", cfg.FormatDSN())
+// DB is a connection pool which rewrites the queries of the stores for its dialect.
+type DB struct {
+	db      *sql.DB
+	dialect Dialect
+	// txRetries is how many times `Transact` runs a transaction again, see `Options`.
+	txRetries int
+	// replicas are nil without read replicas, see `Replica`.
+	replicas *replicas
+}
+
+// New wraps an open connection pool of the dialect.
+func New(db *sql.DB, dialect Dialect) *DB {
+	return &DB{db: db, dialect: dialect}
+}
+
+// Open opens a connection pool for a driver, `mysql`, `postgres` or `sqlite`, with a pool for
+// every read replica.
+func Open(driver string, dsn string, replicaDSNs ...string) (*DB, error) {
+	dialect, ok := DialectOf(driver)
+	if !ok {
+		return nil, fmt.Errorf("DB: unsupported driver %q", driver)
+	}
+
+	primary, err := open(driver, dialect, dsn)
 	if err != nil {
-		log.Fatal("DB: unable to open MySQL storage. ", err)
+		return nil, err
+	}
+
+	db := New(primary, dialect)
+	for _, replicaDSN := range replicaDSNs {
+		replica, err := open(driver, dialect, replicaDSN)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.AddReplica(replica)
 	}
 
 	return db, nil
 }
+
+func open(driver string, dialect Dialect, dsn string) (*sql.DB, error) {
+	if dialect == SQLite {
+		dsn = sqliteDSN(dsn)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("DB: unable to open %s storage: %w", driver, err)
+	}
+	return db, nil
+}
+
+// ConfiguredDSN returns `DB_DSN`, falling back for MySQL to a DSN built from the `DB_*`
+// connection settings.
+func ConfiguredDSN() string {
+	if config.Envs.DBDSN != "" || config.Envs.DBDriver != MySQL.Name() {
+		return config.Envs.DBDSN
+	}
+
+	cfg := mysql.Config{
+		User:                 config.Envs.DBUser,
+		Passwd:               config.Envs.DBPassword,
+		Addr:                 config.Envs.DBAddress,
+		DBName:               config.Envs.DBName,
+		Net:                  "tcp",
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	}
+	return cfg.FormatDSN()
+}
+
+// sqliteDSN adds the settings the stores rely on unless the DSN sets them: foreign keys,
+// times written in a format SQLite can compare, waiting on a locked database rather than
+// failing, and transactions which take the write lock up front like `FOR UPDATE` would.
+func sqliteDSN(dsn string) string {
+	if dsn == "" {
+		dsn = "file:store.db"
+	}
+
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return dsn
+	}
+
+	pragmas := strings.Join(params["_pragma"], ",")
+	if !strings.Contains(pragmas, "foreign_keys") {
+		params.Add("_pragma", "foreign_keys(1)")
+	}
+	if !strings.Contains(pragmas, "busy_timeout") {
+		params.Add("_pragma", "busy_timeout(5000)")
+	}
+	if !params.Has("_time_format") {
+		params.Set("_time_format", "sqlite")
+	}
+	if !params.Has("_txlock") {
+		params.Set("_txlock", "immediate")
+	}
+
+	return path + "?" + params.Encode()
+}
+
+func (d *DB) Dialect() Dialect { return d.dialect }
+
+// SQL returns the underlying connection pool, e.g. to tune it or run the migrations.
+func (d *DB) SQL() *sql.DB { return d.db }
+
+func (d *DB) Ping() error { return d.db.Ping() }
+
+// Close closes the primary and its replicas.
+func (d *DB) Close() error {
+	err := d.db.Close()
+	if d.replicas != nil {
+		err = errors.Join(err, d.replicas.close())
+	}
+	return err
+}
+
+func (d *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return d.db.Query(d.dialect.Rebind(query), convertArgs(d.dialect, args)...)
+}
+
+func (d *DB) QueryRow(query string, args ...any) *sql.Row {
+	return d.db.QueryRow(d.dialect.Rebind(query), convertArgs(d.dialect, args)...)
+}
+
+func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return d.db.Exec(d.dialect.Rebind(query), convertArgs(d.dialect, args)...)
+}
+
+// Insert runs an `INSERT` and returns the ID of the new row.
+func (d *DB) Insert(query string, args ...any) (int64, error) {
+	return insert(d, d.dialect, query, args)
+}
+
+func (d *DB) Begin() (*Tx, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, dialect: d.dialect}, nil
+}
+
+// Tx is a transaction which rewrites its queries like the `DB` it was begun on.
+type Tx struct {
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+func (t *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.tx.Query(t.dialect.Rebind(query), convertArgs(t.dialect, args)...)
+}
+
+func (t *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.tx.QueryRow(t.dialect.Rebind(query), convertArgs(t.dialect, args)...)
+}
+
+func (t *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.tx.Exec(t.dialect.Rebind(query), convertArgs(t.dialect, args)...)
+}
+
+// Insert runs an `INSERT` and returns the ID of the new row.
+func (t *Tx) Insert(query string, args ...any) (int64, error) {
+	return insert(t, t.dialect, query, args)
+}
+
+func (t *Tx) Commit() error { return t.tx.Commit() }
+
+func (t *Tx) Rollback() error { return t.tx.Rollback() }
+
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insert(q querier, dialect Dialect, query string, args []any) (int64, error) {
+	if dialect.Returning() {
+		var id int64
+		err := q.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func convertArgs(dialect Dialect, args []any) []any {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		converted[i] = dialect.Arg(arg)
+	}
+	return converted
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect hides the differences between the SQL of the supported databases. Stores write
+// their queries for MySQL, with `?` placeholders, and the dialect rewrites them as needed.
+type Dialect interface {
+	// Name is the driver name, as used by `DB_DRIVER`.
+	Name() string
+	// Rebind rewrites a query written for MySQL into this dialect.
+	Rebind(query string) string
+	// Concat joins the string expressions.
+	Concat(exprs ...string) string
+	// Like matches the expression against a pattern case-insensitively, `\` escaping the wildcards.
+	Like(expr string, pattern string) string
+	// OnConflictUpdate starts the assignments run when an insert hits the unique key.
+	OnConflictUpdate(key ...string) string
+	// Excluded refers to the value of the column the conflicting insert tried to write.
+	Excluded(column string) string
+	// Returning reports whether inserts return their ID with `RETURNING id` rather than the
+	// driver's last insert ID.
+	Returning() bool
+	// Arg converts a query argument into the form the driver expects.
+	Arg(arg any) any
+	// Retryable reports whether the error is a deadlock or a serialization failure, after which
+	// the whole transaction can be run again.
+	Retryable(err error) bool
+}
+
+var (
+	MySQL    Dialect = mysqlDialect{}
+	Postgres Dialect = postgresDialect{}
+	SQLite   Dialect = sqliteDialect{}
+)
+
+// DialectOf returns the dialect of a driver, `mysql`, `postgres` or `sqlite`.
+func DialectOf(driver string) (Dialect, bool) {
+	for _, dialect := range []Dialect{MySQL, Postgres, SQLite} {
+		if dialect.Name() == driver {
+			return dialect, true
+		}
+	}
+	return nil, false
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Rebind(query string) string { return query }
+
+func (mysqlDialect) Concat(exprs ...string) string {
+	return "CONCAT(" + strings.Join(exprs, ", ") + ")"
+}
+
+// The default collation already ignores the case and `\` is the default escape character.
+func (mysqlDialect) Like(expr string, pattern string) string {
+	return expr + " LIKE " + pattern
+}
+
+func (mysqlDialect) OnConflictUpdate(key ...string) string { return "ON DUPLICATE KEY UPDATE" }
+
+func (mysqlDialect) Excluded(column string) string { return "VALUES(" + column + ")" }
+
+func (mysqlDialect) Returning() bool { return false }
+
+func (mysqlDialect) Arg(arg any) any { return arg }
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+// Rebind numbers the placeholders and swaps the backticks quoting identifiers for double quotes.
+func (postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			inString = !inString
+		case inString:
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		case c == '`':
+			c = '"'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (postgresDialect) Concat(exprs ...string) string { return strings.Join(exprs, " || ") }
+
+func (postgresDialect) Like(expr string, pattern string) string {
+	return expr + " ILIKE " + pattern
+}
+
+func (postgresDialect) OnConflictUpdate(key ...string) string {
+	return "ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET"
+}
+
+func (postgresDialect) Excluded(column string) string { return "excluded." + column }
+
+func (postgresDialect) Returning() bool { return true }
+
+func (postgresDialect) Arg(arg any) any { return arg }
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+// Rebind drops row locks, SQLite locks the whole database when a transaction begins instead.
+func (sqliteDialect) Rebind(query string) string {
+	return strings.ReplaceAll(query, " FOR UPDATE", "")
+}
+
+func (sqliteDialect) Concat(exprs ...string) string { return strings.Join(exprs, " || ") }
+
+// LIKE already ignores the case of ASCII letters but has no default escape character.
+func (sqliteDialect) Like(expr string, pattern string) string {
+	return expr + " LIKE " + pattern + ` ESCAPE '\'`
+}
+
+func (sqliteDialect) OnConflictUpdate(key ...string) string {
+	return "ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET"
+}
+
+func (sqliteDialect) Excluded(column string) string { return "excluded." + column }
+
+func (sqliteDialect) Returning() bool { return false }
+
+// Arg stores times in UTC, SQLite compares them as text so they must share an offset with the
+// `CURRENT_TIMESTAMP` defaults.
+func (sqliteDialect) Arg(arg any) any {
+	switch v := arg.(type) {
+	case time.Time:
+		return v.UTC()
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC()
+	}
+	return arg
+}
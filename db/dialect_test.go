@@ -0,0 +1,91 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "mysql keeps the query",
+			dialect: MySQL,
+			query:   "SELECT * FROM products WHERE id = ? FOR UPDATE",
+			want:    "SELECT * FROM products WHERE id = ? FOR UPDATE",
+		},
+		{
+			name:    "postgres numbers the placeholders and quotes identifiers",
+			dialect: Postgres,
+			query:   "INSERT INTO audit_events (action, `before`) VALUES (?, ?)",
+			want:    `INSERT INTO audit_events (action, "before") VALUES ($1, $2)`,
+		},
+		{
+			name:    "postgres leaves string literals alone",
+			dialect: Postgres,
+			query:   "UPDATE users SET firstName = 'Who?', email = ? WHERE id = ?",
+			want:    "UPDATE users SET firstName = 'Who?', email = $1 WHERE id = $2",
+		},
+		{
+			name:    "sqlite drops row locks",
+			dialect: SQLite,
+			query:   "SELECT role FROM users WHERE id = ? FOR UPDATE",
+			want:    "SELECT role FROM users WHERE id = ?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.Rebind(tt.query); got != tt.want {
+				t.Errorf("expected %q, but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDialectOf(t *testing.T) {
+	for _, driver := range []string{"mysql", "postgres", "sqlite"} {
+		dialect, ok := DialectOf(driver)
+		if !ok || dialect.Name() != driver {
+			t.Errorf("expected the %s dialect, but got %v", driver, dialect)
+		}
+	}
+
+	if _, ok := DialectOf("oracle"); ok {
+		t.Errorf("expected no dialect given an unsupported driver")
+	}
+}
+
+func TestSQLiteArg(t *testing.T) {
+	local := time.Date(2024, 8, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+
+	if got := SQLite.Arg(local).(time.Time); got.Location() != time.UTC || !got.Equal(local) {
+		t.Errorf("expected the time in UTC, but got %v", got)
+	}
+	if got := SQLite.Arg(&local).(time.Time); got.Location() != time.UTC {
+		t.Errorf("expected the time in UTC, but got %v", got)
+	}
+	if got := SQLite.Arg((*time.Time)(nil)); got != nil {
+		t.Errorf("expected nil, but got %v", got)
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	t.Run("should add the settings the stores rely on", func(t *testing.T) {
+		want := "file:store.db?_pragma=foreign_keys%281%29&_pragma=busy_timeout%285000%29&_time_format=sqlite&_txlock=immediate"
+		if got := sqliteDSN(""); got != want {
+			t.Errorf("expected %q, but got %q", want, got)
+		}
+	})
+
+	t.Run("should keep the settings of the DSN", func(t *testing.T) {
+		want := "file:test.db?_pragma=busy_timeout%28100%29&_pragma=foreign_keys%281%29&_time_format=sqlite&_txlock=deferred"
+		if got := sqliteDSN("file:test.db?_txlock=deferred&_pragma=busy_timeout(100)"); got != want {
+			t.Errorf("expected %q, but got %q", want, got)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaFallbacks counts the reads sent to the primary because no replica was healthy,
+// published as `db_replica_fallbacks`.
+var ReplicaFallbacks = expvar.NewInt("db_replica_fallbacks")
+
+// replica is a read-only copy of the primary, skipped by `Replica` while its health check fails.
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// replicas are the read replicas of a primary, picked round-robin.
+type replicas struct {
+	all  []*replica
+	next atomic.Uint64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// AddReplica adds a read replica of the primary. Replicas are healthy until a health check
+// started with `CheckReplicas` fails.
+func (d *DB) AddReplica(db *sql.DB) {
+	if d.replicas == nil {
+		d.replicas = &replicas{stop: make(chan struct{})}
+	}
+
+	r := &replica{db: db}
+	r.healthy.Store(true)
+	d.replicas.all = append(d.replicas.all, r)
+}
+
+// Replica returns the next healthy replica to read from, or the primary when there is none.
+// Replicas lag behind the primary: reads which must see a write, and anything in a
+// transaction, go to the primary.
+func (d *DB) Replica() *DB {
+	if d.replicas == nil {
+		return d
+	}
+
+	n := len(d.replicas.all)
+	start := d.replicas.next.Add(1)
+	for i := range n {
+		r := d.replicas.all[(start+uint64(i))%uint64(n)]
+		if r.healthy.Load() {
+			return &DB{db: r.db, dialect: d.dialect, txRetries: d.txRetries}
+		}
+	}
+
+	ReplicaFallbacks.Add(1)
+	return d.Primary()
+}
+
+// Primary returns the primary without its replicas, so reads through it see every write.
+func (d *DB) Primary() *DB {
+	return &DB{db: d.db, dialect: d.dialect, txRetries: d.txRetries}
+}
+
+// CheckReplicas pings every replica right away and then at every interval, until `Close`. A
+// replica which doesn't answer within the interval gets no reads until it answers again.
+func (d *DB) CheckReplicas(interval time.Duration) {
+	if d.replicas == nil {
+		return
+	}
+
+	d.replicas.check(interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.replicas.check(interval)
+			case <-d.replicas.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (rs *replicas) check(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for i, r := range rs.all {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			err := r.db.PingContext(ctx)
+			if healthy := err == nil; r.healthy.Swap(healthy) != healthy {
+				if healthy {
+					log.Printf("DB: replica %d is healthy again", i)
+				} else {
+					log.Printf("DB: replica %d is unhealthy, reading from the others: %v", i, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (rs *replicas) close() error {
+	rs.stopOnce.Do(func() { close(rs.stop) })
+
+	var errs []error
+	for _, r := range rs.all {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type primaryKey struct{}
+
+// WithPrimary marks the context of a request whose reads must go to the primary, e.g. because
+// the user just wrote.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsePrimary reports whether the reads of the request must go to the primary.
+func UsePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// RecentWrites remembers the users who wrote within the window, which should cover the lag of
+// the replicas. It is local to the instance.
+type RecentWrites struct {
+	mu        sync.Mutex
+	window    time.Duration
+	until     map[string]time.Time
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func NewRecentWrites(window time.Duration) *RecentWrites {
+	return &RecentWrites{
+		window: window,
+		until:  make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Record remembers that the user identified by key just wrote.
+func (w *RecentWrites) Record(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	if now.Sub(w.lastSweep) >= w.window {
+		for k, until := range w.until {
+			if !now.Before(until) {
+				delete(w.until, k)
+			}
+		}
+		w.lastSweep = now
+	}
+
+	w.until[key] = now.Add(w.window)
+}
+
+// Recent reports whether the user identified by key wrote within the window.
+func (w *RecentWrites) Recent(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	until, ok := w.until[key]
+	return ok && w.now().Before(until)
+}
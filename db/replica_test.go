@@ -0,0 +1,140 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReplica(t *testing.T) {
+	newMock := func(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+		sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sqlDB, mock
+	}
+
+	t.Run("should read from the primary without replicas", func(t *testing.T) {
+		primary, _ := newMock(t)
+		d := New(primary, MySQL)
+
+		if got := d.Replica().SQL(); got != primary {
+			t.Error("expected the primary")
+		}
+	})
+
+	t.Run("should read from the replicas round-robin", func(t *testing.T) {
+		primary, _ := newMock(t)
+		first, _ := newMock(t)
+		second, _ := newMock(t)
+		d := New(primary, MySQL)
+		d.AddReplica(first)
+		d.AddReplica(second)
+
+		seen := map[*sql.DB]int{}
+		for range 4 {
+			seen[d.Replica().SQL()]++
+		}
+		if seen[first] != 2 || seen[second] != 2 {
+			t.Errorf("expected 2 reads from each replica, but got %d and %d", seen[first], seen[second])
+		}
+	})
+
+	t.Run("should skip unhealthy replicas and fall back to the primary", func(t *testing.T) {
+		primary, _ := newMock(t)
+		first, firstMock := newMock(t)
+		second, secondMock := newMock(t)
+		d := New(primary, MySQL)
+		d.AddReplica(first)
+		d.AddReplica(second)
+
+		firstMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		secondMock.ExpectPing()
+		d.replicas.check(time.Second)
+		for range 2 {
+			if got := d.Replica().SQL(); got != second {
+				t.Error("expected the healthy replica")
+			}
+		}
+
+		firstMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		secondMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		d.replicas.check(time.Second)
+		fallbacks := ReplicaFallbacks.Value()
+		if got := d.Replica().SQL(); got != primary {
+			t.Error("expected the primary")
+		}
+		if got := ReplicaFallbacks.Value() - fallbacks; got != 1 {
+			t.Errorf("expected 1 fallback to be counted, but got %d", got)
+		}
+
+		firstMock.ExpectPing()
+		secondMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		d.replicas.check(time.Second)
+		if got := d.Replica().SQL(); got != first {
+			t.Error("expected the replica which recovered")
+		}
+	})
+
+	t.Run("should ignore the replicas of the primary", func(t *testing.T) {
+		primary, _ := newMock(t)
+		replica, _ := newMock(t)
+		d := New(primary, MySQL)
+		d.AddReplica(replica)
+
+		if got := d.Primary().Replica().SQL(); got != primary {
+			t.Error("expected the primary")
+		}
+	})
+
+	t.Run("should close the replicas with the primary", func(t *testing.T) {
+		primary, primaryMock := newMock(t)
+		replica, replicaMock := newMock(t)
+		d := New(primary, MySQL)
+		d.AddReplica(replica)
+
+		primaryMock.ExpectClose()
+		replicaMock.ExpectClose()
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for _, mock := range []sqlmock.Sqlmock{primaryMock, replicaMock} {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+func TestRecentWrites(t *testing.T) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	writes := NewRecentWrites(5 * time.Second)
+	writes.now = func() time.Time { return now }
+
+	if writes.Recent("user:1") {
+		t.Error("expected no recent write before the first write")
+	}
+
+	writes.Record("user:1")
+	now = now.Add(4 * time.Second)
+	if !writes.Recent("user:1") {
+		t.Error("expected a recent write within the window")
+	}
+	if writes.Recent("user:2") {
+		t.Error("expected no recent write of another user")
+	}
+
+	now = now.Add(time.Second)
+	if writes.Recent("user:1") {
+		t.Error("expected no recent write after the window")
+	}
+
+	writes.Record("user:2")
+	if _, ok := writes.until["user:1"]; ok {
+		t.Error("expected the expired write to be swept")
+	}
+}
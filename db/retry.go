@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"modernc.org/sqlite"
+)
+
+// TxRetries counts the transactions run again by `Transact`, published as `db_tx_retries`.
+var TxRetries = expvar.NewInt("db_tx_retries")
+
+var (
+	// connectBackoff is the first wait between pings in `WaitForConnection`, doubled after every
+	// failure up to maxConnectBackoff.
+	connectBackoff    = 100 * time.Millisecond
+	maxConnectBackoff = 5 * time.Second
+	// txBackoff is the longest first wait before a transaction is run again, doubled for every
+	// retry. The actual wait is random, so the transactions which collided don't collide again.
+	txBackoff = 20 * time.Millisecond
+)
+
+// Options tune the connection pool and the retries of transactions. Zero values keep the
+// defaults of `database/sql`.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// TxRetries is how many times `Transact` runs a transaction again after a deadlock or a
+	// serialization failure.
+	TxRetries int
+}
+
+// ConfiguredOptions returns the options set by the `DB_*` pool settings.
+func ConfiguredOptions() Options {
+	return Options{
+		MaxOpenConns:    int(config.Envs.DBMaxOpenConns),
+		MaxIdleConns:    int(config.Envs.DBMaxIdleConns),
+		ConnMaxLifetime: time.Duration(config.Envs.DBConnMaxLifetimeInSeconds) * time.Second,
+		ConnMaxIdleTime: time.Duration(config.Envs.DBConnMaxIdleTimeInSeconds) * time.Second,
+		TxRetries:       int(config.Envs.DBTxMaxRetries),
+	}
+}
+
+// Configure tunes the connection pools of the primary and its replicas, and the retries of
+// `Transact`.
+func (d *DB) Configure(opts Options) {
+	configurePool(d.db, opts)
+	if d.replicas != nil {
+		for _, r := range d.replicas.all {
+			configurePool(r.db, opts)
+		}
+	}
+	d.txRetries = opts.TxRetries
+}
+
+func configurePool(db *sql.DB, opts Options) {
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+}
+
+// WaitForConnection pings the database until it answers, waiting exponentially longer between
+// pings, e.g. while it starts next to the API. It gives up with the last error after timeout.
+func (d *DB) WaitForConnection(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := connectBackoff
+	for {
+		err := d.db.Ping()
+		if err == nil {
+			return nil
+		}
+
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 {
+			return fmt.Errorf("DB: unable to connect within %s: %w", timeout, err)
+		}
+		log.Printf("DB: unable to connect, retrying in %s: %v", wait, err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+// Transact runs fn in a transaction and commits it. The whole transaction runs again when it
+// fails with a deadlock or a serialization failure, so fn must not have effects outside of it.
+func (d *DB) Transact(fn func(tx *Tx) error) error {
+	backoff := txBackoff
+	for attempt := 0; ; attempt++ {
+		err := d.transact(fn)
+		if err == nil || attempt >= d.txRetries || !d.dialect.Retryable(err) {
+			return err
+		}
+
+		TxRetries.Add(1)
+		time.Sleep(rand.N(backoff) + 1)
+		backoff *= 2
+	}
+}
+
+func (d *DB) transact(fn func(tx *Tx) error) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 1213 is a deadlock and 1205 a lock wait timeout. InnoDB rolls back the whole transaction on a
+// deadlock but only the statement on a timeout, rolling back the rest is up to `Transact`.
+func (mysqlDialect) Retryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1213 || mysqlErr.Number == 1205)
+}
+
+// 40001 is a serialization failure and 40P01 a deadlock.
+func (postgresDialect) Retryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// The database stays busy or locked past the busy timeout under heavy write contention.
+func (sqliteDialect) Retryable(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == 5 || code == 6
+}
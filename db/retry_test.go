@@ -0,0 +1,161 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestTransact(t *testing.T) {
+	defer func(backoff time.Duration) { txBackoff = backoff }(txBackoff)
+	txBackoff = time.Millisecond
+
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+	t.Run("should run the transaction again after a deadlock", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := New(sqlDB, MySQL)
+		d.Configure(Options{TxRetries: 3})
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products").WillReturnError(deadlock)
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		retries := TxRetries.Value()
+		err = d.Transact(func(tx *Tx) error {
+			_, err := tx.Exec("UPDATE products SET quantity = quantity - 1 WHERE id = ?", 1)
+			return err
+		})
+		if err != nil {
+			t.Errorf("expected no error, but got %v", err)
+		}
+		if got := TxRetries.Value() - retries; got != 1 {
+			t.Errorf("expected 1 retry to be counted, but got %d", got)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should give up after the configured retries", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := New(sqlDB, MySQL)
+		d.Configure(Options{TxRetries: 1})
+
+		for range 2 {
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE products").WillReturnError(deadlock)
+			mock.ExpectRollback()
+		}
+
+		err = d.Transact(func(tx *Tx) error {
+			_, err := tx.Exec("UPDATE products SET quantity = quantity - 1 WHERE id = ?", 1)
+			return err
+		})
+		if !errors.Is(err, deadlock) {
+			t.Errorf("expected the deadlock, but got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should not run the transaction again after other errors", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := New(sqlDB, MySQL)
+		d.Configure(Options{TxRetries: 3})
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		calls := 0
+		wantErr := errors.New("product 1 is out of stock")
+		err = d.Transact(func(tx *Tx) error {
+			calls++
+			return wantErr
+		})
+		if !errors.Is(err, wantErr) || calls != 1 {
+			t.Errorf("expected a single failed attempt, but got %d attempts and %v", calls, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestWaitForConnection(t *testing.T) {
+	defer func(backoff time.Duration) { connectBackoff = backoff }(connectBackoff)
+	connectBackoff = time.Millisecond
+
+	t.Run("should ping until the database answers", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing()
+
+		if err := New(sqlDB, MySQL).WaitForConnection(time.Second); err != nil {
+			t.Errorf("expected no error, but got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should give up after the timeout", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 100 {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}
+
+		if err := New(sqlDB, MySQL).WaitForConnection(10 * time.Millisecond); err == nil {
+			t.Error("expected an error, but got none")
+		}
+	})
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		err     error
+		want    bool
+	}{
+		{"mysql deadlock", MySQL, &mysql.MySQLError{Number: 1213}, true},
+		{"mysql lock wait timeout", MySQL, &mysql.MySQLError{Number: 1205}, true},
+		{"mysql duplicate entry", MySQL, &mysql.MySQLError{Number: 1062}, false},
+		{"postgres serialization failure", Postgres, &pq.Error{Code: "40001"}, true},
+		{"postgres deadlock", Postgres, &pq.Error{Code: "40P01"}, true},
+		{"postgres unique violation", Postgres, &pq.Error{Code: "23505"}, false},
+		{"other error", MySQL, errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.Retryable(tt.err); got != tt.want {
+				t.Errorf("expected %v, but got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package apikey
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+const (
+	ActionCreated = "api_key.created"
+	ActionRevoked = "api_key.revoked"
+
+	// keyPrefix marks API keys so they are recognizable, e.g. by secret scanners.
+	keyPrefix = "sk_"
+	// displayedLength is how much of the key is kept in the clear to tell keys apart.
+	displayedLength = len(keyPrefix) + 8
+)
+
+type Handler struct {
+	store      types.APIKeyStore
+	userStore  types.UserStore
+	auditStore types.AuditStore
+}
+
+func NewHandler(store types.APIKeyStore, userStore types.UserStore, auditStore types.AuditStore) *Handler {
+	return &Handler{
+		store:      store,
+		userStore:  userStore,
+		auditStore: auditStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes.
+	router.HandleFunc("/admin/api-keys", auth.WithAdminAuth(h.handleCreateAPIKey, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/api-keys", auth.WithAdminAuth(h.handleGetAPIKeys, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/api-keys/{id}", auth.WithAdminAuth(h.handleRevokeAPIKey, h.userStore)).Methods(http.MethodDelete)
+}
+
+// handleCreateAPIKey creates a key acting on behalf of the admin making the request. The key is
+// only returned here, just its hash is stored.
+func (h *Handler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var payload types.CreateAPIKeyRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		utils.WriteFieldErrors(w, r, []utils.FieldError{
+			{Field: "expiresAt", Rule: "future", Message: "expiresAt must be in the future"},
+		})
+		return
+	}
+
+	plain, _, err := token.New()
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	plain = keyPrefix + plain
+
+	key := types.APIKey{
+		UserID:    auth.GetUserIDFromContext(r.Context()),
+		Name:      payload.Name,
+		Prefix:    plain[:displayedLength],
+		KeyHash:   token.Hash(plain),
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	key.ID, err = h.store.CreateAPIKey(key)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit(r, ActionCreated, key.ID)
+	utils.WriteJson(w, http.StatusCreated, map[string]any{
+		"apiKey": key,
+		"key":    plain,
+	})
+}
+
+func (h *Handler) handleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.store.GetAPIKeys()
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, keys)
+}
+
+func (h *Handler) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid api key id"))
+		return
+	}
+
+	if err := h.store.RevokeAPIKey(id, time.Now()); err != nil {
+		utils.WriteError(w, r, http.StatusNotFound, err)
+		return
+	}
+
+	h.audit(r, ActionRevoked, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// audit records an action on an API key. A failure is logged, the action already happened.
+func (h *Handler) audit(r *http.Request, action string, keyID int) {
+	event := audit.FromRequest(r, action)
+	event.EntityType = "api_key"
+	event.EntityID = strconv.Itoa(keyID)
+	if err := h.auditStore.CreateAuditEvent(event); err != nil {
+		log.Printf("unable to audit %s of api key %d: %v", action, keyID, err)
+	}
+}
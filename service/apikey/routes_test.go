@@ -0,0 +1,154 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+const adminID = 1
+
+func TestAPIKeyService(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should create a key and only return it once", func(t *testing.T) {
+		store := &mockAPIKeyStore{}
+		auditStore := &mockAuditStore{}
+		handler := NewHandler(store, nil, auditStore)
+
+		rr := serve(handler, http.MethodPost, "/admin/api-keys", types.CreateAPIKeyRequest{
+			Name:   "warehouse",
+			Scopes: []string{types.ScopeProductsWrite},
+		})
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("want status code %d and got %d", http.StatusCreated, rr.Code)
+		}
+
+		var res struct {
+			APIKey types.APIKey `json:"apiKey"`
+			Key    string       `json:"key"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(res.Key, keyPrefix) || !strings.HasPrefix(res.Key, res.APIKey.Prefix) {
+			t.Errorf("want a key starting with its prefix and got %q", res.Key)
+		}
+		if store.created.KeyHash != token.Hash(res.Key) || store.created.UserID != adminID {
+			t.Errorf("want the hash of the key to be stored for the admin and got %+v", store.created)
+		}
+		if len(auditStore.events) != 1 || auditStore.events[0].Action != ActionCreated {
+			t.Errorf("want the creation to be audited and got %v", auditStore.events)
+		}
+	})
+
+	t.Run("should fail to create a key given an invalid payload", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		tests := []struct {
+			name    string
+			payload types.CreateAPIKeyRequest
+		}{
+			{name: "missing name", payload: types.CreateAPIKeyRequest{Scopes: []string{types.ScopeOrdersRead}}},
+			{name: "missing scopes", payload: types.CreateAPIKeyRequest{Name: "erp"}},
+			{name: "unknown scope", payload: types.CreateAPIKeyRequest{Name: "erp", Scopes: []string{"admin:*"}}},
+			{name: "expired", payload: types.CreateAPIKeyRequest{Name: "erp", Scopes: []string{types.ScopeOrdersRead}, ExpiresAt: &past}},
+		}
+
+		for _, tt := range tests {
+			store := &mockAPIKeyStore{}
+			rr := serve(NewHandler(store, nil, &mockAuditStore{}), http.MethodPost, "/admin/api-keys", tt.payload)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: want status code %d and got %d", tt.name, http.StatusBadRequest, rr.Code)
+			}
+			if store.created.Name != "" {
+				t.Errorf("%s: want no key to be created", tt.name)
+			}
+		}
+	})
+
+	t.Run("should revoke a key", func(t *testing.T) {
+		store := &mockAPIKeyStore{}
+		auditStore := &mockAuditStore{}
+		rr := serve(NewHandler(store, nil, auditStore), http.MethodDelete, "/admin/api-keys/3", nil)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("want status code %d and got %d", http.StatusNoContent, rr.Code)
+		}
+		if store.revoked != 3 {
+			t.Errorf("want key 3 to be revoked and got %d", store.revoked)
+		}
+		if len(auditStore.events) != 1 || auditStore.events[0].EntityID != "3" {
+			t.Errorf("want the revocation to be audited and got %v", auditStore.events)
+		}
+	})
+
+	t.Run("should fail to revoke a key which doesn't exist", func(t *testing.T) {
+		rr := serve(NewHandler(&mockAPIKeyStore{}, nil, &mockAuditStore{}), http.MethodDelete, "/admin/api-keys/999", nil)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("want status code %d and got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func serve(handler *Handler, method string, endpoint string, payload any) *httptest.ResponseRecorder {
+	var body []byte
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+
+	req, _ := http.NewRequest(method, endpoint, bytes.NewBuffer(body))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, adminID))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/api-keys", handler.handleCreateAPIKey).Methods(http.MethodPost)
+	router.HandleFunc("/admin/api-keys", handler.handleGetAPIKeys).Methods(http.MethodGet)
+	router.HandleFunc("/admin/api-keys/{id}", handler.handleRevokeAPIKey).Methods(http.MethodDelete)
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+type mockAPIKeyStore struct {
+	types.APIKeyStore
+	created types.APIKey
+	revoked int
+}
+
+func (m *mockAPIKeyStore) CreateAPIKey(key types.APIKey) (int, error) {
+	m.created = key
+	return 1, nil
+}
+
+func (m *mockAPIKeyStore) RevokeAPIKey(id int, revokedAt time.Time) error {
+	if id == 999 {
+		return fmt.Errorf("api key not found or already revoked")
+	}
+	m.revoked = id
+	return nil
+}
+
+type mockAuditStore struct {
+	types.AuditStore
+	events []types.AuditEvent
+}
+
+func (m *mockAuditStore) CreateAuditEvent(event types.AuditEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
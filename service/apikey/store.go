@@ -0,0 +1,134 @@
+package apikey
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+type Store struct {
+	db *db.DB
+}
+
+func NewStore(db *db.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateAPIKey(key types.APIKey) (int, error) {
+	id, err := s.db.Insert(
+		"INSERT INTO api_keys (userId, name, prefix, keyHash, scopes, expiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		strings.Join(key.Scopes, ","),
+		key.ExpiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) GetAPIKeyByHash(keyHash string) (*types.APIKey, error) {
+	rows, err := s.db.Query("SELECT * FROM api_keys WHERE keyHash = ?", keyHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	key := new(types.APIKey)
+	for rows.Next() {
+		key, err = scanRowsIntoAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if key.ID == 0 {
+		return nil, fmt.Errorf("api key not found")
+	}
+
+	return key, nil
+}
+
+func (s *Store) GetAPIKeys() ([]types.APIKey, error) {
+	rows, err := s.db.Query("SELECT * FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]types.APIKey, 0)
+	for rows.Next() {
+		key, err := scanRowsIntoAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+func (s *Store) RevokeAPIKey(id int, revokedAt time.Time) error {
+	res, err := s.db.Exec("UPDATE api_keys SET revokedAt = ? WHERE id = ? AND revokedAt IS NULL", revokedAt, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("api key not found or already revoked")
+	}
+
+	return nil
+}
+
+func (s *Store) TouchAPIKey(id int, usedAt time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET lastUsedAt = ? WHERE id = ?", usedAt, id)
+	return err
+}
+
+func scanRowsIntoAPIKey(rows *sql.Rows) (*types.APIKey, error) {
+	key := new(types.APIKey)
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := rows.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
@@ -0,0 +1,41 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sebastian-nunez/golang-store-api/db"
+)
+
+func TestGetAPIKeyByHash(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to stub db %s", err)
+	}
+	defer sqlDB.Close()
+
+	store := NewStore(db.New(sqlDB, db.MySQL))
+
+	columns := []string{"id", "userId", "name", "prefix", "keyHash", "scopes", "expiresAt", "lastUsedAt", "revokedAt", "createdAt"}
+	mock.ExpectQuery("SELECT \\* FROM api_keys WHERE keyHash = \\?").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 2, "warehouse", "sk_abcdefgh", "hash", "products:write,orders:read", nil, nil, nil, time.Now()))
+
+	key, err := store.GetAPIKeyByHash("hash")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	if len(key.Scopes) != 2 || !key.HasScopes("products:write", "orders:read") {
+		t.Errorf("expected the scopes to be split, but got %v", key.Scopes)
+	}
+	if key.ExpiresAt != nil || key.LastUsedAt != nil || key.RevokedAt != nil {
+		t.Errorf("expected no expiry, last use or revocation, but got %+v", key)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+// FromRequest starts an event for an action of the request. The actor is the authenticated
+// user, or the admin impersonating them, and the details name the API key used if any. Callers
+// fill in the entity and its changes.
+func FromRequest(r *http.Request, action string) types.AuditEvent {
+	event := types.AuditEvent{
+		Action:    action,
+		IP:        utils.ClientIP(r),
+		RequestID: utils.GetRequestID(r.Context()),
+	}
+
+	if key, ok := auth.GetAPIKeyFromContext(r.Context()); ok {
+		event.Details = "api key " + key.Prefix
+	}
+
+	if actorID, ok := auth.GetActorIDFromContext(r.Context()); ok {
+		event.ActorID = &actorID
+	} else if userID := auth.GetUserIDFromContext(r.Context()); userID != -1 {
+		event.ActorID = &userID
+	}
+
+	return event
+}
+
+// Changes returns the JSON fields which differ between the two versions of an entity, e.g.
+// `{"quantity":5}` and `{"quantity":3}`. A nil before, for a created entity, keeps every field of after.
+func Changes(before any, after any) (json.RawMessage, json.RawMessage, error) {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for key, value := range afterFields {
+		if previous, ok := beforeFields[key]; ok && reflect.DeepEqual(previous, value) {
+			delete(beforeFields, key)
+			delete(afterFields, key)
+		}
+	}
+
+	return marshalFields(beforeFields), marshalFields(afterFields), nil
+}
+
+func toFields(v any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if v == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func marshalFields(fields map[string]any) json.RawMessage {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// A map of decoded JSON values always marshals.
+	b, _ := json.Marshal(fields)
+	return b
+}
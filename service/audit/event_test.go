@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     any
+		after      any
+		wantBefore string
+		wantAfter  string
+	}{
+		{
+			name:      "keeps every field of a created entity",
+			after:     types.CreateProductRequest{Name: "Jordans", Price: 125, Quantity: 5},
+			wantAfter: `{"description":"","image":"","name":"Jordans","price":125,"quantity":5}`,
+		},
+		{
+			name:       "keeps only the changed fields",
+			before:     types.Product{ID: 1, Name: "Jordans", Quantity: 5},
+			after:      types.Product{ID: 1, Name: "Jordans", Quantity: 3},
+			wantBefore: `{"quantity":5}`,
+			wantAfter:  `{"quantity":3}`,
+		},
+		{
+			name:   "returns nothing when nothing changed",
+			before: map[string]string{"role": "admin"},
+			after:  map[string]string{"role": "admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after, err := Changes(tt.before, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(before) != tt.wantBefore {
+				t.Errorf("expected before %s, but got %s", tt.wantBefore, before)
+			}
+			if string(after) != tt.wantAfter {
+				t.Errorf("expected after %s, but got %s", tt.wantAfter, after)
+			}
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	t.Run("should use the authenticated user as actor", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/products", nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 7))
+
+		event := FromRequest(req, "product.created")
+		if event.ActorID == nil || *event.ActorID != 7 {
+			t.Errorf("expected actor 7, but got %v", event.ActorID)
+		}
+	})
+
+	t.Run("should use the admin as actor while impersonating", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/products", nil)
+		ctx := context.WithValue(req.Context(), auth.UserKey, 7)
+		req = req.WithContext(context.WithValue(ctx, auth.ActorKey, 1))
+
+		event := FromRequest(req, "product.created")
+		if event.ActorID == nil || *event.ActorID != 1 {
+			t.Errorf("expected actor 1, but got %v", event.ActorID)
+		}
+	})
+
+	t.Run("should have no actor for anonymous requests", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/login", nil)
+
+		event := FromRequest(req, "user.logged_in")
+		if event.ActorID != nil {
+			t.Errorf("expected no actor, but got %d", *event.ActorID)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+type Handler struct {
+	store     types.AuditStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.AuditStore, userStore types.UserStore) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes.
+	router.HandleFunc("/admin/audit", auth.WithAdminAuth(h.handleGetAuditEvents, h.userStore, types.ScopeAuditRead)).Methods(http.MethodGet)
+}
+
+// handleGetAuditEvents returns a page of the audit events matching the `actorId`, `entityType`,
+// `entityId`, `from` and `to` query params, newest first.
+func (h *Handler) handleGetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	events, total, err := h.store.GetAuditEvents(filter)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, types.AuditEventPage{
+		Events:   events,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+func parseFilter(r *http.Request) (types.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := types.AuditFilter{
+		EntityType: query.Get("entityType"),
+		EntityID:   query.Get("entityId"),
+	}
+
+	if v := query.Get("actorId"); v != "" {
+		actorID, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("actorId must be a number")
+		}
+		filter.ActorID = &actorID
+	}
+
+	if filter.EntityID != "" && filter.EntityType == "" {
+		return filter, fmt.Errorf("entityId requires an entityType")
+	}
+
+	var err error
+	if filter.From, err = parseTime(query.Get("from"), "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTime(query.Get("to"), "to"); err != nil {
+		return filter, err
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	return filter, nil
+}
+
+func parseTime(v string, param string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp, e.g. 2024-08-24T09:00:00Z", param)
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestAuditService(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		endpoint   string
+		wantStatus int
+		wantFilter types.AuditFilter
+	}{
+		{
+			name:       "should list the first page of events",
+			endpoint:   "/admin/audit",
+			wantStatus: http.StatusOK,
+			wantFilter: types.AuditFilter{Limit: 20},
+		},
+		{
+			name:       "should filter events by entity",
+			endpoint:   "/admin/audit?entityType=product&entityId=3&page=2&pageSize=10",
+			wantStatus: http.StatusOK,
+			wantFilter: types.AuditFilter{EntityType: "product", EntityID: "3", Limit: 10, Offset: 10},
+		},
+		{
+			name:       "should fail given an invalid actor",
+			endpoint:   "/admin/audit?actorId=me",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail given an entity id without an entity type",
+			endpoint:   "/admin/audit?entityId=3",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail given an invalid time",
+			endpoint:   "/admin/audit?from=yesterday",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail given a time range ending before it starts",
+			endpoint:   "/admin/audit?from=2024-08-24T00:00:00Z&to=2024-08-23T00:00:00Z",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockAuditStore{}
+			handler := NewHandler(store, nil)
+
+			req, err := http.NewRequest(http.MethodGet, tc.endpoint, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/admin/audit", handler.handleGetAuditEvents).Methods(http.MethodGet)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("expected status code %d and got %d", tc.wantStatus, rr.Code)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			if store.filter.EntityType != tc.wantFilter.EntityType || store.filter.EntityID != tc.wantFilter.EntityID ||
+				store.filter.Limit != tc.wantFilter.Limit || store.filter.Offset != tc.wantFilter.Offset {
+				t.Errorf("expected filter %+v and got %+v", tc.wantFilter, store.filter)
+			}
+
+			var page types.AuditEventPage
+			if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != 1 || len(page.Events) != 1 {
+				t.Errorf("expected a page with the event and got %+v", page)
+			}
+		})
+	}
+}
+
+type mockAuditStore struct {
+	filter types.AuditFilter
+}
+
+func (m *mockAuditStore) CreateAuditEvent(event types.AuditEvent) error {
+	return nil
+}
+
+func (m *mockAuditStore) GetAuditEvents(filter types.AuditFilter) ([]types.AuditEvent, int, error) {
+	m.filter = filter
+	return []types.AuditEvent{{ID: 1, Action: "product.created"}}, 1, nil
+}
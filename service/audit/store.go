@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// Execer is satisfied by both `*db.DB` and `*db.Tx`, so stores can record an event in the
+// transaction of the change it describes.
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type Store struct {
+	db *db.DB
+}
+
+func NewStore(db *db.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateAuditEvent(event types.AuditEvent) error {
+	return Record(s.db, event)
+}
+
+// Record writes the event with the given connection or transaction.
+func Record(exec Execer, event types.AuditEvent) error {
+	_, err := exec.Exec(
+		"INSERT INTO audit_events (actorId, action, entityType, entityId, ip, details, `before`, `after`, requestId) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.ActorID,
+		event.Action,
+		event.EntityType,
+		event.EntityID,
+		event.IP,
+		event.Details,
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		event.RequestID,
+	)
+	return err
+}
+
+func (s *Store) GetAuditEvents(filter types.AuditFilter) ([]types.AuditEvent, int, error) {
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	if filter.ActorID != nil {
+		conditions = append(conditions, "actorId = ?")
+		args = append(args, *filter.ActorID)
+	}
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entityType = ?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		conditions = append(conditions, "entityId = ?")
+		args = append(args, filter.EntityID)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "createdAt >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "createdAt < ?")
+		args = append(args, *filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_events"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(
+		"SELECT * FROM audit_events"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := make([]types.AuditEvent, 0)
+	for rows.Next() {
+		event, err := scanRowsIntoAuditEvent(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		events = append(events, *event)
+	}
+
+	return events, total, nil
+}
+
+func scanRowsIntoAuditEvent(rows *sql.Rows) (*types.AuditEvent, error) {
+	event := new(types.AuditEvent)
+	var actorID sql.NullInt64
+	var before, after []byte
+	err := rows.Scan(
+		&event.ID,
+		&actorID,
+		&event.Action,
+		&event.EntityType,
+		&event.EntityID,
+		&event.IP,
+		&event.CreatedAt,
+		&event.Details,
+		&before,
+		&after,
+		&event.RequestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if actorID.Valid {
+		id := int(actorID.Int64)
+		event.ActorID = &id
+	}
+	event.Before = before
+	event.After = after
+
+	return event, nil
+}
+
+// nullJSON stores missing changes as NULL, an empty string isn't a valid JSON column value.
+func nullJSON(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestCreateAuditEvent(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to stub db %s", err)
+	}
+	defer sqlDB.Close()
+
+	store := NewStore(db.New(sqlDB, db.MySQL))
+
+	actorID := 1
+	event := types.AuditEvent{
+		ActorID:    &actorID,
+		Action:     "user.role_changed",
+		EntityType: "user",
+		EntityID:   "2",
+		IP:         "127.0.0.1",
+		Before:     json.RawMessage(`{"role":"customer"}`),
+		After:      json.RawMessage(`{"role":"admin"}`),
+		RequestID:  "abc-123",
+	}
+
+	mock.ExpectExec("INSERT INTO audit_events").
+		WithArgs(&actorID, event.Action, event.EntityType, event.EntityID, event.IP, "", `{"role":"customer"}`, `{"role":"admin"}`, event.RequestID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := store.CreateAuditEvent(event); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetAuditEvents(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to stub db %s", err)
+	}
+	defer sqlDB.Close()
+
+	store := NewStore(db.New(sqlDB, db.MySQL))
+
+	actorID := 1
+	from := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	filter := types.AuditFilter{
+		ActorID:    &actorID,
+		EntityType: "product",
+		From:       &from,
+		Limit:      20,
+		Offset:     0,
+	}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM audit_events WHERE actorId = \? AND entityType = \? AND createdAt >= \?`).
+		WithArgs(actorID, "product", from).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	columns := []string{"id", "actorId", "action", "entityType", "entityId", "ip", "createdAt", "details", "before", "after", "requestId"}
+	mock.ExpectQuery(`SELECT \* FROM audit_events WHERE actorId = \? AND entityType = \? AND createdAt >= \? ORDER BY id DESC LIMIT \? OFFSET \?`).
+		WithArgs(actorID, "product", from, 20, 0).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, actorID, "product.created", "product", "3", "127.0.0.1", from, "", nil, []byte(`{"name":"Jordans"}`), "abc-123"))
+
+	events, total, err := store.GetAuditEvents(filter)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	if total != 1 || len(events) != 1 {
+		t.Fatalf("expected 1 event, but got %d of %d", len(events), total)
+	}
+	if *events[0].ActorID != actorID || events[0].Before != nil || string(events[0].After) != `{"name":"Jordans"}` {
+		t.Errorf("expected the event to be scanned, but got %+v", events[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// APIKeyScheme prefixes API keys in the `Authorization` header, e.g. `ApiKey sk_...`.
+const APIKeyScheme = "ApiKey "
+
+// lastUsedResolution spares the database a write per request: the last use of a key is only
+// updated when the recorded one is older.
+const lastUsedResolution = time.Minute
+
+var errMissingScope = fmt.Errorf("api key is missing a scope required by this route")
+
+// WithAPIKeys authenticates requests sent with an API key, which the guards of the routes then
+// accept in place of a JWT if the key has the scopes of the route. Meant to be installed with `router.Use`.
+func WithAPIKeys(store types.APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plain, ok := strings.CutPrefix(r.Header.Get("Authorization"), APIKeyScheme)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := store.GetAPIKeyByHash(token.Hash(strings.TrimSpace(plain)))
+			if err != nil {
+				log.Printf("unable to find api key: %v", err)
+				permissionDenied(w, r)
+				return
+			}
+
+			now := time.Now()
+			if err := checkAPIKey(key, now); err != nil {
+				log.Printf("api key %d is not usable: %v", key.ID, err)
+				permissionDenied(w, r)
+				return
+			}
+
+			if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+				if err := store.TouchAPIKey(key.ID, now); err != nil {
+					log.Printf("unable to record the use of api key %d: %v", key.ID, err)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), APIKeyKey, key)))
+		})
+	}
+}
+
+// GetAPIKeyFromContext returns the API key the request was authenticated with, if any.
+func GetAPIKeyFromContext(ctx context.Context) (*types.APIKey, bool) {
+	key, ok := ctx.Value(APIKeyKey).(*types.APIKey)
+	return key, ok
+}
+
+func checkAPIKey(key *types.APIKey, now time.Time) error {
+	if key.RevokedAt != nil {
+		return fmt.Errorf("revoked at %s", key.RevokedAt.Format(time.RFC3339))
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return fmt.Errorf("expired at %s", key.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
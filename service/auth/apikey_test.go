@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestWithAPIKeys(t *testing.T) {
+	const plainKey = "sk_some-random-key"
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		header     string
+		key        *types.APIKey
+		scopes     []string
+		wantStatus int
+		wantTouch  bool
+	}{
+		{
+			name:       "should let a key with the scopes of the route through",
+			header:     APIKeyScheme + plainKey,
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeProductsWrite, types.ScopeOrdersRead}},
+			scopes:     []string{types.ScopeOrdersRead},
+			wantStatus: http.StatusOK,
+			wantTouch:  true,
+		},
+		{
+			name:       "should not record a use again right after the last one",
+			header:     APIKeyScheme + plainKey,
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeOrdersRead}, LastUsedAt: ptr(time.Now())},
+			scopes:     []string{types.ScopeOrdersRead},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should deny a key without the scopes of the route",
+			header:     APIKeyScheme + plainKey,
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeProductsWrite}},
+			scopes:     []string{types.ScopeOrdersRead},
+			wantStatus: http.StatusForbidden,
+			wantTouch:  true,
+		},
+		{
+			name:       "should deny a key on a route without scopes",
+			header:     APIKeyScheme + plainKey,
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeOrdersRead}},
+			wantStatus: http.StatusForbidden,
+			wantTouch:  true,
+		},
+		{
+			name:       "should deny an unknown key",
+			header:     APIKeyScheme + "sk_unknown",
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeOrdersRead}},
+			scopes:     []string{types.ScopeOrdersRead},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a revoked key",
+			header:     APIKeyScheme + plainKey,
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeOrdersRead}, RevokedAt: &past},
+			scopes:     []string{types.ScopeOrdersRead},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny an expired key",
+			header:     APIKeyScheme + plainKey,
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeOrdersRead}, ExpiresAt: &past},
+			scopes:     []string{types.ScopeOrdersRead},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should let a key which expires later through",
+			header:     APIKeyScheme + plainKey,
+			key:        &types.APIKey{ID: 1, UserID: 1, Scopes: []string{types.ScopeOrdersRead}, ExpiresAt: &future},
+			scopes:     []string{types.ScopeOrdersRead},
+			wantStatus: http.StatusOK,
+			wantTouch:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.key.KeyHash = token.Hash(plainKey)
+			keyStore := &mockAPIKeyStore{key: tt.key}
+			// Sessions revoked after the key was created don't affect it.
+			userStore := &mockUserStore{user: &types.User{ID: 1, SessionsRevokedAt: ptr(time.Now().Add(time.Hour))}}
+
+			handler := WithAPIKeys(keyStore)(WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+				if GetUserIDFromContext(r.Context()) != tt.key.UserID {
+					t.Errorf("expected the owner of the key in the context")
+				}
+			}, userStore, tt.scopes...))
+
+			req, _ := http.NewRequest(http.MethodGet, "/some-endpoint", nil)
+			req.Header.Set("Authorization", tt.header)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status code %d and got %d", tt.wantStatus, rr.Code)
+			}
+			if keyStore.touched != tt.wantTouch {
+				t.Errorf("expected the use of the key to be recorded: %v", tt.wantTouch)
+			}
+		})
+	}
+
+	t.Run("should leave requests without a key to the JWT", func(t *testing.T) {
+		jwtToken, _ := CreateJWTToken([]byte(config.Envs.JWTSecret), 1)
+		handler := WithAPIKeys(&mockAPIKeyStore{})(WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {}, &mockUserStore{user: &types.User{ID: 1}}, types.ScopeOrdersRead))
+
+		req, _ := http.NewRequest(http.MethodGet, "/some-endpoint", nil)
+		req.Header.Set("Authorization", jwtToken)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+type mockAPIKeyStore struct {
+	types.APIKeyStore
+	key     *types.APIKey
+	touched bool
+}
+
+func (m *mockAPIKeyStore) GetAPIKeyByHash(keyHash string) (*types.APIKey, error) {
+	if m.key == nil || m.key.KeyHash != keyHash {
+		return nil, fmt.Errorf("api key not found")
+	}
+	return m.key, nil
+}
+
+func (m *mockAPIKeyStore) TouchAPIKey(id int, usedAt time.Time) error {
+	m.touched = true
+	return nil
+}
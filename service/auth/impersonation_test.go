@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestImpersonation(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+	token, err := CreateImpersonationToken(secret, 1, 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &types.User{ID: 1, Role: types.RoleCustomer}
+	issuedAt := time.Now()
+	tests := []struct {
+		name       string
+		actor      *types.User
+		wantStatus int
+	}{
+		{
+			name:       "should let an admin act as the user",
+			actor:      &types.User{ID: 2, Role: types.RoleAdmin},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should deny an actor who is no longer an admin",
+			actor:      &types.User{ID: 2, Role: types.RoleCustomer},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a disabled admin",
+			actor:      &types.User{ID: 2, Role: types.RoleAdmin, DisabledAt: ptr(issuedAt.Add(-time.Hour))},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a token issued before the sessions of the admin were revoked",
+			actor:      &types.User{ID: 2, Role: types.RoleAdmin, SessionsRevokedAt: ptr(issuedAt.Add(time.Hour))},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+				if GetUserIDFromContext(r.Context()) != user.ID {
+					t.Errorf("expected user %d in the context", user.ID)
+				}
+				if actorID, ok := GetActorIDFromContext(r.Context()); !ok || actorID != tt.actor.ID {
+					t.Errorf("expected actor %d in the context and got %d", tt.actor.ID, actorID)
+				}
+			}, &mockUserStore{user: user, actor: tt.actor})
+
+			req, _ := http.NewRequest(http.MethodGet, "/some-endpoint", nil)
+			req.Header.Set("Authorization", token)
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status code %d and got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should deny sensitive actions while impersonating", func(t *testing.T) {
+		store := &mockUserStore{user: user, actor: &types.User{ID: 2, Role: types.RoleAdmin}}
+		handler := WithJWTAuth(DenyImpersonation(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected the handler not to be called")
+		}), store)
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/me/password", nil)
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d and got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should allow sensitive actions to the user themselves", func(t *testing.T) {
+		sessionToken, _ := CreateJWTToken(secret, 1)
+		handler := WithJWTAuth(DenyImpersonation(func(w http.ResponseWriter, r *http.Request) {}), &mockUserStore{user: user})
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/me/password", nil)
+		req.Header.Set("Authorization", sessionToken)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func TestAuditImpersonation(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+	impersonationToken, _ := CreateImpersonationToken(secret, 1, 2, time.Minute)
+	sessionToken, _ := CreateJWTToken(secret, 1)
+
+	t.Run("should audit a request made with an impersonation token", func(t *testing.T) {
+		audit := &mockAuditStore{}
+		handler := AuditImpersonation(audit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req, _ := http.NewRequest(http.MethodGet, "/cart", nil)
+		req.Header.Set("Authorization", impersonationToken)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if len(audit.events) != 1 {
+			t.Fatalf("expected 1 audit event and got %d", len(audit.events))
+		}
+
+		event := audit.events[0]
+		if *event.ActorID != 2 || event.EntityID != "1" || event.Details != "GET /cart" {
+			t.Errorf("expected the admin acting as the user on GET /cart and got %+v", event)
+		}
+	})
+
+	t.Run("should not audit a regular request", func(t *testing.T) {
+		audit := &mockAuditStore{}
+		handler := AuditImpersonation(audit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req, _ := http.NewRequest(http.MethodGet, "/cart", nil)
+		req.Header.Set("Authorization", sessionToken)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if len(audit.events) != 0 {
+			t.Errorf("expected no audit events and got %d", len(audit.events))
+		}
+	})
+
+	t.Run("should refuse an impersonated request which can't be audited", func(t *testing.T) {
+		handler := AuditImpersonation(&mockAuditStore{err: fmt.Errorf("db error")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected the handler not to be called")
+		}))
+
+		req, _ := http.NewRequest(http.MethodGet, "/cart", nil)
+		req.Header.Set("Authorization", impersonationToken)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code %d and got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
+
+type mockAuditStore struct {
+	types.AuditStore
+	events []types.AuditEvent
+	err    error
+}
+
+func (m *mockAuditStore) CreateAuditEvent(event types.AuditEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, event)
+	return nil
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
 	"github.com/sebastian-nunez/golang-store-api/config"
 	"github.com/sebastian-nunez/golang-store-api/types"
 	"github.com/sebastian-nunez/golang-store-api/utils"
@@ -16,15 +18,31 @@ import (
 
 type Key string
 
-const UserKey Key = "userID"
+const (
+	UserKey Key = "userID"
+	// ActorKey holds the ID of the admin impersonating the user, if any.
+	ActorKey Key = "actorID"
+	// APIKeyKey holds the API key the request was authenticated with, if any.
+	APIKeyKey Key = "apiKey"
+	// CookieSessionKey is set when the request was authenticated with the session cookie.
+	CookieSessionKey Key = "cookieSession"
+)
+
+const (
+	// challengeExpiration is how long a user has to enter their 2FA code after their password.
+	challengeExpiration = 5 * time.Minute
+	purposeTwoFactor    = "2fa"
+)
 
 // CreateJwt returns a signed JWT token.
 func CreateJWTToken(secret []byte, userId int) (string, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
 
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId":    strconv.Itoa(userId),
-		"expiredAt": time.Now().Add(expiration).Unix(),
+		"userId": strconv.Itoa(userId),
+		"iat":    issuedAtClaim(now),
+		"exp":    now.Add(expiration).Unix(),
 	})
 
 	tokenStr, err := token.SignedString(secret)
@@ -35,6 +53,36 @@ func CreateJWTToken(secret []byte, userId int) (string, error) {
 	return tokenStr, nil
 }
 
+// CreateChallengeToken returns a short-lived token proving that the password of the user was checked.
+// It can only be exchanged for a session token together with a 2FA code.
+func CreateChallengeToken(secret []byte, userId int) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userId":  strconv.Itoa(userId),
+		"purpose": purposeTwoFactor,
+		"iat":     issuedAtClaim(now),
+		"exp":     now.Add(challengeExpiration).Unix(),
+	})
+
+	return token.SignedString(secret)
+}
+
+// ParseChallengeToken returns the user ID of a valid, unexpired challenge token.
+func ParseChallengeToken(tokenStr string) (int, error) {
+	token, err := validateJWT(tokenStr)
+	if err != nil {
+		return 0, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["purpose"] != purposeTwoFactor {
+		return 0, fmt.Errorf("not a challenge token")
+	}
+
+	str, _ := claims["userId"].(string)
+	return strconv.Atoi(str)
+}
+
 func validateJWT(tokenStr string) (*jwt.Token, error) {
 	return jwt.Parse(tokenStr, func(token *jwt.Token) (any, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -45,48 +93,207 @@ func validateJWT(tokenStr string) (*jwt.Token, error) {
 	})
 }
 
-func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.HandlerFunc {
+// WithJWTAuth guards the route for authenticated users. Besides a JWT, the route accepts an API
+// key with every one of the scopes; without scopes, it is only open to JWTs.
+func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore, scopes ...string) http.HandlerFunc {
+	return withUser(handlerFunc, store, scopes, func(u *types.User) error { return nil })
+}
+
+// WithAdminAuth guards the route for users with the admin role. Admins must have 2FA enabled when
+// `REQUIRE_2FA_FOR_ADMINS` is set. API keys of admins need the scopes, as with `WithJWTAuth`.
+func WithAdminAuth(handlerFunc http.HandlerFunc, store types.UserStore, scopes ...string) http.HandlerFunc {
+	return withUser(handlerFunc, store, scopes, isAdmin)
+}
+
+// WithSelfOrAdminAuth guards the routes of a single user, e.g. `/users/{id}`, for that user and for admins.
+func WithSelfOrAdminAuth(handlerFunc http.HandlerFunc, store types.UserStore, scopes ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		withUser(handlerFunc, store, scopes, func(u *types.User) error {
+			if mux.Vars(r)["id"] == strconv.Itoa(u.ID) {
+				return nil
+			}
+			return isAdmin(u)
+		})(w, r)
+	}
+}
+
+func isAdmin(u *types.User) error {
+	if u.Role != types.RoleAdmin {
+		return errPermissionDenied
+	}
+	if config.Envs.RequireTwoFactorForAdmins && !u.HasTwoFactor() {
+		return fmt.Errorf("admins must enable two-factor authentication")
+	}
+	return nil
+}
+
+// withUser authenticates the user of the request, from their JWT or from an API key with the
+// scopes, and lets it through if it is allowed.
+func withUser(handlerFunc http.HandlerFunc, store types.UserStore, scopes []string, allowed func(u *types.User) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenStr := utils.GetTokenFromRequest(r)
+		claims, err := claimsFromRequest(r, scopes)
+		if err != nil {
+			log.Printf("unable to authenticate request: %v", err)
+			if err == errMissingScope || err == errInvalidCSRFToken {
+				utils.WriteError(w, r, http.StatusForbidden, err)
+				return
+			}
+			permissionDenied(w, r)
+			return
+		}
 
-		token, err := validateJWT(tokenStr)
+		u, err := store.GetUserByID(claims.userID)
 		if err != nil {
-			log.Printf("unable to validate token: %v", err)
-			permissionDenied(w)
+			log.Printf("failed to get user by id: %v", err)
+			permissionDenied(w, r)
 			return
 		}
 
-		if !token.Valid {
-			log.Println("invalid token!")
-			permissionDenied(w)
+		if u.DeletedAt != nil {
+			log.Printf("user %d is deleted", u.ID)
+			permissionDenied(w, r)
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		str := claims["userId"].(string)
+		if u.DisabledAt != nil {
+			log.Printf("user %d is disabled", u.ID)
+			utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("account is disabled"))
+			return
+		}
 
-		userID, err := strconv.Atoi(str)
-		if err != nil {
-			log.Printf("failed to convert userId to int: %v", err)
-			permissionDenied(w)
+		// API keys are revoked one by one rather than with the sessions of their owner.
+		if !claims.apiKey && revoked(claims, u) {
+			log.Printf("token of user %d was revoked", u.ID)
+			permissionDenied(w, r)
 			return
 		}
 
-		u, err := store.GetUserByID(userID)
-		if err != nil {
-			log.Printf("failed to get user by id: %v", err)
-			permissionDenied(w)
+		if err := allowed(u); err != nil {
+			log.Printf("user %d with role %q is not allowed: %v", u.ID, u.Role, err)
+			utils.WriteError(w, r, http.StatusForbidden, err)
 			return
 		}
 
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, UserKey, u.ID)
+		if claims.fromCookie {
+			ctx = context.WithValue(ctx, CookieSessionKey, true)
+		}
+		if claims.actorID != 0 {
+			if err := checkActor(store, claims); err != nil {
+				log.Printf("impersonation of user %d by %d is not allowed: %v", u.ID, claims.actorID, err)
+				permissionDenied(w, r)
+				return
+			}
+			ctx = context.WithValue(ctx, ActorKey, claims.actorID)
+		}
 		r = r.WithContext(ctx)
 
 		handlerFunc(w, r)
 	}
 }
 
+// UserIDFromRequest returns the user ID from the token of the request without checking that the
+// user still exists. Use `WithJWTAuth` to guard routes.
+func UserIDFromRequest(r *http.Request) (int, bool) {
+	tokenStr, _ := tokenFromRequest(r)
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return 0, false
+	}
+	return claims.userID, true
+}
+
+// claimsFromRequest returns the claims of the JWT of the request, or of the API key authenticated
+// by `WithAPIKeys` if it has the scopes. A JWT sent as a cookie needs a valid CSRF token.
+func claimsFromRequest(r *http.Request, scopes []string) (*tokenClaims, error) {
+	key, ok := GetAPIKeyFromContext(r.Context())
+	if !ok {
+		tokenStr, fromCookie := tokenFromRequest(r)
+		if fromCookie {
+			if err := checkCSRF(r); err != nil {
+				return nil, err
+			}
+		}
+
+		claims, err := parseToken(tokenStr)
+		if err != nil {
+			return nil, err
+		}
+		claims.fromCookie = fromCookie
+		return claims, nil
+	}
+
+	if len(scopes) == 0 || !key.HasScopes(scopes...) {
+		return nil, errMissingScope
+	}
+
+	return &tokenClaims{userID: key.UserID, apiKey: true}, nil
+}
+
+type tokenClaims struct {
+	userID int
+	// apiKey is set when the claims come from an API key rather than a JWT.
+	apiKey bool
+	// fromCookie is set when the JWT was sent as the session cookie.
+	fromCookie bool
+	// actorID is the admin impersonating the user, or zero.
+	actorID int
+	// issuedAt is zero for tokens issued before the claim was added.
+	issuedAt time.Time
+}
+
+// issuedAtClaim is the `iat` claim with microsecond precision, so a token issued right after the
+// sessions were revoked is told apart from one issued right before, in the same second.
+func issuedAtClaim(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// revoked reports whether the token was issued before the sessions of the user were revoked,
+// to the microsecond. Tokens whose `iat` is in whole seconds are revoked within the same second.
+func revoked(claims *tokenClaims, u *types.User) bool {
+	return u.SessionsRevokedAt != nil && claims.issuedAt.Before(u.SessionsRevokedAt.Truncate(time.Microsecond))
+}
+
+func parseToken(tokenStr string) (*tokenClaims, error) {
+	token, err := validateJWT(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if _, ok := claims["purpose"]; ok {
+		return nil, fmt.Errorf("not a session token")
+	}
+
+	str, ok := claims["userId"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing or invalid userId claim")
+	}
+
+	userID, err := strconv.Atoi(str)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert userId to int: %v", err)
+	}
+
+	parsed := &tokenClaims{userID: userID}
+	if act, ok := claims["act"].(map[string]any); ok {
+		sub, _ := act["sub"].(string)
+		if parsed.actorID, err = strconv.Atoi(sub); err != nil || parsed.actorID == 0 {
+			return nil, fmt.Errorf("invalid actor claim")
+		}
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		parsed.issuedAt = time.UnixMicro(int64(math.Round(iat * 1e6)))
+	}
+
+	return parsed, nil
+}
+
 func GetUserIDFromContext(ctx context.Context) int {
 	userID, ok := ctx.Value(UserKey).(int)
 	if !ok {
@@ -95,6 +302,8 @@ func GetUserIDFromContext(ctx context.Context) int {
 	return userID
 }
 
-func permissionDenied(w http.ResponseWriter) {
-	utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+var errPermissionDenied = fmt.Errorf("permission denied")
+
+func permissionDenied(w http.ResponseWriter, r *http.Request) {
+	utils.WriteError(w, r, http.StatusForbidden, errPermissionDenied)
 }
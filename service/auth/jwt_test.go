@@ -1,6 +1,16 @@
 package auth
 
-import "testing"
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
 
 func TestCreateJWTToken(t *testing.T) {
 	t.Run("should return a valid JWT token", func(t *testing.T) {
@@ -17,3 +27,215 @@ func TestCreateJWTToken(t *testing.T) {
 		}
 	})
 }
+
+func TestWithJWTAuth(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+	token, err := CreateJWTToken(secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challengeToken, err := CreateChallengeToken(secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiration := config.Envs.JWTExpirationInSeconds
+	config.Envs.JWTExpirationInSeconds = -60
+	expiredToken, err := CreateJWTToken(secret, 1)
+	config.Envs.JWTExpirationInSeconds = expiration
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuedAt := time.Now()
+	// Tokens are told apart from the revocation to the microsecond.
+	time.Sleep(time.Millisecond)
+	revokedAt := time.Now()
+	time.Sleep(time.Millisecond)
+	reissuedToken, err := CreateJWTToken(secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		user       *types.User
+		wantStatus int
+	}{
+		{
+			name:       "should let a valid token through",
+			token:      token,
+			user:       &types.User{ID: 1},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should deny a missing token",
+			token:      "",
+			user:       &types.User{ID: 1},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a 2FA challenge token",
+			token:      challengeToken,
+			user:       &types.User{ID: 1},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny an expired token",
+			token:      expiredToken,
+			user:       &types.User{ID: 1},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a disabled user",
+			token:      token,
+			user:       &types.User{ID: 1, DisabledAt: ptr(issuedAt.Add(-time.Hour))},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a deleted user",
+			token:      token,
+			user:       &types.User{ID: 1, DeletedAt: ptr(issuedAt.Add(-time.Hour))},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a token issued before the sessions were revoked",
+			token:      token,
+			user:       &types.User{ID: 1, SessionsRevokedAt: ptr(issuedAt.Add(time.Hour))},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should let a token issued after the sessions were revoked through",
+			token:      token,
+			user:       &types.User{ID: 1, SessionsRevokedAt: ptr(issuedAt.Add(-time.Hour))},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should deny a token issued right before the sessions were revoked",
+			token:      token,
+			user:       &types.User{ID: 1, SessionsRevokedAt: ptr(revokedAt)},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should let a token issued right after the sessions were revoked through",
+			token:      reissuedToken,
+			user:       &types.User{ID: 1, SessionsRevokedAt: ptr(revokedAt)},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+				if GetUserIDFromContext(r.Context()) != tt.user.ID {
+					t.Errorf("expected user %d in the context", tt.user.ID)
+				}
+			}, &mockUserStore{user: tt.user})
+
+			req, _ := http.NewRequest(http.MethodGet, "/some-endpoint", nil)
+			req.Header.Set("Authorization", tt.token)
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status code %d and got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+type mockUserStore struct {
+	types.UserStore
+	user *types.User
+	// actor is the admin impersonating the user, if any.
+	actor *types.User
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if m.actor != nil && m.actor.ID == id {
+		return m.actor, nil
+	}
+	if m.user == nil || m.user.ID != id {
+		return nil, fmt.Errorf("user not found")
+	}
+	return m.user, nil
+}
+
+func TestWithSelfOrAdminAuth(t *testing.T) {
+	token, err := CreateJWTToken([]byte(config.Envs.JWTSecret), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		endpoint   string
+		user       *types.User
+		wantStatus int
+	}{
+		{
+			name:       "should let a user read themselves",
+			endpoint:   "/users/1",
+			user:       &types.User{ID: 1, Role: types.RoleCustomer},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should deny a user reading someone else",
+			endpoint:   "/users/2",
+			user:       &types.User{ID: 1, Role: types.RoleCustomer},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should let an admin read someone else",
+			endpoint:   "/users/2",
+			user:       &types.User{ID: 1, Role: types.RoleAdmin},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.HandleFunc("/users/{id}", WithSelfOrAdminAuth(func(w http.ResponseWriter, r *http.Request) {}, &mockUserStore{user: tt.user}))
+
+			req, _ := http.NewRequest(http.MethodGet, tt.endpoint, nil)
+			req.Header.Set("Authorization", token)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status code %d and got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestParseChallengeToken(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+
+	t.Run("should return the user of a challenge token", func(t *testing.T) {
+		token, _ := CreateChallengeToken(secret, 1234)
+
+		userID, err := ParseChallengeToken(token)
+		if err != nil {
+			t.Fatalf("expected no error and got %v", err)
+		}
+		if userID != 1234 {
+			t.Errorf("expected user 1234 and got %d", userID)
+		}
+	})
+
+	t.Run("should reject a session token", func(t *testing.T) {
+		token, _ := CreateJWTToken(secret, 1234)
+
+		if _, err := ParseChallengeToken(token); err == nil {
+			t.Error("expected an error for a session token")
+		}
+	})
+}
@@ -1,20 +1,120 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword returns a hashed password.
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHasher hashes passwords and verifies them against stored hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns whether the plain password matches the hash, and whether the hash should be
+	// replaced because it uses an outdated algorithm or parameters.
+	Verify(hashed string, plain string) (ok bool, needsRehash bool)
+}
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Hasher hashes passwords with argon2id in the PHC string format, e.g.
+// `$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>`. Legacy bcrypt hashes are still verified but
+// always need a rehash.
+type Hasher struct {
+	params Argon2Params
+}
+
+func NewHasher(params Argon2Params) *Hasher {
+	return &Hasher{params: params}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
 		return "", err
 	}
-	return string(hash), nil
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
-// ComparePasswords returns true if the hashed password matches the plain password.
-func ComparePasswords(hashed string, plain string) bool {
+func (h *Hasher) Verify(hashed string, plain string) (bool, bool) {
+	if strings.HasPrefix(hashed, "$argon2id$") {
+		return h.verifyArgon2(hashed, plain)
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plain))
-	return err == nil
+	return err == nil, true
+}
+
+func (h *Hasher) verifyArgon2(hashed string, plain string) (bool, bool) {
+	version, params, salt, key, err := decodeArgon2Hash(hashed)
+	if err != nil {
+		return false, false
+	}
+
+	other := argon2.IDKey([]byte(plain), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false
+	}
+
+	needsRehash := version != argon2.Version || params != h.params ||
+		len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+	return true, needsRehash
+}
+
+func decodeArgon2Hash(hashed string) (int, Argon2Params, []byte, []byte, error) {
+	var (
+		version int
+		params  Argon2Params
+	)
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return 0, params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return 0, params, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return 0, params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return 0, params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return 0, params, nil, nil, fmt.Errorf("invalid argon2id key")
+	}
+
+	return version, params, salt, key, nil
 }
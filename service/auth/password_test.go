@@ -1,11 +1,16 @@
 package auth
 
 import (
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+var testParams = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
 func TestHashPassword(t *testing.T) {
-	hash, err := HashPassword("password")
+	hash, err := NewHasher(testParams).Hash("password")
 
 	if err != nil {
 		t.Errorf("error hashing password: %v", err)
@@ -18,4 +23,62 @@ func TestHashPassword(t *testing.T) {
 	if hash == "password" {
 		t.Error("expected hash to be different from password")
 	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("expected a PHC argon2id hash and got %q", hash)
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hasher := NewHasher(testParams)
+
+	t.Run("should verify an argon2id hash", func(t *testing.T) {
+		hash, _ := hasher.Hash("password")
+
+		ok, needsRehash := hasher.Verify(hash, "password")
+		if !ok || needsRehash {
+			t.Errorf("expected a match without rehash and got ok=%v needsRehash=%v", ok, needsRehash)
+		}
+
+		if ok, _ := hasher.Verify(hash, "wrong password"); ok {
+			t.Error("expected a wrong password not to match")
+		}
+	})
+
+	t.Run("should not truncate long passwords", func(t *testing.T) {
+		long := strings.Repeat("a", 100)
+		hash, _ := hasher.Hash(long)
+
+		if ok, _ := hasher.Verify(hash, long[:72]); ok {
+			t.Error("expected a truncated password not to match")
+		}
+	})
+
+	t.Run("should ask for a rehash when the parameters changed", func(t *testing.T) {
+		hash, _ := NewHasher(Argon2Params{Memory: 512, Iterations: 1, Parallelism: 1}).Hash("password")
+
+		ok, needsRehash := hasher.Verify(hash, "password")
+		if !ok || !needsRehash {
+			t.Errorf("expected a match with rehash and got ok=%v needsRehash=%v", ok, needsRehash)
+		}
+	})
+
+	t.Run("should verify a legacy bcrypt hash and ask for a rehash", func(t *testing.T) {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+		ok, needsRehash := hasher.Verify(string(hash), "password")
+		if !ok || !needsRehash {
+			t.Errorf("expected a match with rehash and got ok=%v needsRehash=%v", ok, needsRehash)
+		}
+
+		if ok, _ := hasher.Verify(string(hash), "wrong password"); ok {
+			t.Error("expected a wrong password not to match")
+		}
+	})
+
+	t.Run("should reject a malformed hash", func(t *testing.T) {
+		if ok, _ := hasher.Verify("$argon2id$v=19$garbage", "password"); ok {
+			t.Error("expected a malformed hash not to match")
+		}
+	})
 }
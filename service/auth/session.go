@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+const (
+	// SessionCookie asks `/login` to set the JWT as a cookie instead of returning it, for browser clients.
+	SessionCookie = "cookie"
+
+	SessionCookieName = "session"
+	// CSRFCookieName holds the CSRF token, readable by the frontend so it can echo it in `CSRFHeader`.
+	CSRFCookieName = "csrf_token"
+	CSRFHeader     = "X-CSRF-Token"
+)
+
+var errInvalidCSRFToken = fmt.Errorf("missing or invalid CSRF token")
+
+// SetSessionCookies sets the JWT as an HttpOnly cookie, along with a new CSRF token which mutating
+// requests must send back in the `X-CSRF-Token` header. It returns the CSRF token.
+func SetSessionCookies(w http.ResponseWriter, jwtToken string) (string, error) {
+	csrfToken, _, err := token.New()
+	if err != nil {
+		return "", err
+	}
+
+	maxAge := int(config.Envs.JWTExpirationInSeconds)
+	http.SetCookie(w, newSessionCookie(SessionCookieName, jwtToken, maxAge, true))
+	http.SetCookie(w, newSessionCookie(CSRFCookieName, csrfToken, maxAge, false))
+
+	return csrfToken, nil
+}
+
+// ClearSessionCookies signs a browser client out.
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, newSessionCookie(SessionCookieName, "", -1, true))
+	http.SetCookie(w, newSessionCookie(CSRFCookieName, "", -1, false))
+}
+
+// IsCookieSession returns whether the request was authenticated with the session cookie rather
+// than a header, e.g. to refresh the cookie when issuing a new token.
+func IsCookieSession(ctx context.Context) bool {
+	fromCookie, _ := ctx.Value(CookieSessionKey).(bool)
+	return fromCookie
+}
+
+func newSessionCookie(name string, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Expires:  time.Now().Add(time.Duration(maxAge) * time.Second),
+		HttpOnly: httpOnly,
+		Secure:   config.Envs.SessionCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// tokenFromRequest returns the JWT of the headers, falling back to the session cookie.
+func tokenFromRequest(r *http.Request) (string, bool) {
+	if tokenStr := utils.GetTokenFromRequest(r); tokenStr != "" {
+		return tokenStr, false
+	}
+
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// checkCSRF guards requests authenticated by cookie, which the browser sends along with forged
+// requests too, with the double-submit pattern: another site can't read the CSRF cookie to echo it.
+func checkCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	cookie, err := r.Cookie(CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return errInvalidCSRFToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(CSRFHeader))) != 1 {
+		return errInvalidCSRFToken
+	}
+	return nil
+}
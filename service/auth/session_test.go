@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestCookieSession(t *testing.T) {
+	jwtToken, err := CreateJWTToken([]byte(config.Envs.JWTSecret), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	csrfToken, err := SetSessionCookies(rr, jwtToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rr.Result().Cookies()
+	for _, cookie := range cookies {
+		if cookie.HttpOnly != (cookie.Name == SessionCookieName) || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("expected only the session cookie to be HttpOnly and both to be SameSite, but got %+v", cookie)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		csrfHeader    string
+		authorization string
+		wantStatus    int
+		wantCookie    bool
+	}{
+		{
+			name:       "should authenticate a safe request with the cookie",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantCookie: true,
+		},
+		{
+			name:       "should authenticate a mutating request with the CSRF token",
+			method:     http.MethodPost,
+			csrfHeader: csrfToken,
+			wantStatus: http.StatusOK,
+			wantCookie: true,
+		},
+		{
+			name:       "should deny a mutating request without the CSRF token",
+			method:     http.MethodPost,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should deny a mutating request with another CSRF token",
+			method:     http.MethodPost,
+			csrfHeader: "forged",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:          "should not need a CSRF token with the Authorization header",
+			method:        http.MethodPost,
+			authorization: "Bearer " + jwtToken,
+			wantStatus:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+				if IsCookieSession(r.Context()) != tt.wantCookie {
+					t.Errorf("expected the cookie session to be %v", tt.wantCookie)
+				}
+			}, &mockUserStore{user: &types.User{ID: 1}})
+
+			req, _ := http.NewRequest(tt.method, "/some-endpoint", nil)
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(CSRFHeader, tt.csrfHeader)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status code %d and got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
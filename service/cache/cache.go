@@ -0,0 +1,11 @@
+// Package cache holds the caches stores are wrapped with. Values are encoded, so a cache shared
+// between instances, e.g. Redis, can implement `Cache` like the in-process LRU does.
+package cache
+
+// Cache stores encoded values by key. Implementations must be safe for concurrent use and may
+// drop entries at any time, e.g. when they expire or to make room.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(keys ...string)
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Group runs a single load per key at a time: callers asking for a key being loaded wait for
+// that load and share its result, so a miss on a popular key doesn't stampede the database.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+	// waiters is the number of callers waiting for the load, returned to the one running it.
+	waiters int
+}
+
+// Do runs load unless a load of the key is in flight, and returns the result of the load. The
+// caller running the load also gets the number of callers which waited for it, the others zero.
+func (g *Group) Do(key string, load func() ([]byte, error)) (value []byte, waiters int, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		g.mu.Unlock()
+		<-c.done
+		return c.value, 0, c.err
+	}
+
+	// The error stands until load returns, for the waiters to get one if it panics.
+	c := &call{done: make(chan struct{}), err: fmt.Errorf("load of %q panicked", key)}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		waiters = c.waiters
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = load()
+	return c.value, 0, c.err
+}
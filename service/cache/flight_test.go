@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	t.Run("should share a load between concurrent callers", func(t *testing.T) {
+		var g Group
+		release := make(chan struct{})
+		started := make(chan struct{})
+		results := make([]string, 10)
+		var shared int
+
+		var wg sync.WaitGroup
+		for i := range results {
+			load := func() ([]byte, error) {
+				t.Errorf("expected caller %d to wait for the first load", i)
+				return nil, nil
+			}
+			if i == 0 {
+				load = func() ([]byte, error) {
+					close(started)
+					<-release
+					return []byte("value"), nil
+				}
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, waiters, _ := g.Do("key", load)
+				results[i] = string(value)
+				if i == 0 {
+					shared = waiters
+				}
+			}()
+
+			if i == 0 {
+				<-started
+			}
+		}
+
+		for waiters(&g, "key") < len(results)-1 {
+			runtime.Gosched()
+		}
+		close(release)
+		wg.Wait()
+
+		for i, result := range results {
+			if result != "value" {
+				t.Errorf("expected caller %d to get the shared value and got %q", i, result)
+			}
+		}
+		if shared != len(results)-1 {
+			t.Errorf("expected the first caller to be told %d callers waited and got %d", len(results)-1, shared)
+		}
+	})
+
+	t.Run("should not keep a panicking load in flight", func(t *testing.T) {
+		var g Group
+		func() {
+			defer func() { recover() }()
+			g.Do("key", func() ([]byte, error) { panic("boom") })
+		}()
+
+		value, _, err := g.Do("key", func() ([]byte, error) { return []byte("value"), nil })
+		if err != nil || string(value) != "value" {
+			t.Errorf("expected a new load after the panic and got %q, %v", value, err)
+		}
+	})
+}
+
+func waiters(g *Group, key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.calls[key]; ok {
+		return c.waiters
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("should evict the least recently used entry", func(t *testing.T) {
+		c := NewLRU(2, time.Minute)
+		c.Set("a", []byte("1"))
+		c.Set("b", []byte("2"))
+		c.Get("a")
+		c.Set("c", []byte("3"))
+
+		if _, ok := c.Get("b"); ok {
+			t.Errorf("expected b to be evicted")
+		}
+		for _, key := range []string{"a", "c"} {
+			if _, ok := c.Get(key); !ok {
+				t.Errorf("expected %s to be cached", key)
+			}
+		}
+		if c.Len() != 2 {
+			t.Errorf("expected 2 entries and got %d", c.Len())
+		}
+	})
+
+	t.Run("should expire entries after the TTL", func(t *testing.T) {
+		now := time.Date(2024, 8, 30, 9, 0, 0, 0, time.UTC)
+		c := NewLRU(10, time.Minute)
+		c.now = func() time.Time { return now }
+		c.Set("a", []byte("1"))
+
+		now = now.Add(59 * time.Second)
+		if _, ok := c.Get("a"); !ok {
+			t.Errorf("expected a to be cached before the TTL")
+		}
+
+		now = now.Add(time.Second)
+		if _, ok := c.Get("a"); ok {
+			t.Errorf("expected a to expire after the TTL")
+		}
+		if c.Len() != 0 {
+			t.Errorf("expected the expired entry to be removed, got %d entries", c.Len())
+		}
+	})
+
+	t.Run("should replace and delete entries", func(t *testing.T) {
+		c := NewLRU(10, time.Minute)
+		c.Set("a", []byte("1"))
+		c.Set("a", []byte("2"))
+
+		if value, _ := c.Get("a"); string(value) != "2" {
+			t.Errorf("expected the replaced value and got %q", value)
+		}
+
+		c.Delete("a", "missing")
+		if _, ok := c.Get("a"); ok {
+			t.Errorf("expected a to be deleted")
+		}
+	})
+}
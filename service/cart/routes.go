@@ -4,68 +4,87 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
 	"github.com/sebastian-nunez/golang-store-api/service/auth"
 	"github.com/sebastian-nunez/golang-store-api/types"
 	"github.com/sebastian-nunez/golang-store-api/utils"
 )
 
+// ActionOrderCreated records a checkout, along with the stock it took.
+const ActionOrderCreated = "order.created"
+
 type Handler struct {
 	store      types.ProductStore
 	orderStore types.OrderStore
 	userStore  types.UserStore
+	// requireVerifiedEmail rejects the checkout of users who haven't verified their email yet.
+	requireVerifiedEmail bool
 }
 
 func NewHandler(
 	store types.ProductStore,
 	orderStore types.OrderStore,
 	userStore types.UserStore,
+	requireVerifiedEmail bool,
 ) *Handler {
 	return &Handler{
-		store:      store,
-		orderStore: orderStore,
-		userStore:  userStore,
+		store:                store,
+		orderStore:           orderStore,
+		userStore:            userStore,
+		requireVerifiedEmail: requireVerifiedEmail,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc(
 		"/cart/checkout",
-		auth.WithJWTAuth(h.handleCheckout, h.userStore),
+		auth.WithJWTAuth(auth.DenyImpersonation(h.handleCheckout), h.userStore),
 	).Methods(http.MethodPost)
 }
 
 func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 
+	if h.requireVerifiedEmail {
+		user, err := h.userStore.GetUserByID(userID)
+		if err != nil {
+			utils.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if user.EmailVerifiedAt == nil {
+			utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("please verify your email before checking out"))
+			return
+		}
+	}
+
 	var cart types.CartCheckoutRequest
 	if err := utils.ParseJson(r, &cart); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := utils.Validate.Struct(cart); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		utils.WriteValidationError(w, r, err)
 		return
 	}
 
 	productIds, err := getCartItemsIDs(cart.Items)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	products, err := h.store.GetProductsByID(productIds)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	orderID, totalPrice, err := h.createOrder(products, cart.Items, userID)
+	orderID, totalPrice, err := h.createOrder(products, cart.Items, userID, audit.FromRequest(r, ActionOrderCreated))
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
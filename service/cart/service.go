@@ -1,6 +1,7 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/sebastian-nunez/golang-store-api/types"
@@ -49,7 +50,15 @@ func calculateTotalPrice(cartItems []types.CartCheckoutItem, products map[int]ty
 	return total
 }
 
-func (h *Handler) createOrder(products []types.Product, cartItems []types.CartCheckoutItem, userID int) (int, float64, error) {
+// stockCache is implemented by product stores which cache the stock, e.g. `product.CachedStore`.
+// Orders take their items out of stock without going through the product store.
+type stockCache interface {
+	InvalidateStock(productIDs ...int)
+}
+
+// createOrder takes the items out of stock and creates the order in one transaction. The stock
+// checked beforehand may be stale, the order store has the final say.
+func (h *Handler) createOrder(products []types.Product, cartItems []types.CartCheckoutItem, userID int, event types.AuditEvent) (int, float64, error) {
 	productsMap := make(map[int]types.Product)
 	for _, product := range products {
 		productsMap[product.ID] = product
@@ -61,10 +70,15 @@ func (h *Handler) createOrder(products []types.Product, cartItems []types.CartCh
 
 	totalPrice := calculateTotalPrice(cartItems, productsMap)
 
-	for _, item := range cartItems {
-		product := productsMap[item.ProductID]
-		product.Quantity -= item.Quantity
-		h.store.UpdateProduct(product)
+	items := make([]types.OrderItem, len(cartItems))
+	productIDs := make([]int, len(cartItems))
+	for i, item := range cartItems {
+		items[i] = types.OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     productsMap[item.ProductID].Price,
+		}
+		productIDs[i] = item.ProductID
 	}
 
 	orderID, err := h.orderStore.CreateOrder(types.Order{
@@ -72,19 +86,18 @@ func (h *Handler) createOrder(products []types.Product, cartItems []types.CartCh
 		Total:   totalPrice,
 		Status:  "pending",
 		Address: "some address", // TODO(sebastian-nunez): fetch address from a user addresses table
-	})
+	}, items, event)
+	// Even a failed order invalidates, e.g. running out of stock shows the cached stock is outdated.
+	if cache, ok := h.store.(stockCache); ok {
+		cache.InvalidateStock(productIDs...)
+	}
 	if err != nil {
+		var stockErr *types.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			return 0, 0, fmt.Errorf("product %s is not available in the quantity requested", productsMap[stockErr.ProductID].Name)
+		}
 		return 0, 0, err
 	}
 
-	for _, item := range cartItems {
-		h.orderStore.CreateOrderItem(types.OrderItem{
-			OrderID:   orderID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     productsMap[item.ProductID].Price,
-		})
-	}
-
 	return orderID, totalPrice, nil
 }
@@ -0,0 +1,174 @@
+package lockout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+const (
+	ActionLocked   = "login.locked"
+	ActionUnlocked = "login.unlocked"
+)
+
+// Policy decides when logins are slowed down and locked.
+type Policy struct {
+	// MaxAccountFailures is the number of failed logins for an email before it is locked.
+	MaxAccountFailures int
+	// MaxIPFailures is the number of failed logins from an IP address before it is locked.
+	MaxIPFailures int
+	// Window is how long a failed login counts towards the limits.
+	Window          time.Duration
+	LockoutDuration time.Duration
+	// BaseDelay is the delay after the first failed login, doubled after every other failure.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Guard protects the login against brute-force attacks. Failures are tracked by email rather than
+// by user so unknown and existing accounts behave the same.
+type Guard struct {
+	store  types.LoginFailureStore
+	audit  types.AuditStore
+	policy Policy
+	now    func() time.Time
+}
+
+func NewGuard(store types.LoginFailureStore, audit types.AuditStore, policy Policy) *Guard {
+	return &Guard{
+		store:  store,
+		audit:  audit,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Check waits for the progressive delay of the account and returns whether its logins are locked,
+// either for the email or for the IP address.
+func (g *Guard) Check(ctx context.Context, email string, ip string) (bool, error) {
+	account, err := g.store.GetLoginFailure(EmailSubject(email))
+	if err != nil {
+		return false, err
+	}
+
+	client, err := g.store.GetLoginFailure(ipSubject(ip))
+	if err != nil {
+		return false, err
+	}
+
+	if err := sleep(ctx, g.delay(account)); err != nil {
+		return false, err
+	}
+
+	return g.isLocked(account) || g.isLocked(client), nil
+}
+
+// Fail records a failed login and locks the email or the IP address once they reach their limit.
+func (g *Guard) Fail(email string, ip string) error {
+	if err := g.fail(EmailSubject(email), "email_sha256", hashEmail(email), g.policy.MaxAccountFailures, ip); err != nil {
+		return err
+	}
+	return g.fail(ipSubject(ip), "ip", ip, g.policy.MaxIPFailures, ip)
+}
+
+// Succeed clears the failed logins of the email. Failures from the IP address are kept so an
+// attacker can't reset them by logging into their own account.
+func (g *Guard) Succeed(email string) error {
+	return g.store.ResetLoginFailures(EmailSubject(email))
+}
+
+// Unlock lifts the lockout of the user on behalf of an admin.
+func (g *Guard) Unlock(user types.User, actorID int, ip string) error {
+	if err := g.store.ResetLoginFailures(EmailSubject(user.Email)); err != nil {
+		return err
+	}
+
+	return g.audit.CreateAuditEvent(types.AuditEvent{
+		ActorID:    &actorID,
+		Action:     ActionUnlocked,
+		EntityType: "user",
+		EntityID:   strconv.Itoa(user.ID),
+		IP:         ip,
+	})
+}
+
+func (g *Guard) fail(subject string, entityType string, entityID string, maxFailures int, ip string) error {
+	failure, err := g.store.IncrementLoginFailures(subject, g.policy.Window)
+	if err != nil {
+		return err
+	}
+
+	if failure.Failures < maxFailures {
+		return nil
+	}
+
+	if err := g.store.LockLogin(subject, g.now().Add(g.policy.LockoutDuration)); err != nil {
+		return err
+	}
+
+	log.Printf("lockout: locked logins for %s after %d failures", subject, failure.Failures)
+	return g.audit.CreateAuditEvent(types.AuditEvent{
+		Action:     ActionLocked,
+		EntityType: entityType,
+		EntityID:   entityID,
+		IP:         ip,
+	})
+}
+
+func (g *Guard) isLocked(failure *types.LoginFailure) bool {
+	return failure.LockedUntil != nil && g.now().Before(*failure.LockedUntil)
+}
+
+// delay doubles with every recent failure, up to the max delay.
+func (g *Guard) delay(failure *types.LoginFailure) time.Duration {
+	if failure.Failures == 0 || g.now().Sub(failure.LastFailureAt) > g.policy.Window {
+		return 0
+	}
+
+	delay := g.policy.BaseDelay
+	for i := 1; i < failure.Failures && delay < g.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, g.policy.MaxDelay)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// EmailSubject identifies the failed logins of an email by its hash, so neither they nor the
+// lockout events keep the email around, e.g. after the account is deleted.
+func EmailSubject(email string) string {
+	return "email:" + hashEmail(email)
+}
+
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(normalize(email)))
+	return hex.EncodeToString(sum[:])
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+func normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
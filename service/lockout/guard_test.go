@@ -0,0 +1,190 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+const ip = "203.0.113.7"
+
+func TestGuard(t *testing.T) {
+	t.Parallel()
+
+	policy := Policy{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      5,
+		Window:             time.Minute,
+		LockoutDuration:    time.Minute,
+	}
+
+	t.Run("should lock the account after too many failures and record it", func(t *testing.T) {
+		audit := &mockAuditStore{}
+		guard := NewGuard(newMockStore(), audit, policy)
+
+		for i := 0; i < 3; i++ {
+			if err := guard.Fail("User@Google.com", ip); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		locked, err := guard.Check(context.Background(), "user@google.com", ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !locked {
+			t.Error("expected the account to be locked")
+		}
+
+		if len(audit.events) != 1 || audit.events[0].Action != ActionLocked || audit.events[0].EntityID != hashEmail("user@google.com") {
+			t.Errorf("expected a single lockout event for the email and got %+v", audit.events)
+		}
+	})
+
+	t.Run("should lock every account from an IP address after too many failures", func(t *testing.T) {
+		guard := NewGuard(newMockStore(), &mockAuditStore{}, policy)
+
+		for i := 0; i < 5; i++ {
+			guard.Fail("user"+string(rune('a'+i))+"@google.com", ip)
+		}
+
+		locked, _ := guard.Check(context.Background(), "other@google.com", ip)
+		if !locked {
+			t.Error("expected the IP address to be locked")
+		}
+
+		locked, _ = guard.Check(context.Background(), "other@google.com", "198.51.100.1")
+		if locked {
+			t.Error("expected other IP addresses to be allowed")
+		}
+	})
+
+	t.Run("should unlock once the lockout expires", func(t *testing.T) {
+		now := time.Now()
+		guard := NewGuard(newMockStore(), &mockAuditStore{}, policy)
+		guard.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			guard.Fail("user@google.com", ip)
+		}
+
+		now = now.Add(policy.LockoutDuration + time.Second)
+		locked, _ := guard.Check(context.Background(), "user@google.com", ip)
+		if locked {
+			t.Error("expected the lockout to have expired")
+		}
+	})
+
+	t.Run("should reset the account failures on success and on unlock", func(t *testing.T) {
+		audit := &mockAuditStore{}
+		store := newMockStore()
+		guard := NewGuard(store, audit, policy)
+
+		guard.Fail("user@google.com", ip)
+		guard.Succeed("user@google.com")
+		if failure, _ := store.GetLoginFailure(EmailSubject("user@google.com")); failure.Failures != 0 {
+			t.Errorf("expected failures to be reset on success and got %d", failure.Failures)
+		}
+		if failure, _ := store.GetLoginFailure("ip:" + ip); failure.Failures != 1 {
+			t.Errorf("expected IP failures to be kept and got %d", failure.Failures)
+		}
+
+		for i := 0; i < 3; i++ {
+			guard.Fail("user@google.com", ip)
+		}
+		if err := guard.Unlock(types.User{ID: 1, Email: "user@google.com"}, 2, ip); err != nil {
+			t.Fatal(err)
+		}
+
+		locked, _ := guard.Check(context.Background(), "user@google.com", ip)
+		if locked {
+			t.Error("expected the account to be unlocked")
+		}
+
+		last := audit.events[len(audit.events)-1]
+		if last.Action != ActionUnlocked || *last.ActorID != 2 || last.EntityID != "1" {
+			t.Errorf("expected an unlock event by the admin and got %+v", last)
+		}
+	})
+
+	t.Run("should double the delay after every failure up to the max", func(t *testing.T) {
+		now := time.Now()
+		guard := NewGuard(newMockStore(), &mockAuditStore{}, Policy{
+			Window:    time.Minute,
+			BaseDelay: 100 * time.Millisecond,
+			MaxDelay:  time.Second,
+		})
+		guard.now = func() time.Time { return now }
+
+		tests := []struct {
+			failures int
+			want     time.Duration
+		}{
+			{failures: 0, want: 0},
+			{failures: 1, want: 100 * time.Millisecond},
+			{failures: 3, want: 400 * time.Millisecond},
+			{failures: 10, want: time.Second},
+		}
+
+		for _, tt := range tests {
+			got := guard.delay(&types.LoginFailure{Failures: tt.failures, LastFailureAt: now})
+			if got != tt.want {
+				t.Errorf("expected a delay of %v after %d failures and got %v", tt.want, tt.failures, got)
+			}
+		}
+
+		expired := guard.delay(&types.LoginFailure{Failures: 3, LastFailureAt: now.Add(-2 * time.Minute)})
+		if expired != 0 {
+			t.Errorf("expected no delay once the failures are outside the window and got %v", expired)
+		}
+	})
+}
+
+type mockStore struct {
+	failures map[string]types.LoginFailure
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{failures: make(map[string]types.LoginFailure)}
+}
+
+func (m *mockStore) GetLoginFailure(subject string) (*types.LoginFailure, error) {
+	failure, ok := m.failures[subject]
+	if !ok {
+		failure = types.LoginFailure{Subject: subject}
+	}
+	return &failure, nil
+}
+
+func (m *mockStore) IncrementLoginFailures(subject string, window time.Duration) (*types.LoginFailure, error) {
+	failure := m.failures[subject]
+	failure.Subject = subject
+	failure.Failures++
+	failure.LastFailureAt = time.Now()
+	m.failures[subject] = failure
+	return &failure, nil
+}
+
+func (m *mockStore) LockLogin(subject string, until time.Time) error {
+	failure := m.failures[subject]
+	failure.LockedUntil = &until
+	m.failures[subject] = failure
+	return nil
+}
+
+func (m *mockStore) ResetLoginFailures(subject string) error {
+	delete(m.failures, subject)
+	return nil
+}
+
+type mockAuditStore struct {
+	types.AuditStore
+	events []types.AuditEvent
+}
+
+func (m *mockAuditStore) CreateAuditEvent(event types.AuditEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
@@ -0,0 +1,91 @@
+package lockout
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+type Store struct {
+	db *db.DB
+}
+
+func NewStore(db *db.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetLoginFailure(subject string) (*types.LoginFailure, error) {
+	rows, err := s.db.Query("SELECT * FROM login_failures WHERE subject = ?", subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failure := &types.LoginFailure{Subject: subject}
+	for rows.Next() {
+		failure, err = scanRowsIntoLoginFailure(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return failure, nil
+}
+
+func (s *Store) IncrementLoginFailures(subject string, window time.Duration) (*types.LoginFailure, error) {
+	now := time.Now()
+
+	// `failures` is assigned first, so it still sees the previous `lastFailureAt` on MySQL, which
+	// applies the assignments in order.
+	dialect := s.db.Dialect()
+	query := fmt.Sprintf(
+		`INSERT INTO login_failures (subject, failures, lastFailureAt) VALUES (?, 1, ?)
+		%s failures = CASE WHEN login_failures.lastFailureAt < ? THEN 1 ELSE login_failures.failures + 1 END, lastFailureAt = %s`,
+		dialect.OnConflictUpdate("subject"),
+		dialect.Excluded("lastFailureAt"),
+	)
+	_, err := s.db.Exec(
+		query,
+		subject,
+		now,
+		now.Add(-window),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetLoginFailure(subject)
+}
+
+func (s *Store) LockLogin(subject string, until time.Time) error {
+	_, err := s.db.Exec("UPDATE login_failures SET lockedUntil = ? WHERE subject = ?", until, subject)
+	return err
+}
+
+func (s *Store) ResetLoginFailures(subject string) error {
+	_, err := s.db.Exec("DELETE FROM login_failures WHERE subject = ?", subject)
+	return err
+}
+
+func scanRowsIntoLoginFailure(rows *sql.Rows) (*types.LoginFailure, error) {
+	failure := new(types.LoginFailure)
+	var lockedUntil sql.NullTime
+	err := rows.Scan(
+		&failure.Subject,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&lockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lockedUntil.Valid {
+		failure.LockedUntil = &lockedUntil.Time
+	}
+
+	return failure, nil
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// format renders the message as a RFC 5322 email.
+func (msg Message) format(from string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", sanitize(from))
+	fmt.Fprintf(&b, "To: %s\r\n", sanitize(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", sanitize(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// sanitize prevents header injection through user provided values.
+func sanitize(header string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(header)
+}
@@ -0,0 +1,95 @@
+package mail
+
+import (
+	"bytes"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewWriterMailer(&buf, "store@example.com")
+
+	err := mailer.Send(Message{
+		To:      "user@example.com",
+		Subject: "Hello\r\nBcc: attacker@example.com",
+		Body:    "Some body",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "To: user@example.com\r\n") || !strings.Contains(out, "Some body") {
+		t.Errorf("expected the message to be written and got %q", out)
+	}
+	if strings.Contains(out, "\r\nBcc:") {
+		t.Errorf("expected headers to be sanitized and got %q", out)
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := startSMTPServer(t)
+	mailer := NewSMTPMailer(addr, "", "", "store@example.com")
+
+	err := mailer.Send(Message{To: "user@example.com", Subject: "Verify your email", Body: "Some body"})
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	data := <-received
+	if !strings.Contains(data, "Subject: Verify your email") || !strings.Contains(data, "Some body") {
+		t.Errorf("expected the server to receive the message and got %q", data)
+	}
+}
+
+// startSMTPServer runs a minimal SMTP server which accepts a single message.
+func startSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 localhost")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				lines, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				received <- strings.Join(lines, "\n")
+				tp.PrintfLine("250 ok")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), received
+}
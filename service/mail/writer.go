@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"io"
+	"sync"
+)
+
+// WriterMailer writes the emails to a file or stdout instead of sending them. Meant for local development.
+type WriterMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{w: w, from: from}
+}
+
+func (m *WriterMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.w.Write(msg.format(m.from)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.w, "\r\n")
+	return err
+}
@@ -0,0 +1,73 @@
+// Package memory implements the user, product and order stores in process memory, e.g. for
+// tests. It enforces the constraints of the SQL schema, so code which works against it works
+// against the database too.
+package memory
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// DB holds the tables shared by the stores, so they can check foreign keys across each other.
+// A single lock makes every store method atomic, like a transaction.
+type DB struct {
+	mu         sync.RWMutex
+	users      map[int]types.User
+	products   map[int]types.Product
+	orders     map[int]types.Order
+	orderItems map[int]types.OrderItem
+	events     []types.AuditEvent
+	lastID     map[string]int
+	now        func() time.Time
+}
+
+func NewDB() *DB {
+	return &DB{
+		users:      make(map[int]types.User),
+		products:   make(map[int]types.Product),
+		orders:     make(map[int]types.Order),
+		orderItems: make(map[int]types.OrderItem),
+		lastID:     make(map[string]int),
+		now:        time.Now,
+	}
+}
+
+// AuditEvents returns the events recorded by the stores, oldest first.
+func (db *DB) AuditEvents() []types.AuditEvent {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return slices.Clone(db.events)
+}
+
+// nextID returns the next ID of the table, like an auto-increment column. Must be called with
+// the lock held.
+func (db *DB) nextID(table string) int {
+	db.lastID[table]++
+	return db.lastID[table]
+}
+
+// record appends an audit event. Must be called with the lock held.
+func (db *DB) record(event types.AuditEvent) {
+	event.ID = db.nextID("audit_events")
+	event.CreatedAt = db.now()
+	db.events = append(db.events, event)
+}
+
+// sortedByID returns the rows of a table ordered by ID.
+func sortedByID[T any](rows map[int]T) []T {
+	ids := make([]int, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	sorted := make([]T, 0, len(ids))
+	for _, id := range ids {
+		sorted = append(sorted, rows[id])
+	}
+	return sorted
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestAuditEvents(t *testing.T) {
+	db := NewDB()
+	products := NewProductStore(db)
+
+	id, err := products.CreateProduct(types.CreateProductRequest{Name: "Jordans", Price: 109.99, Quantity: 5}, types.AuditEvent{Action: "product.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := products.AdjustStock([]types.StockChange{{ProductID: id, Delta: -2}}, types.AuditEvent{Action: "order.created"}); err != nil {
+		t.Fatal(err)
+	}
+	products.AdjustStock([]types.StockChange{{ProductID: id, Delta: -9}}, types.AuditEvent{Action: "order.created"})
+
+	events := db.AuditEvents()
+	if len(events) != 2 {
+		t.Fatalf("expected an event per successful change, but got %+v", events)
+	}
+	if events[1].Action != "order.created" || events[1].EntityID != "1" || string(events[1].After) != `{"quantity":3}` {
+		t.Errorf("expected the stock change to be recorded, but got %+v", events[1])
+	}
+}
+
+func TestReturnsCopies(t *testing.T) {
+	db := NewDB()
+	users := NewUserStore(db)
+
+	id, err := users.CreateUser(types.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}, types.AuditEvent{Action: "user.registered"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := users.GetUserByID(id)
+	user.Email = "changed@example.com"
+
+	if stored, _ := users.GetUserByID(id); stored.Email != "ada@example.com" {
+		t.Errorf("expected the stored user to be unchanged, but got %s", stored.Email)
+	}
+}
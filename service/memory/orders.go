@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/product"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// orderStatuses are the values allowed by the `status` column of the orders.
+var orderStatuses = []string{"pending", "completed", "cancelled"}
+
+type OrderStore struct {
+	db *DB
+}
+
+func NewOrderStore(db *DB) *OrderStore {
+	return &OrderStore{db: db}
+}
+
+// CreateOrder checks the order and its items before taking anything out of stock, so a failing
+// order leaves the stock untouched.
+func (s *OrderStore) CreateOrder(order types.Order, items []types.OrderItem, event types.AuditEvent) (int, error) {
+	if !slices.Contains(orderStatuses, order.Status) {
+		return 0, fmt.Errorf("invalid order status %q", order.Status)
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[order.UserID]; !ok {
+		return 0, fmt.Errorf("user with id %d does not exist", order.UserID)
+	}
+
+	changes := make([]types.StockChange, len(items))
+	for i, item := range items {
+		if _, ok := s.db.products[item.ProductID]; !ok {
+			return 0, fmt.Errorf("product with id %d does not exist", item.ProductID)
+		}
+		changes[i] = types.StockChange{ProductID: item.ProductID, Delta: -item.Quantity}
+	}
+
+	// The address is personal data and stays out of the event.
+	orderEvent := event
+	var err error
+	orderEvent.Before, orderEvent.After, err = audit.Changes(nil, map[string]any{
+		"userId": order.UserID,
+		"total":  order.Total,
+		"status": order.Status,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	stockEvent := event
+	stockEvent.Action = product.ActionStockChanged
+	if err := s.db.adjustStock(changes, stockEvent); err != nil {
+		return 0, err
+	}
+
+	order.ID = s.db.nextID("orders")
+	order.CreatedAt = s.db.now()
+	s.db.orders[order.ID] = order
+
+	// Order items have no creation time of their own in SQL either.
+	for _, item := range items {
+		item.ID = s.db.nextID("order_items")
+		item.OrderID = order.ID
+		item.CreatedAt = time.Time{}
+		s.db.orderItems[item.ID] = item
+	}
+
+	orderEvent.EntityType = "order"
+	orderEvent.EntityID = strconv.Itoa(order.ID)
+	s.db.record(orderEvent)
+
+	return order.ID, nil
+}
+
+func (s *OrderStore) GetOrdersByUserID(userID int) ([]types.Order, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	orders := make([]types.Order, 0)
+	for _, order := range sortedByID(s.db.orders) {
+		if order.UserID == userID {
+			orders = append(orders, order)
+		}
+	}
+
+	return orders, nil
+}
+
+func (s *OrderStore) GetOrderItemsByUserID(userID int) ([]types.OrderItem, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	items := make([]types.OrderItem, 0)
+	for _, item := range sortedByID(s.db.orderItems) {
+		if s.db.orders[item.OrderID].UserID == userID {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
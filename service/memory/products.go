@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+type ProductStore struct {
+	db *DB
+}
+
+func NewProductStore(db *DB) *ProductStore {
+	return &ProductStore{db: db}
+}
+
+func (s *ProductStore) GetProducts() ([]types.Product, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	return sortedByID(s.db.products), nil
+}
+
+func (s *ProductStore) GetProductByID(id int) (*types.Product, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	product, ok := s.db.products[id]
+	if !ok {
+		return nil, &types.NotFoundError{EntityType: "product", ID: id}
+	}
+
+	return &product, nil
+}
+
+// GetProductsByID returns the products which exist, in the order of their IDs.
+func (s *ProductStore) GetProductsByID(productIDs []int) ([]types.Product, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	products := []types.Product{}
+	for _, product := range sortedByID(s.db.products) {
+		if slices.Contains(productIDs, product.ID) {
+			products = append(products, product)
+		}
+	}
+
+	return products, nil
+}
+
+func (s *ProductStore) CreateProduct(product types.CreateProductRequest, event types.AuditEvent) (int, error) {
+	if product.Quantity < 0 {
+		return 0, fmt.Errorf("quantity must not be negative")
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var err error
+	id := s.db.nextID("products")
+	event.EntityType = "product"
+	event.EntityID = strconv.Itoa(id)
+	if event.Before, event.After, err = audit.Changes(nil, product); err != nil {
+		return 0, err
+	}
+
+	now := s.db.now()
+	s.db.products[id] = types.Product{
+		ID:          id,
+		Name:        product.Name,
+		Description: product.Description,
+		Image:       product.Image,
+		Price:       product.Price,
+		Quantity:    product.Quantity,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Version:     1,
+	}
+	s.db.record(event)
+
+	return id, nil
+}
+
+func (s *ProductStore) UpdateProduct(product types.Product, event types.AuditEvent) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	before, ok := s.db.products[product.ID]
+	if !ok {
+		return &types.NotFoundError{EntityType: "product", ID: product.ID}
+	}
+	if before.Version != product.Version {
+		return &types.ConflictError{EntityType: "product", ID: product.ID}
+	}
+
+	// The stock and timestamps aren't set by the caller, so they're left out of the changes.
+	product.Quantity = before.Quantity
+	product.CreatedAt = before.CreatedAt
+	product.UpdatedAt = before.UpdatedAt
+	product.Version = before.Version + 1
+
+	var err error
+	event.EntityType = "product"
+	event.EntityID = strconv.Itoa(product.ID)
+	if event.Before, event.After, err = audit.Changes(before, product); err != nil {
+		return err
+	}
+
+	product.UpdatedAt = s.db.now()
+	s.db.products[product.ID] = product
+	s.db.record(event)
+
+	return nil
+}
+
+func (s *ProductStore) AdjustStock(changes []types.StockChange, event types.AuditEvent) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.adjustStock(changes, event)
+}
+
+// adjustStock checks every change before applying any of them, so a failing change leaves the
+// stock untouched. Must be called with the lock held.
+func (db *DB) adjustStock(changes []types.StockChange, event types.AuditEvent) error {
+	changes = slices.Clone(changes)
+	slices.SortStableFunc(changes, func(a, b types.StockChange) int {
+		return cmp.Compare(a.ProductID, b.ProductID)
+	})
+
+	adjusted := make(map[int]types.Product)
+	events := make([]types.AuditEvent, 0, len(changes))
+	for _, change := range changes {
+		if change.Delta == 0 {
+			continue
+		}
+
+		product, ok := adjusted[change.ProductID]
+		if !ok {
+			if product, ok = db.products[change.ProductID]; !ok {
+				return &types.NotFoundError{EntityType: "product", ID: change.ProductID}
+			}
+		}
+		if product.Quantity+change.Delta < 0 {
+			return &types.InsufficientStockError{ProductID: change.ProductID, Requested: -change.Delta}
+		}
+
+		var err error
+		event := event
+		event.EntityType = "product"
+		event.EntityID = strconv.Itoa(change.ProductID)
+		event.Before, event.After, err = audit.Changes(
+			map[string]int{"quantity": product.Quantity},
+			map[string]int{"quantity": product.Quantity + change.Delta},
+		)
+		if err != nil {
+			return err
+		}
+
+		product.Quantity += change.Delta
+		product.Version++
+		product.UpdatedAt = db.now()
+		adjusted[product.ID] = product
+		events = append(events, event)
+	}
+
+	for id, product := range adjusted {
+		db.products[id] = product
+	}
+	for _, event := range events {
+		db.record(event)
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package memory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+type UserStore struct {
+	db *DB
+}
+
+func NewUserStore(db *DB) *UserStore {
+	return &UserStore{db: db}
+}
+
+func (s *UserStore) GetUserByEmail(email string) (*types.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for _, user := range s.db.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *UserStore) GetUserByID(id int) (*types.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return &user, nil
+}
+
+// CreateUser only keeps the fields the SQL store inserts, the others start at their defaults.
+func (s *UserStore) CreateUser(user types.User, event types.AuditEvent) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.checkUniqueEmail(0, user.Email); err != nil {
+		return 0, err
+	}
+
+	id := s.db.nextID("users")
+	s.db.users[id] = types.User{
+		ID:        id,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Password:  user.Password,
+		CreatedAt: s.db.now(),
+		Role:      types.RoleCustomer,
+	}
+
+	if event.ActorID == nil {
+		event.ActorID = &id
+	}
+	s.db.record(userEvent(id, event))
+
+	return id, nil
+}
+
+// SearchUsers matches the query case-insensitively, like the default MySQL collation.
+func (s *UserStore) SearchUsers(search types.UserSearch) ([]types.User, int, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	query := strings.ToLower(search.Query)
+	matches := make([]types.User, 0)
+	for _, user := range sortedByID(s.db.users) {
+		name := strings.ToLower(user.FirstName + " " + user.LastName)
+		if strings.Contains(strings.ToLower(user.Email), query) || strings.Contains(name, query) {
+			matches = append(matches, user)
+		}
+	}
+
+	start := min(search.Offset, len(matches))
+	end := min(start+search.Limit, len(matches))
+	return matches[start:end], len(matches), nil
+}
+
+func (s *UserStore) SetEmailVerified(id int, verifiedAt time.Time, event types.AuditEvent) error {
+	return s.update(id, event, func(user *types.User) error {
+		user.EmailVerifiedAt = &verifiedAt
+		return nil
+	})
+}
+
+func (s *UserStore) UpdatePassword(id int, hashedPassword string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if user, ok := s.db.users[id]; ok {
+		user.Password = hashedPassword
+		s.db.users[id] = user
+	}
+
+	return nil
+}
+
+func (s *UserStore) ChangePassword(id int, hashedPassword string, revokedAt time.Time, event types.AuditEvent) error {
+	return s.update(id, event, func(user *types.User) error {
+		user.Password = hashedPassword
+		user.SessionsRevokedAt = &revokedAt
+		return nil
+	})
+}
+
+func (s *UserStore) UpdateProfile(id int, firstName string, lastName string, event types.AuditEvent) error {
+	return s.update(id, event, func(user *types.User) error {
+		user.FirstName = firstName
+		user.LastName = lastName
+		return nil
+	})
+}
+
+func (s *UserStore) UpdateEmail(id int, email string, event types.AuditEvent) error {
+	return s.update(id, event, func(user *types.User) error {
+		if err := s.checkUniqueEmail(id, email); err != nil {
+			return err
+		}
+		user.Email = email
+		user.EmailVerifiedAt = nil
+		return nil
+	})
+}
+
+// AnonymizeUser only changes the user, the tokens, recovery codes and API keys it also removes
+// in SQL aren't kept in memory.
+func (s *UserStore) AnonymizeUser(id int, deletedAt time.Time, event types.AuditEvent) error {
+	return s.update(id, event, func(user *types.User) error {
+		email := fmt.Sprintf("deleted-%d@deleted.invalid", id)
+		if err := s.checkUniqueEmail(id, email); err != nil {
+			return err
+		}
+
+		*user = types.User{
+			ID:                id,
+			FirstName:         "Deleted",
+			LastName:          "User",
+			Email:             email,
+			CreatedAt:         user.CreatedAt,
+			Role:              user.Role,
+			SessionsRevokedAt: &deletedAt,
+			DeletedAt:         &deletedAt,
+			DisabledAt:        user.DisabledAt,
+		}
+		return nil
+	})
+}
+
+func (s *UserStore) SetDisabled(id int, disabledAt *time.Time, event types.AuditEvent) error {
+	return s.update(id, event, func(user *types.User) error {
+		user.DisabledAt = disabledAt
+		return nil
+	})
+}
+
+func (s *UserStore) UpdateRole(id int, role string, event types.AuditEvent) error {
+	if role != types.RoleCustomer && role != types.RoleAdmin {
+		return fmt.Errorf("invalid role %q", role)
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return fmt.Errorf("user not found")
+	}
+
+	var err error
+	event.Before, event.After, err = audit.Changes(map[string]string{"role": user.Role}, map[string]string{"role": role})
+	if err != nil {
+		return err
+	}
+
+	user.Role = role
+	s.db.users[id] = user
+	s.db.record(userEvent(id, event))
+
+	return nil
+}
+
+// update applies the change to a copy of the user and keeps it, and records the event, unless the
+// change fails. Like an `UPDATE` matching no rows, a missing user isn't an error.
+func (s *UserStore) update(id int, event types.AuditEvent, change func(user *types.User) error) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil
+	}
+
+	if err := change(&user); err != nil {
+		return err
+	}
+	s.db.users[id] = user
+	s.db.record(userEvent(id, event))
+
+	return nil
+}
+
+// userEvent completes the event with the user.
+func userEvent(id int, event types.AuditEvent) types.AuditEvent {
+	event.EntityType = "user"
+	event.EntityID = strconv.Itoa(id)
+	return event
+}
+
+// checkUniqueEmail enforces the unique key on the email of the users other than id. Must be
+// called with the lock held.
+func (s *UserStore) checkUniqueEmail(id int, email string) error {
+	for _, user := range s.db.users {
+		if user.ID != id && user.Email == email {
+			return fmt.Errorf("a user with email %s already exists", email)
+		}
+	}
+	return nil
+}
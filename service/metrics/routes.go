@@ -0,0 +1,25 @@
+// Package metrics serves the counters the other packages publish with expvar, e.g. the panics
+// recovered by the middleware, along with the runtime stats expvar publishes itself.
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+type Handler struct {
+	userStore types.UserStore
+}
+
+func NewHandler(userStore types.UserStore) *Handler {
+	return &Handler{userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes.
+	router.HandleFunc("/admin/metrics", auth.WithAdminAuth(expvar.Handler().ServeHTTP, h.userStore, types.ScopeMetricsRead)).Methods(http.MethodGet)
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+// BodyLimiter caps the size of request bodies, per route.
+type BodyLimiter struct {
+	fallback int64
+	routes   map[string]int64
+}
+
+// NewBodyLimiter limits bodies to `fallback` bytes unless a route has its own limit.
+func NewBodyLimiter(fallback int64) *BodyLimiter {
+	return &BodyLimiter{
+		fallback: fallback,
+		routes:   make(map[string]int64),
+	}
+}
+
+// Route applies the limit, in bytes, to the given route path templates, e.g. `/api/v1/login`.
+func (l *BodyLimiter) Route(limit int64, pathTemplates ...string) {
+	for _, tpl := range pathTemplates {
+		l.routes[tpl] = limit
+	}
+}
+
+// Middleware limits the body of the matched route. Bodies announced as too large are rejected
+// right away, others fail with `413` once the handler reads past the limit. Meant to be
+// installed with `router.Use`.
+func (l *BodyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := l.limitFor(r)
+		if r.ContentLength > limit {
+			utils.WriteError(w, r, http.StatusRequestEntityTooLarge, fmt.Errorf("request body must not be larger than %d bytes", limit))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *BodyLimiter) limitFor(r *http.Request) int64 {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return l.fallback
+	}
+
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return l.fallback
+	}
+
+	if limit, ok := l.routes[tpl]; ok {
+		return limit
+	}
+	return l.fallback
+}
+
+// RequireJSON rejects requests with a body which isn't sent as `application/json` with `415`.
+func RequireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !isJSON(r.Header.Get("Content-Type")) {
+			utils.WriteError(w, r, http.StatusUnsupportedMediaType, fmt.Errorf("request body must be sent as application/json"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isJSON accepts `application/json`, with parameters such as `charset=utf-8`, and `+json` types.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+func TestBodyLimiter(t *testing.T) {
+	limiter := NewBodyLimiter(32)
+	limiter.Route(8, "/login")
+
+	router := mux.NewRouter()
+	router.Use(limiter.Middleware)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		if err := utils.ParseJson(r, &payload); err != nil {
+			utils.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	router.HandleFunc("/login", handler)
+	router.HandleFunc("/products", handler)
+
+	do := func(endpoint string, body io.Reader) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, endpoint, body)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should accept bodies under the limit", func(t *testing.T) {
+		rr := do("/products", strings.NewReader(`{"name":"mug"}`))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should apply the limit of the route", func(t *testing.T) {
+		rr := do("/login", strings.NewReader(`{"name":"mug"}`))
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status code %d and got %d", http.StatusRequestEntityTooLarge, rr.Code)
+		}
+	})
+
+	t.Run("should return 413 once a body of unknown length reads past the limit", func(t *testing.T) {
+		// Hiding the length from `http.NewRequest` leaves the check to `http.MaxBytesReader`.
+		body := io.MultiReader(strings.NewReader(`{"name":"` + strings.Repeat("a", 64) + `"}`))
+		rr := do("/products", body)
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status code %d and got %d", http.StatusRequestEntityTooLarge, rr.Code)
+		}
+	})
+}
+
+func TestRequireJSON(t *testing.T) {
+	handler := RequireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name        string
+		body        io.Reader
+		contentType string
+		expected    int
+	}{
+		{name: "json", body: strings.NewReader(`{}`), contentType: "application/json", expected: http.StatusOK},
+		{name: "json with charset", body: strings.NewReader(`{}`), contentType: "application/json; charset=utf-8", expected: http.StatusOK},
+		{name: "json suffix", body: strings.NewReader(`{}`), contentType: "application/merge-patch+json", expected: http.StatusOK},
+		{name: "no body", body: nil, contentType: "", expected: http.StatusOK},
+		{name: "form", body: strings.NewReader(`a=1`), contentType: "application/x-www-form-urlencoded", expected: http.StatusUnsupportedMediaType},
+		{name: "missing content type", body: strings.NewReader(`{}`), contentType: "", expected: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/products", tc.body)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expected {
+				t.Errorf("expected status code %d and got %d", tc.expected, rr.Code)
+			}
+		})
+	}
+}
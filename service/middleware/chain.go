@@ -0,0 +1,16 @@
+// Package middleware holds the HTTP middlewares wrapping the whole API, before the router matches
+// a route, e.g. CORS preflights must be answered even for routes registered without `OPTIONS`.
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler, e.g. `utils.RequestID`.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps the handler with the middlewares, the first one being the outermost.
+func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// encodings are the supported content codings, in order of preference.
+var encodings = []string{"br", "gzip"}
+
+var encoderPools = map[string]*sync.Pool{
+	"br": {New: func() any { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }},
+	"gzip": {New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return gz
+	}},
+}
+
+type encoder interface {
+	io.WriteCloser
+	Reset(io.Writer)
+	Flush() error
+}
+
+// Compress compresses JSON and text responses with brotli or gzip, as negotiated with the
+// `Accept-Encoding` header of the request. The ETag of a compressed response gets the coding as
+// a suffix, e.g. `"abc-gzip"`, since it is a different representation, and the suffix is removed
+// from the conditional headers of requests so handlers can compare them to their own ETags. A
+// `304 Not Modified` and the response to a HEAD request get the same ETag as the compressed GET
+// they stand for.
+//
+// Responses setting cookies are left alone, they may carry secrets next to reflected input.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		for _, header := range []string{"If-None-Match", "If-Match"} {
+			if value := r.Header.Get(header); value != "" {
+				r.Header.Set(header, stripETagSuffixes(value))
+			}
+		}
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, head: r.Method == http.MethodHead}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	// head is set for HEAD requests, which get the headers of a compressed response but no body.
+	head        bool
+	compressed  bool
+	encoder     encoder
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	switch {
+	case status == http.StatusNotModified:
+		w.suffixETag()
+	case compressible(status, h):
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		w.suffixETag()
+		w.compressed = true
+
+		if !w.head {
+			w.encoder = encoderPools[w.encoding].Get().(encoder)
+			w.encoder.Reset(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// suffixETag appends the coding to the ETag of the response, if any.
+func (w *compressWriter) suffixETag() {
+	if etag := w.Header().Get("ETag"); strings.HasSuffix(etag, `"`) {
+		w.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+w.encoding+`"`)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// The body a handler writes for a HEAD request is dropped before the server would take its
+	// uncompressed length as the Content-Length.
+	if w.compressed && w.head {
+		return len(b), nil
+	}
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.encoder.Write(b)
+}
+
+// Flush sends what was compressed so far, e.g. for streamed responses.
+func (w *compressWriter) Flush() {
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets `http.ResponseController` reach the underlying writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) close() {
+	if w.encoder == nil {
+		return
+	}
+
+	w.encoder.Close()
+	w.encoder.Reset(io.Discard)
+	encoderPools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+}
+
+func compressible(status int, h http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// negotiateEncoding returns the preferred supported coding of the `Accept-Encoding` header, or
+// an empty string for no compression.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		if q := qualityOf(header, encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// qualityOf returns the weight the `Accept-Encoding` header gives to the coding, directly or
+// through `*`. Codings which aren't listed get zero.
+func qualityOf(header string, encoding string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case encoding:
+			return q
+		case "*":
+			wildcard = q
+		}
+	}
+	return wildcard
+}
+
+// stripETagSuffixes removes the coding suffixes `Compress` adds to ETags.
+func stripETagSuffixes(header string) string {
+	for _, encoding := range encodings {
+		header = strings.ReplaceAll(header, "-"+encoding+`"`, `"`)
+	}
+	return header
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompress(t *testing.T) {
+	body := `{"products":"` + strings.Repeat("jordans ", 100) + `"}`
+	jsonHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		if r.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, body)
+	})
+
+	do := func(handler http.Handler, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/products", nil)
+		req.Header = header
+		rr := httptest.NewRecorder()
+		Compress(handler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should compress with gzip", func(t *testing.T) {
+		rr := do(jsonHandler, http.Header{"Accept-Encoding": {"gzip"}})
+
+		if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("expected Content-Encoding gzip and got %q", got)
+		}
+		gz, err := gzip.NewReader(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, _ := io.ReadAll(gz)
+		if string(decoded) != body {
+			t.Errorf("expected the body to round trip and got %q", decoded)
+		}
+		if got := rr.Header().Get("ETag"); got != `"abc-gzip"` {
+			t.Errorf("expected the ETag of the gzip representation and got %q", got)
+		}
+		if got := rr.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("expected Vary Accept-Encoding and got %q", got)
+		}
+	})
+
+	t.Run("should prefer brotli", func(t *testing.T) {
+		rr := do(jsonHandler, http.Header{"Accept-Encoding": {"gzip, deflate, br"}})
+
+		if got := rr.Header().Get("Content-Encoding"); got != "br" {
+			t.Fatalf("expected Content-Encoding br and got %q", got)
+		}
+		decoded, _ := io.ReadAll(brotli.NewReader(rr.Body))
+		if string(decoded) != body {
+			t.Errorf("expected the body to round trip and got %q", decoded)
+		}
+	})
+
+	t.Run("should honor the weights of the codings", func(t *testing.T) {
+		rr := do(jsonHandler, http.Header{"Accept-Encoding": {"br;q=0, gzip;q=0.5"}})
+
+		if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("expected Content-Encoding gzip and got %q", got)
+		}
+	})
+
+	t.Run("should not compress without a supported coding", func(t *testing.T) {
+		rr := do(jsonHandler, http.Header{"Accept-Encoding": {"deflate, *;q=0"}})
+
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no Content-Encoding and got %q", got)
+		}
+		if rr.Body.String() != body {
+			t.Errorf("expected the plain body and got %q", rr.Body.String())
+		}
+	})
+
+	t.Run("should strip the coding of the ETags sent back", func(t *testing.T) {
+		rr := do(jsonHandler, http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {`"abc-gzip"`}})
+
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("expected status code %d and got %d", http.StatusNotModified, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no Content-Encoding on a 304 and got %q", got)
+		}
+		if got := rr.Header().Get("ETag"); got != `"abc-gzip"` {
+			t.Errorf("expected the ETag of the gzip representation on a 304 and got %q", got)
+		}
+	})
+
+	t.Run("should answer a HEAD request with the headers of the compressed GET", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodHead, "/products", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rr := httptest.NewRecorder()
+		Compress(jsonHandler).ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("ETag"); got != `"abc-br"` {
+			t.Errorf("expected the ETag of the brotli representation and got %q", got)
+		}
+		if got := rr.Header().Get("Content-Encoding"); got != "br" {
+			t.Errorf("expected Content-Encoding br and got %q", got)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("expected no body and got %q", rr.Body.String())
+		}
+	})
+
+	t.Run("should not compress responses setting cookies", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "token"})
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, body)
+		})
+		rr := do(handler, http.Header{"Accept-Encoding": {"gzip"}})
+
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no Content-Encoding and got %q", got)
+		}
+	})
+
+	t.Run("should not compress binary responses", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, body)
+		})
+		rr := do(handler, http.Header{"Accept-Encoding": {"gzip"}})
+
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no Content-Encoding and got %q", got)
+		}
+	})
+}
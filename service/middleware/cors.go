@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSPolicy lists what browsers on other origins are allowed to do.
+type CORSPolicy struct {
+	// AllowedOrigins are matched exactly, e.g. `https://shop.example.com`. `*` allows any origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	// AllowCredentials is ignored along with `*`, which would let any site make requests with the
+	// cookies of the user.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response, in seconds.
+	MaxAge int
+}
+
+// CORS sets the CORS headers for allowed origins and answers their preflight requests. Requests
+// from other origins are passed through without the headers, so the browser blocks the response.
+func CORS(policy CORSPolicy) Middleware {
+	anyOrigin := slices.Contains(policy.AllowedOrigins, "*")
+	if anyOrigin && policy.AllowCredentials {
+		log.Printf("CORS: credentials are not allowed for any origin, list the origins which need them")
+		policy.AllowCredentials = false
+	}
+
+	allowedMethods := strings.Join(policy.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(policy.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(policy.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !(anyOrigin || slices.Contains(policy.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				if exposedHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			if policy.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
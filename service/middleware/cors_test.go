@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCORS(t *testing.T) {
+	newHandler := func(policy CORSPolicy) http.Handler {
+		router := mux.NewRouter()
+		router.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}).Methods(http.MethodPost)
+		return CORS(policy)(router)
+	}
+
+	policy := CORSPolicy{
+		AllowedOrigins: []string{"https://shop.example.com"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         600,
+	}
+
+	do := func(handler http.Handler, method string, origin string, requestMethod string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/products", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should answer preflight requests of allowed origins", func(t *testing.T) {
+		rr := do(newHandler(policy), http.MethodOptions, "https://shop.example.com", http.MethodPost)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d and got %d", http.StatusNoContent, rr.Code)
+		}
+		expected := map[string]string{
+			"Access-Control-Allow-Origin":  "https://shop.example.com",
+			"Access-Control-Allow-Methods": "GET, POST",
+			"Access-Control-Allow-Headers": "Authorization, Content-Type",
+			"Access-Control-Max-Age":       "600",
+		}
+		for header, value := range expected {
+			if got := rr.Header().Get(header); got != value {
+				t.Errorf("expected %s %q and got %q", header, value, got)
+			}
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("expected no Access-Control-Allow-Credentials and got %q", got)
+		}
+	})
+
+	t.Run("should set the headers on requests of allowed origins", func(t *testing.T) {
+		rr := do(newHandler(policy), http.MethodPost, "https://shop.example.com", "")
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d and got %d", http.StatusCreated, rr.Code)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://shop.example.com" {
+			t.Errorf("expected the origin to be allowed and got %q", got)
+		}
+		if got := rr.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID" {
+			t.Errorf("expected Access-Control-Expose-Headers X-Request-ID and got %q", got)
+		}
+		if got := rr.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("expected Vary Origin and got %q", got)
+		}
+	})
+
+	t.Run("should not allow other origins", func(t *testing.T) {
+		rr := do(newHandler(policy), http.MethodOptions, "https://evil.example.com", http.MethodPost)
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("expected no Access-Control-Allow-Origin and got %q", got)
+		}
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected the preflight to reach the router and got status code %d", rr.Code)
+		}
+	})
+
+	t.Run("should allow credentials for listed origins", func(t *testing.T) {
+		withCredentials := policy
+		withCredentials.AllowCredentials = true
+		rr := do(newHandler(withCredentials), http.MethodPost, "https://shop.example.com", "")
+
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("expected Access-Control-Allow-Credentials true and got %q", got)
+		}
+	})
+
+	t.Run("should ignore credentials with a wildcard", func(t *testing.T) {
+		rr := do(newHandler(CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}), http.MethodPost, "https://evil.example.com", "")
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("expected any origin to be allowed and got %q", got)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("expected no Access-Control-Allow-Credentials and got %q", got)
+		}
+	})
+
+	t.Run("should pass same-origin requests through", func(t *testing.T) {
+		rr := do(newHandler(policy), http.MethodPost, "", "")
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d and got %d", http.StatusCreated, rr.Code)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("expected no Access-Control-Allow-Origin and got %q", got)
+		}
+	})
+}
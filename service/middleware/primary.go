@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/sebastian-nunez/golang-store-api/db"
+)
+
+// ReadYourWrites sends the reads of a user to the primary database for a while after they wrote,
+// since the replicas may not have caught up with their write yet. Every request with an unsafe
+// method counts as a write, as do its own reads. keyFunc identifies the user of the request, or
+// returns "" for anonymous requests, which always read from the replicas.
+func ReadYourWrites(writes *db.RecentWrites, keyFunc func(r *http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			write := !isSafeMethod(r.Method)
+			if write || writes.Recent(key) {
+				r = r.WithContext(db.WithPrimary(r.Context()))
+			}
+
+			next.ServeHTTP(w, r)
+
+			// The window starts once the write committed, i.e. when the handler returns.
+			if write {
+				writes.Record(key)
+			}
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
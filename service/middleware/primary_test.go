@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/db"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	var usedPrimary bool
+	handler := ReadYourWrites(
+		db.NewRecentWrites(time.Minute),
+		func(r *http.Request) string { return r.Header.Get("X-User") },
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		usedPrimary = db.UsePrimary(r.Context())
+	}))
+
+	do := func(method string, user string) bool {
+		req, _ := http.NewRequest(method, "/products", nil)
+		req.Header.Set("X-User", user)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return usedPrimary
+	}
+
+	if do(http.MethodGet, "user:1") {
+		t.Error("expected a read before any write to use the replicas")
+	}
+	if !do(http.MethodPost, "user:1") {
+		t.Error("expected a write to use the primary")
+	}
+	if !do(http.MethodGet, "user:1") {
+		t.Error("expected a read right after a write to use the primary")
+	}
+	if do(http.MethodGet, "user:2") {
+		t.Error("expected the reads of another user to use the replicas")
+	}
+	if do(http.MethodPost, "") {
+		t.Error("expected anonymous requests to use the replicas")
+	}
+}
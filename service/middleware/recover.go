@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+// PanicsRecovered counts the panics caught by `Recover`, published as `http_panics_recovered`.
+var PanicsRecovered = expvar.NewInt("http_panics_recovered")
+
+// Recover turns a panic in a handler into a `500` problem response and logs its stack trace
+// with the request ID. When the response was already started, the connection is dropped as
+// net/http would, since the client can't tell a truncated body from a complete one otherwise.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recordingWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// Already a deliberate abort, net/http drops the connection without logging.
+				panic(err)
+			}
+
+			PanicsRecovered.Add(1)
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, utils.GetRequestID(r.Context()), err, debug.Stack())
+
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			utils.WriteError(w, r, http.StatusInternalServerError, fmt.Errorf("internal server error"))
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recordingWriter records whether the response was started.
+type recordingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets `http.ResponseController` reach the underlying writer, e.g. to flush.
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+func TestRecover(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	t.Run("should return a 500 problem and count the panic", func(t *testing.T) {
+		handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+
+		before := PanicsRecovered.Value()
+		req, _ := http.NewRequest(http.MethodGet, "/products", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code %d and got %d", http.StatusInternalServerError, rr.Code)
+		}
+		var problem utils.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if problem.Detail != "internal server error" {
+			t.Errorf("expected the panic not to leak, got %q", problem.Detail)
+		}
+		if got := PanicsRecovered.Value(); got != before+1 {
+			t.Errorf("expected the panic to be counted, got %d after %d", got, before)
+		}
+	})
+
+	t.Run("should abort a started response", func(t *testing.T) {
+		handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("boom")
+		}))
+
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Errorf("expected http.ErrAbortHandler and got %v", err)
+			}
+		}()
+
+		req, _ := http.NewRequest(http.MethodGet, "/products", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	do := func(hstsMaxAge int) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/products", nil)
+		rr := httptest.NewRecorder()
+		SecurityHeaders(hstsMaxAge)(ok).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should set the security headers", func(t *testing.T) {
+		rr := do(31536000)
+
+		expected := map[string]string{
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+			"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "no-referrer",
+		}
+		for header, value := range expected {
+			if got := rr.Header().Get(header); got != value {
+				t.Errorf("expected %s %q and got %q", header, value, got)
+			}
+		}
+	})
+
+	t.Run("should not set HSTS when disabled", func(t *testing.T) {
+		rr := do(0)
+
+		if got := rr.Header().Get("Strict-Transport-Security"); got != "" {
+			t.Errorf("expected no Strict-Transport-Security and got %q", got)
+		}
+	})
+}
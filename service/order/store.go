@@ -2,47 +2,141 @@ package order
 
 import (
 	"database/sql"
+	"strconv"
 
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/product"
 	"github.com/sebastian-nunez/golang-store-api/types"
 )
 
 type Store struct {
-	db *sql.DB
+	db *db.DB
 }
 
-func NewStore(db *sql.DB) *Store {
+func NewStore(db *db.DB) *Store {
 	return &Store{
 		db: db,
 	}
 }
 
-func (s *Store) CreateOrder(order types.Order) (int, error) {
-	res, err := s.db.Exec(
-		"INSERT INTO orders (userId, total, status, address) VALUES (?, ?, ?, ?)",
-		order.UserID,
-		order.Total,
-		order.Status,
-		order.Address,
-	)
+func (s *Store) CreateOrder(order types.Order, items []types.OrderItem, event types.AuditEvent) (int, error) {
+	changes := make([]types.StockChange, len(items))
+	for i, item := range items {
+		changes[i] = types.StockChange{ProductID: item.ProductID, Delta: -item.Quantity}
+	}
+
+	var id int
+	err := s.db.Transact(func(tx *db.Tx) error {
+		stockEvent := event
+		stockEvent.Action = product.ActionStockChanged
+		if err := product.AdjustStockTx(tx, changes, stockEvent); err != nil {
+			return err
+		}
+
+		inserted, err := tx.Insert(
+			"INSERT INTO orders (userId, total, status, address) VALUES (?, ?, ?, ?)",
+			order.UserID,
+			order.Total,
+			order.Status,
+			order.Address,
+		)
+		if err != nil {
+			return err
+		}
+		id = int(inserted)
+
+		for _, item := range items {
+			_, err := tx.Exec(
+				"INSERT INTO order_items (orderId, productId, quantity, price) VALUES (?, ?, ?, ?)",
+				id,
+				item.ProductID,
+				item.Quantity,
+				item.Price,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The address is personal data and stays out of the event.
+		orderEvent := event
+		orderEvent.EntityType = "order"
+		orderEvent.EntityID = strconv.Itoa(id)
+		orderEvent.Before, orderEvent.After, err = audit.Changes(nil, map[string]any{
+			"userId": order.UserID,
+			"total":  order.Total,
+			"status": order.Status,
+		})
+		if err != nil {
+			return err
+		}
+
+		return audit.Record(tx, orderEvent)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	id, err := res.LastInsertId()
+	return id, nil
+}
+
+func (s *Store) GetOrdersByUserID(userID int) ([]types.Order, error) {
+	rows, err := s.db.Query("SELECT * FROM orders WHERE userId = ? ORDER BY id", userID)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]types.Order, 0)
+	for rows.Next() {
+		order, err := scanRowsIntoOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
 	}
 
-	return int(id), nil
+	return orders, rows.Err()
 }
 
-func (s *Store) CreateOrderItem(orderItem types.OrderItem) error {
-	_, err := s.db.Exec(
-		"INSERT INTO order_items (orderId, productId, quantity, price) VALUES (?, ?, ?, ?)",
-		orderItem.OrderID,
-		orderItem.ProductID,
-		orderItem.Quantity,
-		orderItem.Price,
+func (s *Store) GetOrderItemsByUserID(userID int) ([]types.OrderItem, error) {
+	rows, err := s.db.Query(
+		`SELECT oi.id, oi.orderId, oi.productId, oi.quantity, oi.price FROM order_items oi
+		JOIN orders o ON o.id = oi.orderId WHERE o.userId = ? ORDER BY oi.id`,
+		userID,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]types.OrderItem, 0)
+	for rows.Next() {
+		var item types.OrderItem
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func scanRowsIntoOrder(rows *sql.Rows) (*types.Order, error) {
+	order := new(types.Order)
+	err := rows.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Total,
+		&order.Status,
+		&order.Address,
+		&order.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
 }
@@ -1,38 +1,115 @@
 package order
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sebastian-nunez/golang-store-api/db"
 	"github.com/sebastian-nunez/golang-store-api/types"
 )
 
 func TestCreateOrder(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("unable to stub db %s", err)
-	}
-	defer db.Close()
-
-	store := NewStore(db)
-
 	order := types.Order{
 		UserID:  1,
 		Total:   100.0,
 		Status:  "Pending",
 		Address: "123 Main St",
 	}
+	items := []types.OrderItem{{ProductID: 1, Quantity: 2, Price: 50.0}}
+
+	expectStock := func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+			WithArgs(2, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(3))
+		mock.ExpectExec("INSERT INTO audit_events").
+			WithArgs(nil, "product.stock_changed", "product", "1", "", "", `{"quantity":5}`, `{"quantity":3}`, "").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO orders").
+			WithArgs(order.UserID, order.Total, order.Status, order.Address).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	t.Run("should take the stock and create the order with its items", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("unable to stub db %s", err)
+		}
+		defer sqlDB.Close()
+
+		expectStock(mock)
+		mock.ExpectExec("INSERT INTO order_items").
+			WithArgs(1, 1, 2, 50.0).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO audit_events").
+			WithArgs(nil, "order.created", "order", "1", "", "", nil, `{"status":"Pending","total":100,"userId":1}`, "").
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		id, err := NewStore(db.New(sqlDB, db.MySQL)).CreateOrder(order, items, types.AuditEvent{Action: "order.created"})
+		if err != nil {
+			t.Errorf("expected no error, but got %v", err)
+		}
+		if id != 1 {
+			t.Errorf("expected id to be 1, but got %d", id)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("should roll back given an item that cannot be inserted", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("unable to stub db %s", err)
+		}
+		defer sqlDB.Close()
+
+		expectStock(mock)
+		mock.ExpectExec("INSERT INTO order_items").
+			WithArgs(1, 1, 2, 50.0).
+			WillReturnError(errors.New("foreign key constraint fails"))
+		mock.ExpectRollback()
 
-	mock.ExpectExec("INSERT INTO orders").
-		WithArgs(order.UserID, order.Total, order.Status, order.Address).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		if _, err := NewStore(db.New(sqlDB, db.MySQL)).CreateOrder(order, items, types.AuditEvent{Action: "order.created"}); err == nil {
+			t.Errorf("expected an error, but got none")
+		}
 
-	id, err := store.CreateOrder(order)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %v", err)
+		}
+	})
+}
+
+func TestGetOrdersByUserID(t *testing.T) {
+	t.Parallel()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to stub db %s", err)
+	}
+	defer sqlDB.Close()
+
+	store := NewStore(db.New(sqlDB, db.MySQL))
+
+	rows := sqlmock.NewRows([]string{"id", "userId", "total", "status", "address", "createdAt"}).
+		AddRow(1, 7, 100.0, "pending", "123 Main St", time.Now()).
+		AddRow(2, 7, 50.0, "completed", "456 Side St", time.Now())
+	mock.ExpectQuery("SELECT \\* FROM orders WHERE userId = \\?").
+		WithArgs(7).
+		WillReturnRows(rows)
+
+	orders, err := store.GetOrdersByUserID(7)
 	if err != nil {
 		t.Errorf("expected no error, but got %v", err)
 	}
-	if id != 1 {
-		t.Errorf("expected id to be 1, but got %d", id)
+	if len(orders) != 2 || orders[1].Address != "456 Side St" {
+		t.Errorf("expected the 2 orders of the user, but got %v", orders)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -40,31 +117,29 @@ func TestCreateOrder(t *testing.T) {
 	}
 }
 
-func TestCreateOrderItem(t *testing.T) {
+func TestGetOrderItemsByUserID(t *testing.T) {
 	t.Parallel()
-	db, mock, err := sqlmock.New()
+	sqlDB, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("unable to stub db %s", err)
 	}
-	defer db.Close()
+	defer sqlDB.Close()
 
-	store := NewStore(db)
+	store := NewStore(db.New(sqlDB, db.MySQL))
 
-	orderItem := types.OrderItem{
-		OrderID:   1,
-		ProductID: 1,
-		Quantity:  2,
-		Price:     50.0,
-	}
-
-	mock.ExpectExec("INSERT INTO order_items").
-		WithArgs(orderItem.OrderID, orderItem.ProductID, orderItem.Quantity, orderItem.Price).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	rows := sqlmock.NewRows([]string{"id", "orderId", "productId", "quantity", "price"}).
+		AddRow(1, 1, 3, 2, 25.0)
+	mock.ExpectQuery("SELECT (.+) FROM order_items oi JOIN orders o").
+		WithArgs(7).
+		WillReturnRows(rows)
 
-	err = store.CreateOrderItem(orderItem)
+	items, err := store.GetOrderItemsByUserID(7)
 	if err != nil {
 		t.Errorf("expected no error, but got %v", err)
 	}
+	if len(items) != 1 || items[0].ProductID != 3 {
+		t.Errorf("expected the item of the user, but got %v", items)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %v", err)
@@ -0,0 +1,80 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const prefixLength = 5
+
+//go:embed breached.txt
+var bundledBreachedList []byte
+
+// BreachedList is a set of SHA-1 password hashes in the k-anonymity format of the
+// Have I Been Pwned range API, indexed by their 5 character prefix. It is checked offline.
+type BreachedList struct {
+	suffixes map[string]map[string]struct{}
+}
+
+// BundledBreachedList returns the list of common breached passwords shipped with the API.
+func BundledBreachedList() *BreachedList {
+	list, err := ParseBreachedList(bytes.NewReader(bundledBreachedList))
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+// LoadBreachedList reads a breached password list from a file.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseBreachedList(f)
+}
+
+// ParseBreachedList reads one `<prefix>:<suffix>[:<count>]` hash per line. Empty lines and lines
+// starting with `#` are ignored.
+func ParseBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{suffixes: make(map[string]map[string]struct{})}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Split(line, ":")
+		if len(parts) < 2 || len(parts[0]) != prefixLength || len(parts[0])+len(parts[1]) != sha1.Size*2 {
+			return nil, fmt.Errorf("invalid breached password hash on line %d", n)
+		}
+
+		prefix, suffix := strings.ToUpper(parts[0]), strings.ToUpper(parts[1])
+		if list.suffixes[prefix] == nil {
+			list.suffixes[prefix] = make(map[string]struct{})
+		}
+		list.suffixes[prefix][suffix] = struct{}{}
+	}
+
+	return list, scanner.Err()
+}
+
+// Contains returns whether the password is in the list.
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, ok := l.suffixes[hash[:prefixLength]][hash[prefixLength:]]
+	return ok
+}
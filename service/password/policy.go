@@ -0,0 +1,66 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// minPersonalInfoLength keeps short names, e.g. "Al", from banning too many passwords.
+const minPersonalInfoLength = 3
+
+// Violation is a rule the password breaks.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Policy decides which passwords users may choose.
+type Policy struct {
+	MinLength int
+	// Breached is the list of known breached passwords. Nil disables the check.
+	Breached *BreachedList
+}
+
+// Check returns the rules the password breaks. When a user is given, the password must not
+// contain their email or name either.
+func (p Policy) Check(password string, user *types.User) []Violation {
+	var violations []Violation
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    "min",
+			Message: fmt.Sprintf("password must be at least %d characters in length", p.MinLength),
+		})
+	}
+
+	if user != nil && containsPersonalInfo(password, user) {
+		violations = append(violations, Violation{
+			Rule:    "personal_info",
+			Message: "password must not contain your email or name",
+		})
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{
+			Rule:    "breached",
+			Message: "password has appeared in a data breach, please choose another one",
+		})
+	}
+
+	return violations
+}
+
+func containsPersonalInfo(password string, user *types.User) bool {
+	localPart, _, _ := strings.Cut(user.Email, "@")
+
+	password = strings.ToLower(password)
+	for _, info := range []string{localPart, user.FirstName, user.LastName} {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if len(info) >= minPersonalInfoLength && strings.Contains(password, info) {
+			return true
+		}
+	}
+	return false
+}
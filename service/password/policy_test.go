@@ -0,0 +1,68 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestPolicy(t *testing.T) {
+	policy := Policy{MinLength: 8, Breached: BundledBreachedList()}
+	user := &types.User{FirstName: "Sebastian", LastName: "Nunez", Email: "snunez@gmail.com"}
+
+	tests := []struct {
+		name      string
+		password  string
+		user      *types.User
+		wantRules []string
+	}{
+		{name: "strong password", password: "correct horse battery", user: user},
+		{name: "too short", password: "x7$kq", user: user, wantRules: []string{"min"}},
+		{name: "contains the email", password: "i-am-SNUNEZ-42", user: user, wantRules: []string{"personal_info"}},
+		{name: "contains the name", password: "sebastian-2024!", user: user, wantRules: []string{"personal_info"}},
+		{name: "personal info without a user", password: "sebastian-2024!"},
+		{name: "breached", password: "password123", user: user, wantRules: []string{"breached"}},
+		{name: "short and breached", password: "1234", user: user, wantRules: []string{"min", "breached"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, v := range policy.Check(tt.password, tt.user) {
+				rules = append(rules, v.Rule)
+			}
+
+			if strings.Join(rules, ",") != strings.Join(tt.wantRules, ",") {
+				t.Errorf("want rules %v and got %v", tt.wantRules, rules)
+			}
+		})
+	}
+}
+
+func TestParseBreachedList(t *testing.T) {
+	t.Run("should accept hashes with and without counts", func(t *testing.T) {
+		// SHA-1 of "hunter2" and "letmein".
+		list, err := ParseBreachedList(strings.NewReader(`
+# comment
+F3BBB:D66A63D4BF1747940578EC3D0103530E21D:17
+b7a87:5fc1ea228b9061041b7cec4bd3c52ab3ce3
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !list.Contains("hunter2") || !list.Contains("letmein") {
+			t.Error("expected the listed passwords to be breached")
+		}
+		if list.Contains("correct horse battery") {
+			t.Error("expected an unlisted password not to be breached")
+		}
+	})
+
+	t.Run("should reject a malformed hash", func(t *testing.T) {
+		if _, err := ParseBreachedList(strings.NewReader("F3BBBD66A63D4BF17")); err == nil {
+			t.Error("expected an error for a malformed hash")
+		}
+	})
+}
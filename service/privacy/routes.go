@@ -0,0 +1,204 @@
+package privacy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+const (
+	ActionExported = "user.exported"
+	ActionDeleted  = "user.deleted"
+)
+
+// Handler serves data subject requests: exporting and deleting the personal data of a user.
+type Handler struct {
+	userStore  types.UserStore
+	orderStore types.OrderStore
+	auditStore types.AuditStore
+	passwords  auth.PasswordHasher
+}
+
+func NewHandler(
+	userStore types.UserStore,
+	orderStore types.OrderStore,
+	auditStore types.AuditStore,
+	passwords auth.PasswordHasher,
+) *Handler {
+	return &Handler{
+		userStore:  userStore,
+		orderStore: orderStore,
+		auditStore: auditStore,
+		passwords:  passwords,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/users/me/export", auth.WithJWTAuth(auth.DenyImpersonation(h.handleExportCurrentUser), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/users/me", auth.WithJWTAuth(auth.DenyImpersonation(h.handleDeleteCurrentUser), h.userStore)).Methods(http.MethodDelete)
+
+	// Admin only routes.
+	router.HandleFunc("/users/{id}/export", auth.WithAdminAuth(h.handleExportUser, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/users/{id}", auth.WithAdminAuth(h.handleDeleteUser, h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleExportCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userStore.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.export(w, r, user)
+}
+
+func (h *Handler) handleExportUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	h.export(w, r, user)
+}
+
+// handleDeleteCurrentUser asks for the password again so a stolen token can't delete the account.
+func (h *Handler) handleDeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var payload types.DeleteAccountRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.userStore.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if ok, _ := h.passwords.Verify(user.Password, payload.CurrentPassword); !ok {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("current password is incorrect"))
+		return
+	}
+
+	h.delete(w, r, user)
+}
+
+func (h *Handler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if user.DeletedAt != nil {
+		utils.WriteError(w, r, http.StatusConflict, fmt.Errorf("user %d is already deleted", user.ID))
+		return
+	}
+
+	h.delete(w, r, user)
+}
+
+// export streams the data of the user as a JSON attachment. The export is audited before any of
+// it is sent.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, user *types.User) {
+	orders, err := h.orderStore.GetOrdersByUserID(user.ID)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	items, err := h.orderStore.GetOrderItemsByUserID(user.ID)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.audit(r, ActionExported, user.ID); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.json"`, user.ID))
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(newExport(user, orders, items)); err != nil {
+		log.Printf("unable to write the export of user %d: %v", user.ID, err)
+	}
+}
+
+// delete anonymizes the user. Orders are kept for accounting and still reference the user.
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, user *types.User) {
+	if err := h.userStore.AnonymizeUser(user.ID, time.Now(), audit.FromRequest(r, ActionDeleted)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) audit(r *http.Request, action string, userID int) error {
+	event := audit.FromRequest(r, action)
+	event.EntityType = "user"
+	event.EntityID = strconv.Itoa(userID)
+	return h.auditStore.CreateAuditEvent(event)
+}
+
+func (h *Handler) getUserFromPath(w http.ResponseWriter, r *http.Request) (*types.User, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+		return nil, false
+	}
+
+	user, err := h.userStore.GetUserByID(id)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func newExport(user *types.User, orders []types.Order, items []types.OrderItem) types.UserDataExport {
+	itemsByOrder := make(map[int][]types.OrderItem)
+	for _, item := range items {
+		itemsByOrder[item.OrderID] = append(itemsByOrder[item.OrderID], item)
+	}
+
+	export := types.UserDataExport{
+		ExportedAt: time.Now(),
+		Profile:    *user,
+		Addresses:  make([]string, 0),
+		Orders:     make([]types.OrderWithItems, 0, len(orders)),
+	}
+
+	seen := make(map[string]bool)
+	for _, order := range orders {
+		if !seen[order.Address] {
+			seen[order.Address] = true
+			export.Addresses = append(export.Addresses, order.Address)
+		}
+
+		orderItems := itemsByOrder[order.ID]
+		if orderItems == nil {
+			orderItems = make([]types.OrderItem, 0)
+		}
+		export.Orders = append(export.Orders, types.OrderWithItems{Order: order, Items: orderItems})
+	}
+
+	return export
+}
@@ -0,0 +1,235 @@
+package privacy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+const (
+	userID          = 7
+	adminID         = 1
+	correctPassword = "1234"
+)
+
+func TestPrivacyService(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should export the data of the current user", func(t *testing.T) {
+		auditStore := &mockAuditStore{}
+		handler := NewHandler(&mockUserStore{}, &mockOrderStore{}, auditStore, &mockPasswordHasher{})
+
+		req, err := http.NewRequest(http.MethodGet, "/users/me/export", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/export", handler.handleExportCurrentUser)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		var export types.UserDataExport
+		if err := json.NewDecoder(rr.Body).Decode(&export); err != nil {
+			t.Fatal(err)
+		}
+
+		if export.Profile.ID != userID {
+			t.Errorf("want the profile of user %d and got %d", userID, export.Profile.ID)
+		}
+		if len(export.Addresses) != 1 || export.Addresses[0] != "123 Main St" {
+			t.Errorf("want the distinct addresses of the orders and got %v", export.Addresses)
+		}
+		if len(export.Orders) != 2 || len(export.Orders[0].Items) != 2 || len(export.Orders[1].Items) != 0 {
+			t.Errorf("want the orders with their items and got %v", export.Orders)
+		}
+
+		if len(auditStore.events) != 1 || auditStore.events[0].Action != ActionExported {
+			t.Errorf("want the export to be audited and got %v", auditStore.events)
+		}
+	})
+
+	t.Run("should not export anything if the export can't be audited", func(t *testing.T) {
+		handler := NewHandler(&mockUserStore{}, &mockOrderStore{}, &mockAuditStore{err: fmt.Errorf("db error")}, &mockPasswordHasher{})
+
+		req, err := http.NewRequest(http.MethodGet, "/users/me/export", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/export", handler.handleExportCurrentUser)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("want status code %d and got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+
+	t.Run("should delete the current user given their password", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			password    string
+			wantStatus  int
+			wantDeleted bool
+		}{
+			{name: "correct password", password: correctPassword, wantStatus: http.StatusNoContent, wantDeleted: true},
+			{name: "incorrect password", password: "incorrect password", wantStatus: http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			userStore := &mockUserStore{}
+			auditStore := &mockAuditStore{}
+			handler := NewHandler(userStore, &mockOrderStore{}, auditStore, &mockPasswordHasher{})
+
+			marshalled, _ := json.Marshal(types.DeleteAccountRequest{CurrentPassword: tt.password})
+			req, err := http.NewRequest(http.MethodDelete, "/users/me", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/users/me", handler.handleDeleteCurrentUser)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("%s: want status code %d and got %d", tt.name, tt.wantStatus, rr.Code)
+			}
+
+			if (userStore.anonymized == userID) != tt.wantDeleted {
+				t.Errorf("%s: want deleted to be %v", tt.name, tt.wantDeleted)
+			}
+
+			if tt.wantDeleted && (len(userStore.events) != 1 || userStore.events[0].Action != ActionDeleted) {
+				t.Errorf("%s: want the deletion to be audited and got %v", tt.name, userStore.events)
+			}
+		}
+	})
+
+	t.Run("should let an admin delete a user", func(t *testing.T) {
+		userStore := &mockUserStore{}
+		auditStore := &mockAuditStore{}
+		handler := NewHandler(userStore, &mockOrderStore{}, auditStore, &mockPasswordHasher{})
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("/users/%d", userID), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, adminID))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/{id}", handler.handleDeleteUser)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("want status code %d and got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if userStore.anonymized != userID {
+			t.Errorf("want user %d to be deleted", userID)
+		}
+
+		if len(userStore.events) != 1 || *userStore.events[0].ActorID != adminID {
+			t.Errorf("want the deletion to be audited with the admin as actor and got %v", userStore.events)
+		}
+	})
+
+	t.Run("should fail to delete a user who doesn't exist", func(t *testing.T) {
+		handler := NewHandler(&mockUserStore{}, &mockOrderStore{}, &mockAuditStore{}, &mockPasswordHasher{})
+
+		req, err := http.NewRequest(http.MethodDelete, "/users/999", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/{id}", handler.handleDeleteUser)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("want status code %d and got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+type mockUserStore struct {
+	types.UserStore
+	anonymized int
+	// events are the audit events recorded along with a change.
+	events []types.AuditEvent
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if id != userID && id != adminID {
+		return nil, fmt.Errorf("user not found")
+	}
+	return &types.User{ID: id, Email: "snunez@gmail.com", Password: "hashed"}, nil
+}
+
+func (m *mockUserStore) AnonymizeUser(id int, deletedAt time.Time, event types.AuditEvent) error {
+	m.anonymized = id
+	m.events = append(m.events, event)
+	return nil
+}
+
+type mockOrderStore struct {
+	types.OrderStore
+}
+
+func (m *mockOrderStore) GetOrdersByUserID(userID int) ([]types.Order, error) {
+	return []types.Order{
+		{ID: 1, UserID: userID, Address: "123 Main St"},
+		{ID: 2, UserID: userID, Address: "123 Main St"},
+	}, nil
+}
+
+func (m *mockOrderStore) GetOrderItemsByUserID(userID int) ([]types.OrderItem, error) {
+	return []types.OrderItem{
+		{ID: 1, OrderID: 1, ProductID: 1},
+		{ID: 2, OrderID: 1, ProductID: 2},
+	}, nil
+}
+
+type mockAuditStore struct {
+	types.AuditStore
+	events []types.AuditEvent
+	err    error
+}
+
+func (m *mockAuditStore) CreateAuditEvent(event types.AuditEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+type mockPasswordHasher struct{}
+
+func (m *mockPasswordHasher) Hash(password string) (string, error) {
+	return "hashed", nil
+}
+
+func (m *mockPasswordHasher) Verify(hashed string, plain string) (bool, bool) {
+	return plain == correctPassword, false
+}
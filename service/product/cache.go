@@ -0,0 +1,200 @@
+package product
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/service/cache"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// cacheMetrics counts the `hits`, `misses` and `invalidations` of the product cache, published
+// as `product_cache`, along with the misses which waited for the load of another, `coalesced`.
+var cacheMetrics = expvar.NewMap("product_cache")
+
+const productsKey = "products"
+
+func productKey(id int) string {
+	return "product:" + strconv.Itoa(id)
+}
+
+// CachedStore is a read-through cache in front of a product store. Writes go to the store and
+// then invalidate the entries they changed. With a cache local to each instance, other
+// instances keep serving their entries until they expire.
+type CachedStore struct {
+	store types.ProductStore
+	// primary is loaded from instead of store for the replication lag after an invalidation, so
+	// an entry dropped by a write isn't filled again by a replica which hasn't seen the write.
+	primary        types.ProductStore
+	replicationLag time.Duration
+	cache          cache.Cache
+	group          cache.Group
+	// generation is bumped by every invalidation. A load which started before one isn't cached,
+	// since it may have read the product before the write.
+	generation atomic.Uint64
+	// invalidatedAt is the time of the last invalidation, in Unix nanoseconds.
+	invalidatedAt atomic.Int64
+}
+
+// NewCachedStore caches the reads of store, e.g. reading from the replicas. Without replicas,
+// primary is the same as store.
+func NewCachedStore(store types.ProductStore, primary types.ProductStore, replicationLag time.Duration, c cache.Cache) *CachedStore {
+	return &CachedStore{
+		store:          store,
+		primary:        primary,
+		replicationLag: replicationLag,
+		cache:          c,
+	}
+}
+
+func (s *CachedStore) GetProducts() ([]types.Product, error) {
+	var products []types.Product
+	err := s.get(productsKey, &products, func() (any, error) {
+		return s.source().GetProducts()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (s *CachedStore) GetProductByID(id int) (*types.Product, error) {
+	product := new(types.Product)
+	err := s.get(productKey(id), product, func() (any, error) {
+		return s.source().GetProductByID(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// GetProductsByID serves the cached products and loads the others with a single query.
+func (s *CachedStore) GetProductsByID(productIDs []int) ([]types.Product, error) {
+	products := make([]types.Product, 0, len(productIDs))
+	seen := make(map[int]bool, len(productIDs))
+	var missing []int
+	for _, id := range productIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var product types.Product
+		if b, ok := s.cache.Get(productKey(id)); ok && json.Unmarshal(b, &product) == nil {
+			cacheMetrics.Add("hits", 1)
+			products = append(products, product)
+			continue
+		}
+		cacheMetrics.Add("misses", 1)
+		missing = append(missing, id)
+	}
+
+	if len(missing) == 0 {
+		return products, nil
+	}
+
+	generation := s.generation.Load()
+	loaded, err := s.source().GetProductsByID(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, product := range loaded {
+		if b, err := json.Marshal(product); err == nil && s.generation.Load() == generation {
+			s.cache.Set(productKey(product.ID), b)
+		}
+		products = append(products, product)
+	}
+
+	return products, nil
+}
+
+func (s *CachedStore) CreateProduct(product types.CreateProductRequest, event types.AuditEvent) (int, error) {
+	id, err := s.store.CreateProduct(product, event)
+	s.invalidate(productsKey)
+	return id, err
+}
+
+func (s *CachedStore) UpdateProduct(product types.Product, event types.AuditEvent) error {
+	err := s.store.UpdateProduct(product, event)
+	// Even a failed update invalidates, e.g. a conflict shows the cached version is outdated.
+	s.invalidate(productKey(product.ID), productsKey)
+	return err
+}
+
+func (s *CachedStore) AdjustStock(changes []types.StockChange, event types.AuditEvent) error {
+	err := s.store.AdjustStock(changes, event)
+
+	ids := make([]int, len(changes))
+	for i, change := range changes {
+		ids[i] = change.ProductID
+	}
+	s.InvalidateStock(ids...)
+
+	return err
+}
+
+// InvalidateStock drops the cached products whose stock was changed without this store, e.g. by
+// an order.
+func (s *CachedStore) InvalidateStock(productIDs ...int) {
+	keys := []string{productsKey}
+	for _, id := range productIDs {
+		keys = append(keys, productKey(id))
+	}
+	s.invalidate(keys...)
+}
+
+// get decodes the cached value of the key into dst, loading it from the store on a miss.
+// Concurrent misses of a key share a single load.
+func (s *CachedStore) get(key string, dst any, load func() (any, error)) error {
+	if b, ok := s.cache.Get(key); ok {
+		cacheMetrics.Add("hits", 1)
+		return json.Unmarshal(b, dst)
+	}
+	cacheMetrics.Add("misses", 1)
+
+	// Loads aren't shared across an invalidation, a read after a write must see the write.
+	generation := s.generation.Load()
+	b, waiters, err := s.group.Do(key+"@"+strconv.FormatUint(generation, 10), func() ([]byte, error) {
+		v, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.generation.Load() == generation {
+			s.cache.Set(key, b)
+		}
+		return b, nil
+	})
+	cacheMetrics.Add("coalesced", int64(waiters))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+}
+
+// source returns the store to load from: the primary right after an invalidation, the store
+// otherwise.
+func (s *CachedStore) source() types.ProductStore {
+	if time.Since(time.Unix(0, s.invalidatedAt.Load())) < s.replicationLag {
+		return s.primary
+	}
+	return s.store
+}
+
+func (s *CachedStore) invalidate(keys ...string) {
+	s.invalidatedAt.Store(time.Now().UnixNano())
+	s.generation.Add(1)
+	s.cache.Delete(keys...)
+	cacheMetrics.Add("invalidations", 1)
+}
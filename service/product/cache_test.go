@@ -0,0 +1,178 @@
+package product
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/service/cache"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestCachedStore(t *testing.T) {
+	newStore := func() (*CachedStore, *countingProductStore) {
+		store := &countingProductStore{mockProductStore: &mockProductStore{}}
+		return NewCachedStore(store, store, time.Second, cache.NewLRU(100, time.Minute)), store
+	}
+
+	t.Run("should serve repeated reads from the cache", func(t *testing.T) {
+		cached, store := newStore()
+
+		for range 3 {
+			product, err := cached.GetProductByID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if product.Name != "Jordans" || !product.UpdatedAt.Equal(mockUpdatedAt) {
+				t.Errorf("expected the product to round trip and got %+v", product)
+			}
+		}
+		if _, err := cached.GetProducts(); err != nil {
+			t.Fatal(err)
+		}
+		cached.GetProducts()
+
+		if store.byID != 1 || store.all != 1 {
+			t.Errorf("expected a single load of each key and got %d and %d", store.byID, store.all)
+		}
+	})
+
+	t.Run("should not cache errors", func(t *testing.T) {
+		cached, store := newStore()
+		store.err = fmt.Errorf("product does not exist")
+		if _, err := cached.GetProductByID(1); err == nil {
+			t.Fatal("expected the error of the store")
+		}
+
+		store.err = nil
+		if _, err := cached.GetProductByID(1); err != nil {
+			t.Errorf("expected the product to be loaded again and got %v", err)
+		}
+		if store.byID != 2 {
+			t.Errorf("expected 2 loads and got %d", store.byID)
+		}
+	})
+
+	t.Run("should invalidate the products written", func(t *testing.T) {
+		writes := map[string]func(s *CachedStore){
+			"update": func(s *CachedStore) { s.UpdateProduct(types.Product{ID: 1}, types.AuditEvent{}) },
+			"stock": func(s *CachedStore) {
+				s.AdjustStock([]types.StockChange{{ProductID: 1, Delta: -1}}, types.AuditEvent{})
+			},
+		}
+
+		for name, write := range writes {
+			cached, store := newStore()
+			cached.GetProductByID(1)
+			cached.GetProducts()
+			write(cached)
+			cached.GetProductByID(1)
+			cached.GetProducts()
+
+			if store.byID != 2 || store.all != 2 {
+				t.Errorf("%s: expected the product and the list to be loaded again and got %d and %d", name, store.byID, store.all)
+			}
+		}
+	})
+
+	t.Run("should invalidate the list on creation", func(t *testing.T) {
+		cached, store := newStore()
+		cached.GetProducts()
+		cached.CreateProduct(types.CreateProductRequest{Name: "Jordans"}, types.AuditEvent{})
+		cached.GetProducts()
+
+		if store.all != 2 {
+			t.Errorf("expected the list to be loaded again and got %d loads", store.all)
+		}
+	})
+
+	t.Run("should not cache a load which raced a write", func(t *testing.T) {
+		cached, store := newStore()
+		store.onLoad = func() {
+			// The write lands while the product is being read.
+			store.onLoad = nil
+			cached.UpdateProduct(types.Product{ID: 1}, types.AuditEvent{})
+		}
+		cached.GetProductByID(1)
+		cached.GetProductByID(1)
+
+		if store.byID != 2 {
+			t.Errorf("expected the racing load not to be cached and got %d loads", store.byID)
+		}
+	})
+
+	t.Run("should load from the primary for the replication lag after a write", func(t *testing.T) {
+		replica := &countingProductStore{mockProductStore: &mockProductStore{}}
+		primary := &countingProductStore{mockProductStore: &mockProductStore{}}
+		cached := NewCachedStore(replica, primary, 50*time.Millisecond, cache.NewLRU(100, time.Minute))
+
+		cached.GetProductByID(1)
+		cached.UpdateProduct(types.Product{ID: 1}, types.AuditEvent{})
+		cached.GetProductByID(1)
+		cached.GetProducts()
+		cached.GetProductsByID([]int{2})
+		if replica.byID != 1 || primary.byID != 1 || primary.all != 1 || len(primary.batches) != 1 {
+			t.Errorf("expected the loads after the write to go to the primary and got %+v and %+v", replica, primary)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		cached.GetProductByID(3)
+		if replica.byID != 2 || primary.byID != 1 {
+			t.Errorf("expected the loads to go back to the replica and got %d and %d", replica.byID, primary.byID)
+		}
+	})
+
+	t.Run("should only load the missing products of a batch", func(t *testing.T) {
+		cached, store := newStore()
+		cached.GetProductByID(1)
+
+		products, err := cached.GetProductsByID([]int{1, 2, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(products) != 2 {
+			t.Errorf("expected 2 products and got %+v", products)
+		}
+		if len(store.batches) != 1 || fmt.Sprint(store.batches[0]) != "[2]" {
+			t.Errorf("expected a single batch of the missing product and got %v", store.batches)
+		}
+
+		cached.GetProductsByID([]int{1, 2})
+		if len(store.batches) != 1 {
+			t.Errorf("expected the batch to be served from the cache and got %v", store.batches)
+		}
+	})
+}
+
+// countingProductStore counts the reads reaching the store.
+type countingProductStore struct {
+	*mockProductStore
+	all     int
+	byID    int
+	batches [][]int
+	// onLoad runs while a product is read by ID.
+	onLoad func()
+}
+
+func (s *countingProductStore) GetProducts() ([]types.Product, error) {
+	s.all++
+	return s.mockProductStore.GetProducts()
+}
+
+func (s *countingProductStore) GetProductByID(id int) (*types.Product, error) {
+	s.byID++
+	if s.onLoad != nil {
+		s.onLoad()
+	}
+	return s.mockProductStore.GetProductByID(id)
+}
+
+func (s *countingProductStore) GetProductsByID(productIDs []int) ([]types.Product, error) {
+	s.batches = append(s.batches, productIDs)
+	products := make([]types.Product, len(productIDs))
+	for i, id := range productIDs {
+		products[i] = types.Product{ID: id, Name: "Jordans"}
+	}
+	return products, nil
+}
@@ -1,25 +1,40 @@
 package product
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
 	"github.com/sebastian-nunez/golang-store-api/service/auth"
 	"github.com/sebastian-nunez/golang-store-api/types"
 	"github.com/sebastian-nunez/golang-store-api/utils"
 )
 
+const (
+	ActionCreated       = "product.created"
+	ActionUpdated       = "product.updated"
+	ActionStockAdjusted = "product.stock_adjusted"
+	// ActionStockChanged records the stock taken by an order.
+	ActionStockChanged = "product.stock_changed"
+)
+
 type Handler struct {
-	store     types.ProductStore
+	store types.ProductStore
+	// primary reads from the primary database, for the requests which must see the latest
+	// writes, see `db.UsePrimary`. It is the same as store without read replicas.
+	primary   types.ProductStore
 	userStore types.UserStore
 }
 
-func NewHandler(store types.ProductStore, userStore types.UserStore) *Handler {
+func NewHandler(store types.ProductStore, primary types.ProductStore, userStore types.UserStore) *Handler {
 	return &Handler{
 		store:     store,
+		primary:   primary,
 		userStore: userStore,
 	}
 }
@@ -29,60 +44,199 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/products/{id}", h.handleGetProductByID).Methods(http.MethodGet)
 
 	// Admin only routes.
-	router.HandleFunc("/products", auth.WithJWTAuth(h.handleCreateProduct, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products", auth.WithAdminAuth(h.handleCreateProduct, h.userStore, types.ScopeProductsWrite)).Methods(http.MethodPost)
+	router.HandleFunc("/products/{id}", auth.WithAdminAuth(h.handleUpdateProduct, h.userStore, types.ScopeProductsWrite)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{id}/stock", auth.WithAdminAuth(h.handleAdjustStock, h.userStore, types.ScopeProductsWrite)).Methods(http.MethodPost)
 }
 
 func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.store.GetProducts()
+	products, err := h.storeFor(r).GetProducts()
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, products)
+	var lastModified time.Time
+	for _, product := range products {
+		if product.UpdatedAt.After(lastModified) {
+			lastModified = product.UpdatedAt
+		}
+	}
+
+	utils.WriteConditionalJson(w, r, products, lastModified)
 }
 
 func (h *Handler) handleGetProductByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	strId, ok := vars["id"]
 	if !ok {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing product id"))
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("missing product id"))
 		return
 	}
 
 	id, err := strconv.Atoi(strId)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	product, err := h.store.GetProductByID(id)
+	product, err := h.storeFor(r).GetProductByID(id)
 	if err != nil {
-		utils.WriteError(w, http.StatusNotFound, err)
+		writeGetError(w, r, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, product)
+	utils.WriteConditionalJson(w, r, product, product.UpdatedAt)
 }
 
 func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 	var product types.CreateProductRequest
 	if err := utils.ParseJson(r, &product); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := utils.Validate.Struct(product); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload: %v", errors))
+		utils.WriteValidationError(w, r, err)
 		return
 	}
 
-	id, err := h.store.CreateProduct(product)
+	id, err := h.store.CreateProduct(product, audit.FromRequest(r, ActionCreated))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJson(w, http.StatusCreated, map[string]int{"id": id})
 }
+
+// handleUpdateProduct replaces a product but its stock. The update only applies to the version the
+// client read and fails with `409` if the product changed since, e.g. with a checkout. Sending the
+// ETag of the product read in `If-Match` makes it fail with `412` instead.
+func (h *Handler) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid product id"))
+		return
+	}
+
+	var payload types.UpdateProductRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	current, err := h.primary.GetProductByID(id)
+	if err != nil {
+		writeGetError(w, r, err)
+		return
+	}
+
+	etag, err := utils.ETagOf(current)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if !utils.IfMatch(r, etag) {
+		utils.WriteError(w, r, http.StatusPreconditionFailed, fmt.Errorf("product %d was modified since it was read", id))
+		return
+	}
+
+	product := types.Product{
+		ID:          id,
+		Name:        payload.Name,
+		Description: payload.Description,
+		Image:       payload.Image,
+		Price:       payload.Price,
+		Version:     payload.Version,
+	}
+	if err := h.store.UpdateProduct(product, audit.FromRequest(r, ActionUpdated)); err != nil {
+		var conflict *types.ConflictError
+		switch {
+		case errors.As(err, &conflict) && r.Header.Get("If-Match") != "":
+			utils.WriteError(w, r, http.StatusPreconditionFailed, err)
+		case errors.As(err, &conflict):
+			utils.WriteError(w, r, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	updated, err := h.primary.GetProductByID(id)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteConditionalJson(w, r, updated, updated.UpdatedAt)
+}
+
+// handleAdjustStock adds units to the stock of a product or takes them out, e.g. after a
+// delivery or a stocktake, in place so it can't overwrite the stock taken by a checkout.
+func (h *Handler) handleAdjustStock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid product id"))
+		return
+	}
+
+	var payload types.AdjustStockRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	if _, err := h.primary.GetProductByID(id); err != nil {
+		writeGetError(w, r, err)
+		return
+	}
+
+	changes := []types.StockChange{{ProductID: id, Delta: payload.Delta}}
+	if err := h.store.AdjustStock(changes, audit.FromRequest(r, ActionStockAdjusted)); err != nil {
+		var stockErr *types.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			utils.WriteError(w, r, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.primary.GetProductByID(id)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteConditionalJson(w, r, updated, updated.UpdatedAt)
+}
+
+// writeGetError writes `404` for a product which doesn't exist and `500` for any other error,
+// e.g. the database being down.
+func writeGetError(w http.ResponseWriter, r *http.Request, err error) {
+	var notFound *types.NotFoundError
+	if errors.As(err, &notFound) {
+		utils.WriteError(w, r, http.StatusNotFound, err)
+		return
+	}
+	utils.WriteError(w, r, http.StatusInternalServerError, err)
+}
+
+// storeFor returns the store to read the catalog from for the request.
+func (h *Handler) storeFor(r *http.Request) types.ProductStore {
+	if db.UsePrimary(r.Context()) {
+		return h.primary
+	}
+	return h.store
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sebastian-nunez/golang-store-api/types"
@@ -52,9 +53,16 @@ func TestProductService(t *testing.T) {
 			name:       "should return an error when fetching a product that does not exist",
 			method:     http.MethodGet,
 			endpoint:   "/products/1",
-			mockErr:    fmt.Errorf("product does not exist"),
+			mockErr:    &types.NotFoundError{EntityType: "product", ID: 1},
 			wantStatus: http.StatusNotFound,
 		},
+		{
+			name:       "should fail to fetch a product if there was a database error",
+			method:     http.MethodGet,
+			endpoint:   "/products/1",
+			mockErr:    fmt.Errorf("internal DB error"),
+			wantStatus: http.StatusInternalServerError,
+		},
 		{
 			name:       "should successfully create a new product",
 			method:     http.MethodPost,
@@ -83,7 +91,7 @@ func TestProductService(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			mockProductStore := &mockProductStore{err: tc.mockErr}
 			mockUserStore := &mockUserStore{}
-			handler := NewHandler(mockProductStore, mockUserStore)
+			handler := NewHandler(mockProductStore, mockProductStore, mockUserStore)
 
 			var bodyBytes []byte
 			if tc.payload != nil {
@@ -113,23 +121,271 @@ func TestProductService(t *testing.T) {
 	}
 }
 
+func TestConditionalRequests(t *testing.T) {
+	t.Parallel()
+
+	newRouter := func(store *mockProductStore) *mux.Router {
+		handler := NewHandler(store, store, &mockUserStore{})
+		router := mux.NewRouter()
+		router.HandleFunc("/products", handler.handleGetProducts).Methods(http.MethodGet)
+		router.HandleFunc("/products/{id}", handler.handleGetProductByID).Methods(http.MethodGet)
+		router.HandleFunc("/products/{id}", handler.handleUpdateProduct).Methods(http.MethodPut)
+		return router
+	}
+
+	do := func(router *mux.Router, method string, endpoint string, body []byte, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, endpoint, bytes.NewBuffer(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	update, _ := json.Marshal(types.UpdateProductRequest{Name: "Jordans", Price: 110, Version: 3})
+
+	t.Run("should return the ETag and Last-Modified of a product", func(t *testing.T) {
+		rr := do(newRouter(&mockProductStore{}), http.MethodGet, "/products/1", nil, nil)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+		if rr.Header().Get("ETag") == "" {
+			t.Errorf("expected an ETag")
+		}
+		if got := rr.Header().Get("Last-Modified"); got != "Wed, 28 Aug 2024 09:00:00 GMT" {
+			t.Errorf("expected Last-Modified of the product and got %q", got)
+		}
+	})
+
+	for _, endpoint := range []string{"/products", "/products/1"} {
+		t.Run("should return 304 given the current ETag of "+endpoint, func(t *testing.T) {
+			router := newRouter(&mockProductStore{})
+			etag := do(router, http.MethodGet, endpoint, nil, nil).Header().Get("ETag")
+
+			rr := do(router, http.MethodGet, endpoint, nil, http.Header{"If-None-Match": {`"stale", ` + etag}})
+
+			if rr.Code != http.StatusNotModified {
+				t.Errorf("expected status code %d and got %d", http.StatusNotModified, rr.Code)
+			}
+			if rr.Body.Len() != 0 {
+				t.Errorf("expected no body and got %q", rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("should return 200 given a stale ETag", func(t *testing.T) {
+		rr := do(newRouter(&mockProductStore{}), http.MethodGet, "/products/1", nil, http.Header{"If-None-Match": {`"stale"`}})
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should return 304 given a date since the last modification", func(t *testing.T) {
+		rr := do(newRouter(&mockProductStore{}), http.MethodGet, "/products/1", nil, http.Header{"If-Modified-Since": {"Wed, 28 Aug 2024 09:00:00 GMT"}})
+
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("expected status code %d and got %d", http.StatusNotModified, rr.Code)
+		}
+	})
+
+	t.Run("should return 200 given a date before the last modification", func(t *testing.T) {
+		rr := do(newRouter(&mockProductStore{}), http.MethodGet, "/products/1", nil, http.Header{"If-Modified-Since": {"Tue, 27 Aug 2024 09:00:00 GMT"}})
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should update a product given its current ETag", func(t *testing.T) {
+		store := &mockProductStore{}
+		router := newRouter(store)
+		etag := do(router, http.MethodGet, "/products/1", nil, nil).Header().Get("ETag")
+
+		rr := do(router, http.MethodPut, "/products/1", update, http.Header{"If-Match": {etag}})
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+		if len(store.updated) != 1 || store.updated[0].Price != 110 {
+			t.Errorf("expected the product to be updated and got %+v", store.updated)
+		}
+	})
+
+	t.Run("should update a product without If-Match", func(t *testing.T) {
+		store := &mockProductStore{}
+		rr := do(newRouter(store), http.MethodPut, "/products/1", update, nil)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should return 412 given a stale ETag", func(t *testing.T) {
+		store := &mockProductStore{}
+		rr := do(newRouter(store), http.MethodPut, "/products/1", update, http.Header{"If-Match": {`"stale"`}})
+
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status code %d and got %d", http.StatusPreconditionFailed, rr.Code)
+		}
+		if len(store.updated) != 0 {
+			t.Errorf("expected the product not to be updated and got %+v", store.updated)
+		}
+	})
+
+	t.Run("should update the version sent by the client", func(t *testing.T) {
+		store := &mockProductStore{}
+		stale, _ := json.Marshal(types.UpdateProductRequest{Name: "Jordans", Price: 110, Version: 2})
+		do(newRouter(store), http.MethodPut, "/products/1", stale, nil)
+
+		if len(store.updated) != 1 || store.updated[0].Version != 2 {
+			t.Errorf("expected the update to expect version 2 and got %+v", store.updated)
+		}
+	})
+
+	t.Run("should return 400 without a version", func(t *testing.T) {
+		store := &mockProductStore{}
+		rr := do(newRouter(store), http.MethodPut, "/products/1", []byte(`{"name":"Jordans","price":110}`), nil)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d and got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(store.updated) != 0 {
+			t.Errorf("expected the product not to be updated and got %+v", store.updated)
+		}
+	})
+
+	t.Run("should return 412 given an ETag when the product changes before the update", func(t *testing.T) {
+		router := newRouter(&mockProductStore{})
+		etag := do(router, http.MethodGet, "/products/1", nil, nil).Header().Get("ETag")
+
+		rr := do(newRouter(&mockProductStore{conflict: true}), http.MethodPut, "/products/1", update, http.Header{"If-Match": {etag}})
+
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status code %d and got %d", http.StatusPreconditionFailed, rr.Code)
+		}
+	})
+
+	t.Run("should return 409 without an ETag when the product changes before the update", func(t *testing.T) {
+		rr := do(newRouter(&mockProductStore{conflict: true}), http.MethodPut, "/products/1", update, nil)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d and got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should return 404 when updating a product that does not exist", func(t *testing.T) {
+		rr := do(newRouter(&mockProductStore{err: &types.NotFoundError{EntityType: "product", ID: 1}}), http.MethodPut, "/products/1", update, nil)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d and got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should return 500 when the product cannot be read before the update", func(t *testing.T) {
+		rr := do(newRouter(&mockProductStore{err: fmt.Errorf("internal DB error")}), http.MethodPut, "/products/1", update, nil)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code %d and got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
+
+func TestAdjustStockRoute(t *testing.T) {
+	t.Parallel()
+
+	do := func(store *mockProductStore, endpoint string, body string) *httptest.ResponseRecorder {
+		handler := NewHandler(store, store, &mockUserStore{})
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{id}/stock", handler.handleAdjustStock).Methods(http.MethodPost)
+
+		req, _ := http.NewRequest(http.MethodPost, endpoint, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should adjust the stock by the delta", func(t *testing.T) {
+		store := &mockProductStore{}
+		rr := do(store, "/products/1/stock", `{"delta":-2}`)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+		if len(store.adjusted) != 1 || store.adjusted[0] != (types.StockChange{ProductID: 1, Delta: -2}) {
+			t.Errorf("expected the stock of product 1 to be adjusted by -2 and got %+v", store.adjusted)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		store      *mockProductStore
+		endpoint   string
+		body       string
+		wantStatus int
+	}{
+		{name: "zero delta", store: &mockProductStore{}, endpoint: "/products/1/stock", body: `{"delta":0}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid product id", store: &mockProductStore{}, endpoint: "/products/abc/stock", body: `{"delta":1}`, wantStatus: http.StatusBadRequest},
+		{name: "missing product", store: &mockProductStore{err: &types.NotFoundError{EntityType: "product", ID: 1}}, endpoint: "/products/1/stock", body: `{"delta":1}`, wantStatus: http.StatusNotFound},
+		{name: "database error", store: &mockProductStore{err: fmt.Errorf("internal DB error")}, endpoint: "/products/1/stock", body: `{"delta":1}`, wantStatus: http.StatusInternalServerError},
+		{name: "insufficient stock", store: &mockProductStore{insufficient: true}, endpoint: "/products/1/stock", body: `{"delta":-9}`, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run("should fail given a "+tt.name, func(t *testing.T) {
+			rr := do(tt.store, tt.endpoint, tt.body)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status code %d and got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
 type mockProductStore struct {
 	err error
+	// conflict makes UpdateProduct fail as if the product changed since it was read.
+	conflict bool
+	updated  []types.Product
+	// insufficient makes AdjustStock fail as if the stock was too low.
+	insufficient bool
+	adjusted     []types.StockChange
 }
 
+var mockUpdatedAt = time.Date(2024, 8, 28, 9, 0, 0, 0, time.UTC)
+
 func (s *mockProductStore) GetProducts() ([]types.Product, error) {
-	return nil, s.err
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []types.Product{{ID: 1, Name: "Jordans", Price: 125, Quantity: 5, UpdatedAt: mockUpdatedAt, Version: 3}}, nil
 }
 func (s *mockProductStore) GetProductByID(id int) (*types.Product, error) {
-	return nil, s.err
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &types.Product{ID: id, Name: "Jordans", Price: 125, Quantity: 5, UpdatedAt: mockUpdatedAt, Version: 3}, nil
 }
 func (s *mockProductStore) GetProductsByID(productIDs []int) ([]types.Product, error) {
 	return nil, s.err
 }
-func (s *mockProductStore) CreateProduct(product types.CreateProductRequest) (int, error) {
+func (s *mockProductStore) CreateProduct(product types.CreateProductRequest, event types.AuditEvent) (int, error) {
 	return 1, s.err
 }
-func (s *mockProductStore) UpdateProduct(product types.Product) error {
+func (s *mockProductStore) UpdateProduct(product types.Product, event types.AuditEvent) error {
+	if s.conflict {
+		return &types.ConflictError{EntityType: "product", ID: product.ID}
+	}
+	s.updated = append(s.updated, product)
+	return s.err
+}
+func (s *mockProductStore) AdjustStock(changes []types.StockChange, event types.AuditEvent) error {
+	if s.insufficient {
+		return &types.InsufficientStockError{ProductID: changes[0].ProductID, Requested: -changes[0].Delta}
+	}
+	s.adjusted = append(s.adjusted, changes...)
 	return s.err
 }
 
@@ -143,9 +399,33 @@ func (s *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
 func (s *mockUserStore) GetUserByID(id int) (*types.User, error) {
 	return nil, s.err
 }
-func (s *mockUserStore) CreateUser(user types.User) (int, error) {
+func (s *mockUserStore) CreateUser(user types.User, event types.AuditEvent) (int, error) {
 	return 0, s.err
 }
-func (s *mockUserStore) GetUsers() ([]types.User, error) {
-	return nil, s.err
+func (s *mockUserStore) SearchUsers(search types.UserSearch) ([]types.User, int, error) {
+	return nil, 0, s.err
+}
+func (s *mockUserStore) SetEmailVerified(id int, verifiedAt time.Time, event types.AuditEvent) error {
+	return s.err
+}
+func (s *mockUserStore) UpdatePassword(id int, hashedPassword string) error {
+	return s.err
+}
+func (s *mockUserStore) ChangePassword(id int, hashedPassword string, revokedAt time.Time, event types.AuditEvent) error {
+	return s.err
+}
+func (s *mockUserStore) UpdateProfile(id int, firstName string, lastName string, event types.AuditEvent) error {
+	return s.err
+}
+func (s *mockUserStore) UpdateEmail(id int, email string, event types.AuditEvent) error {
+	return s.err
+}
+func (s *mockUserStore) AnonymizeUser(id int, deletedAt time.Time, event types.AuditEvent) error {
+	return s.err
+}
+func (s *mockUserStore) SetDisabled(id int, disabledAt *time.Time, event types.AuditEvent) error {
+	return s.err
+}
+func (s *mockUserStore) UpdateRole(id int, role string, event types.AuditEvent) error {
+	return s.err
 }
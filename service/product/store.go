@@ -1,23 +1,30 @@
 package product
 
 import (
+	"cmp"
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
 	"github.com/sebastian-nunez/golang-store-api/types"
 )
 
 type Store struct {
-	db *sql.DB
+	db *db.DB
 }
 
-func NewStore(db *sql.DB) *Store {
+func NewStore(db *db.DB) *Store {
 	return &Store{db: db}
 }
 
+// GetProducts and GetProductByID read from a replica, if any, see `db.DB.Replica`.
 func (s *Store) GetProducts() ([]types.Product, error) {
-	rows, err := s.db.Query("SELECT * FROM products")
+	rows, err := s.db.Replica().Query("SELECT * FROM products")
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +43,7 @@ func (s *Store) GetProducts() ([]types.Product, error) {
 }
 
 func (s *Store) GetProductByID(id int) (*types.Product, error) {
-	rows, err := s.db.Query("SELECT * FROM products WHERE id = ?", id)
+	rows, err := s.db.Replica().Query("SELECT * FROM products WHERE id = ?", id)
 	if err != nil {
 		return nil, err
 	}
@@ -50,13 +57,17 @@ func (s *Store) GetProductByID(id int) (*types.Product, error) {
 	}
 
 	if product.ID == 0 {
-		return nil, fmt.Errorf("product with id %d not found", id)
+		return nil, &types.NotFoundError{EntityType: "product", ID: id}
 	}
 
 	return product, nil
 }
 
 func (s *Store) GetProductsByID(productIDs []int) ([]types.Product, error) {
+	if len(productIDs) == 0 {
+		return []types.Product{}, nil
+	}
+
 	placeholders := strings.Repeat(",?", len(productIDs)-1)
 	query := fmt.Sprintf("SELECT * FROM products WHERE id IN (?%s)", placeholders)
 
@@ -82,20 +93,30 @@ func (s *Store) GetProductsByID(productIDs []int) ([]types.Product, error) {
 	return products, nil
 }
 
-func (s *Store) CreateProduct(product types.CreateProductRequest) (int, error) {
-	res, err := s.db.Exec(
-		"INSERT INTO products (name, price, image, description, quantity) VALUES (?, ?, ?, ?, ?)",
-		product.Name,
-		product.Price,
-		product.Image,
-		product.Description,
-		product.Quantity,
-	)
-	if err != nil {
-		return 0, err
-	}
+func (s *Store) CreateProduct(product types.CreateProductRequest, event types.AuditEvent) (int, error) {
+	var id int64
+	err := s.db.Transact(func(tx *db.Tx) error {
+		var err error
+		id, err = tx.Insert(
+			"INSERT INTO products (name, price, image, description, quantity) VALUES (?, ?, ?, ?, ?)",
+			product.Name,
+			product.Price,
+			product.Image,
+			product.Description,
+			product.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+
+		event.EntityType = "product"
+		event.EntityID = strconv.FormatInt(id, 10)
+		if event.Before, event.After, err = audit.Changes(nil, product); err != nil {
+			return err
+		}
 
-	id, err := res.LastInsertId()
+		return audit.Record(tx, event)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -103,23 +124,147 @@ func (s *Store) CreateProduct(product types.CreateProductRequest) (int, error) {
 	return int(id), nil
 }
 
-func (s *Store) UpdateProduct(product types.Product) error {
-	_, err := s.db.Exec(
-		"UPDATE products SET name = ?, price = ?, image = ?, description = ?, quantity = ? WHERE id = ?",
+func (s *Store) UpdateProduct(product types.Product, event types.AuditEvent) error {
+	return s.db.Transact(func(tx *db.Tx) error {
+		return updateProduct(tx, product, event)
+	})
+}
+
+func updateProduct(tx *db.Tx, product types.Product, event types.AuditEvent) error {
+	// The row is locked so the recorded changes are the ones this update made.
+	rows, err := tx.Query("SELECT * FROM products WHERE id = ? FOR UPDATE", product.ID)
+	if err != nil {
+		return err
+	}
+
+	before := new(types.Product)
+	for rows.Next() {
+		before, err = scanRowsIntoProduct(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+
+	if before.ID == 0 {
+		return &types.NotFoundError{EntityType: "product", ID: product.ID}
+	}
+
+	res, err := tx.Exec(
+		"UPDATE products SET name = ?, price = ?, image = ?, description = ?, version = version + 1, updatedAt = CURRENT_TIMESTAMP WHERE id = ? AND version = ?",
 		product.Name,
 		product.Price,
 		product.Image,
 		product.Description,
-		product.Quantity,
 		product.ID,
+		product.Version,
 	)
 	if err != nil {
 		return err
 	}
 
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return &types.ConflictError{EntityType: "product", ID: product.ID}
+	}
+
+	// The stock and timestamps aren't set by the caller, so they're left out of the changes.
+	product.Quantity = before.Quantity
+	product.CreatedAt = before.CreatedAt
+	product.UpdatedAt = before.UpdatedAt
+	product.Version = before.Version + 1
+	event.EntityType = "product"
+	event.EntityID = strconv.Itoa(product.ID)
+	if event.Before, event.After, err = audit.Changes(before, product); err != nil {
+		return err
+	}
+
+	return audit.Record(tx, event)
+}
+
+func (s *Store) AdjustStock(changes []types.StockChange, event types.AuditEvent) error {
+	return s.db.Transact(func(tx *db.Tx) error {
+		return AdjustStockTx(tx, changes, event)
+	})
+}
+
+// AdjustStockTx applies the changes like `AdjustStock`, in the transaction of a larger change,
+// e.g. an order. Caches of the products must be invalidated by the caller.
+func AdjustStockTx(tx *db.Tx, changes []types.StockChange, event types.AuditEvent) error {
+	// Rows are locked in the order of their IDs, so concurrent checkouts can't deadlock each other.
+	changes = slices.Clone(changes)
+	slices.SortStableFunc(changes, func(a, b types.StockChange) int {
+		return cmp.Compare(a.ProductID, b.ProductID)
+	})
+
+	for _, change := range changes {
+		if change.Delta == 0 {
+			continue
+		}
+		if err := adjustStock(tx, change, event); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// adjustStock changes the stock in place, the guard making the decrement fail rather than go
+// below zero when concurrent checkouts race for the last units.
+func adjustStock(tx *db.Tx, change types.StockChange, event types.AuditEvent) error {
+	var res sql.Result
+	var err error
+	if change.Delta < 0 {
+		res, err = tx.Exec(
+			"UPDATE products SET quantity = quantity - ?, version = version + 1, updatedAt = CURRENT_TIMESTAMP WHERE id = ? AND quantity >= ?",
+			-change.Delta,
+			change.ProductID,
+			-change.Delta,
+		)
+	} else {
+		res, err = tx.Exec(
+			"UPDATE products SET quantity = quantity + ?, version = version + 1, updatedAt = CURRENT_TIMESTAMP WHERE id = ?",
+			change.Delta,
+			change.ProductID,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	var quantity int
+	err = tx.QueryRow("SELECT quantity FROM products WHERE id = ?", change.ProductID).Scan(&quantity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.NotFoundError{EntityType: "product", ID: change.ProductID}
+	}
+	if err != nil {
+		return err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return &types.InsufficientStockError{ProductID: change.ProductID, Requested: -change.Delta}
+	}
+
+	event.EntityType = "product"
+	event.EntityID = strconv.Itoa(change.ProductID)
+	event.Before, event.After, err = audit.Changes(
+		map[string]int{"quantity": quantity - change.Delta},
+		map[string]int{"quantity": quantity},
+	)
+	if err != nil {
+		return err
+	}
+
+	return audit.Record(tx, event)
+}
+
 func scanRowsIntoProduct(rows *sql.Rows) (*types.Product, error) {
 	product := new(types.Product)
 	err := rows.Scan(
@@ -130,6 +275,8 @@ func scanRowsIntoProduct(rows *sql.Rows) (*types.Product, error) {
 		&product.Price,
 		&product.Quantity,
 		&product.CreatedAt,
+		&product.UpdatedAt,
+		&product.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,128 @@
+package product
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+var productColumns = []string{"id", "name", "description", "image", "price", "quantity", "createdAt", "updatedAt", "version"}
+
+func TestUpdateProduct(t *testing.T) {
+	product := types.Product{ID: 1, Name: "Jordans", Price: 110, Quantity: 4, Version: 3}
+
+	t.Run("should update the product at the expected version", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("unable to stub db %s", err)
+		}
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM products WHERE id = \\? FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "Jordans", "", "", 125, 5, time.Now(), time.Now(), 3))
+		mock.ExpectExec("UPDATE products SET .*version = version \\+ 1, updatedAt = CURRENT_TIMESTAMP WHERE id = \\? AND version = \\?").
+			WithArgs("Jordans", 110.0, "", "", 1, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		if err := NewStore(db.New(sqlDB, db.MySQL)).UpdateProduct(product, types.AuditEvent{Action: ActionUpdated}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("should return a conflict error given an outdated version", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("unable to stub db %s", err)
+		}
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM products WHERE id = \\? FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "Jordans", "", "", 125, 2, time.Now(), time.Now(), 4))
+		mock.ExpectExec("UPDATE products SET").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err = NewStore(db.New(sqlDB, db.MySQL)).UpdateProduct(product, types.AuditEvent{Action: ActionUpdated})
+
+		var conflict *types.ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("expected a conflict error, but got %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %v", err)
+		}
+	})
+}
+
+func TestAdjustStock(t *testing.T) {
+	t.Run("should decrement the stock in place in the order of the product IDs", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("unable to stub db %s", err)
+		}
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		for _, change := range []struct{ id, quantity, remaining int }{{1, 1, 4}, {2, 3, 0}} {
+			mock.ExpectExec("UPDATE products SET quantity = quantity - \\?, version = version \\+ 1, updatedAt = CURRENT_TIMESTAMP WHERE id = \\? AND quantity >= \\?").
+				WithArgs(change.quantity, change.id, change.quantity).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\?").
+				WithArgs(change.id).
+				WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(change.remaining))
+			mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+
+		changes := []types.StockChange{{ProductID: 2, Delta: -3}, {ProductID: 1, Delta: -1}}
+		if err := NewStore(db.New(sqlDB, db.MySQL)).AdjustStock(changes, types.AuditEvent{Action: "product.stock_changed"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("should return an insufficient stock error and roll back", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("unable to stub db %s", err)
+		}
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+			WithArgs(2, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(1))
+		mock.ExpectRollback()
+
+		err = NewStore(db.New(sqlDB, db.MySQL)).AdjustStock([]types.StockChange{{ProductID: 1, Delta: -2}}, types.AuditEvent{})
+
+		var stockErr *types.InsufficientStockError
+		if !errors.As(err, &stockErr) || stockErr.ProductID != 1 || stockErr.Requested != 2 {
+			t.Fatalf("expected an insufficient stock error for product 1, but got %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %v", err)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should allow bursts and then deny until a token is refilled", func(t *testing.T) {
+		now := time.Now()
+		store := NewMemoryStore()
+		store.now = func() time.Time { return now }
+		limit := PerMinute(60, 2) // one token per second
+
+		for i := 0; i < 2; i++ {
+			res, _ := store.Take("key", limit)
+			if !res.Allowed {
+				t.Fatalf("expected request %d to be allowed", i+1)
+			}
+		}
+
+		res, _ := store.Take("key", limit)
+		if res.Allowed {
+			t.Fatal("expected request to be denied once the burst is used")
+		}
+		if res.RetryAfter != time.Second {
+			t.Errorf("expected retry after %v and got %v", time.Second, res.RetryAfter)
+		}
+		if res.Remaining != 0 {
+			t.Errorf("expected 0 remaining and got %d", res.Remaining)
+		}
+
+		now = now.Add(time.Second)
+		res, _ = store.Take("key", limit)
+		if !res.Allowed {
+			t.Error("expected request to be allowed after a token was refilled")
+		}
+	})
+
+	t.Run("should keep separate buckets per key", func(t *testing.T) {
+		store := NewMemoryStore()
+		limit := PerMinute(1, 1)
+
+		store.Take("a", limit)
+		res, _ := store.Take("b", limit)
+		if !res.Allowed {
+			t.Error("expected a different key to have its own bucket")
+		}
+	})
+
+	t.Run("should forget buckets once they are full again", func(t *testing.T) {
+		now := time.Now()
+		store := NewMemoryStore()
+		store.now = func() time.Time { return now }
+
+		store.Take("key", PerMinute(60, 1))
+		now = now.Add(sweepInterval + time.Second)
+		store.Take("other", PerMinute(60, 1))
+
+		if _, ok := store.buckets["key"]; ok {
+			t.Error("expected the full bucket to be swept")
+		}
+	})
+}
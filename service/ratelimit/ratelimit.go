@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+// Limit is a token bucket which refills `Requests` tokens every `Per` and holds at most `Burst` tokens.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// PerMinute returns a limit of `requests` per minute allowing bursts of `burst` requests.
+func PerMinute(requests int, burst int) Limit {
+	return Limit{Requests: requests, Per: time.Minute, Burst: burst}
+}
+
+// rate returns the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next token is available. Zero when allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets. Implementations must be safe for concurrent use.
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+}
+
+// KeyFunc identifies the client making the request, e.g. by IP address or user ID.
+type KeyFunc func(r *http.Request) string
+
+// Policy is a named limit applied to a group of routes.
+type Policy struct {
+	Name  string
+	Limit Limit
+}
+
+// Limiter is a middleware which rate limits requests per client and per route group.
+type Limiter struct {
+	store    Store
+	key      KeyFunc
+	fallback Policy
+	routes   map[string]Policy
+}
+
+func NewLimiter(store Store, key KeyFunc, fallback Policy) *Limiter {
+	return &Limiter{
+		store:    store,
+		key:      key,
+		fallback: fallback,
+		routes:   make(map[string]Policy),
+	}
+}
+
+// Route applies the policy to the given route path templates, e.g. `/api/v1/login`.
+func (l *Limiter) Route(policy Policy, pathTemplates ...string) {
+	for _, tpl := range pathTemplates {
+		l.routes[tpl] = policy
+	}
+}
+
+// Middleware rate limits the matched route. Meant to be installed with `router.Use`.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := l.policyFor(r)
+
+		res, err := l.store.Take(policy.Name+":"+l.key(r), policy.Limit)
+		if err != nil {
+			// Fail open, an unavailable store should not take the whole API down.
+			log.Printf("rate limit: unable to take token: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit.Burst, int(policy.Limit.Per.Seconds())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+		if !res.Allowed {
+			retryAfter := ceilSeconds(res.RetryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			utils.WriteError(w, r, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded, retry in %d seconds", retryAfter))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) policyFor(r *http.Request) Policy {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return l.fallback
+	}
+
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return l.fallback
+	}
+
+	if policy, ok := l.routes[tpl]; ok {
+		return policy
+	}
+	return l.fallback
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	newRouter := func(store Store) *mux.Router {
+		limiter := NewLimiter(
+			store,
+			func(r *http.Request) string { return r.Header.Get("X-Client") },
+			Policy{Name: "api", Limit: PerMinute(60, 3)},
+		)
+		limiter.Route(Policy{Name: "auth", Limit: PerMinute(60, 1)}, "/login")
+
+		router := mux.NewRouter()
+		router.Use(limiter.Middleware)
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+		router.HandleFunc("/login", ok)
+		router.HandleFunc("/products", ok)
+		return router
+	}
+
+	do := func(router *mux.Router, endpoint string, client string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
+		req.Header.Set("X-Client", client)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should set rate limit headers on allowed requests", func(t *testing.T) {
+		rr := do(newRouter(NewMemoryStore()), "/products", "client")
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+		if got := rr.Header().Get("RateLimit-Limit"); got != "3" {
+			t.Errorf("expected RateLimit-Limit 3 and got %q", got)
+		}
+		if got := rr.Header().Get("RateLimit-Remaining"); got != "2" {
+			t.Errorf("expected RateLimit-Remaining 2 and got %q", got)
+		}
+		if got := rr.Header().Get("RateLimit-Policy"); got != "3;w=60" {
+			t.Errorf("expected RateLimit-Policy 3;w=60 and got %q", got)
+		}
+	})
+
+	t.Run("should return 429 with Retry-After once the route limit is exceeded", func(t *testing.T) {
+		router := newRouter(NewMemoryStore())
+		do(router, "/login", "client")
+		rr := do(router, "/login", "client")
+
+		if rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d and got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "1" {
+			t.Errorf("expected Retry-After 1 and got %q", got)
+		}
+	})
+
+	t.Run("should limit route groups and clients independently", func(t *testing.T) {
+		router := newRouter(NewMemoryStore())
+		do(router, "/login", "client")
+
+		if rr := do(router, "/products", "client"); rr.Code != http.StatusOK {
+			t.Errorf("expected other route groups to be allowed and got %d", rr.Code)
+		}
+		if rr := do(router, "/login", "other client"); rr.Code != http.StatusOK {
+			t.Errorf("expected other clients to be allowed and got %d", rr.Code)
+		}
+	})
+
+	t.Run("should let requests through when the store fails", func(t *testing.T) {
+		rr := do(newRouter(failingStore{}), "/login", "client")
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d and got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(key string, limit Limit) (Result, error) {
+	return Result{}, fmt.Errorf("store unavailable")
+}
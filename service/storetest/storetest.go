@@ -0,0 +1,560 @@
+// Package storetest is a conformance suite for implementations of the user, product and order
+// stores, so the in-memory stores can't drift apart from the SQL ones.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// Stores are the stores under test, sharing one empty database.
+type Stores struct {
+	Users    types.UserStore
+	Products types.ProductStore
+	Orders   types.OrderStore
+}
+
+// Run runs the suite, calling newStores for a new database in every test.
+func Run(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("UserStore", func(t *testing.T) { testUserStore(t, newStores) })
+	t.Run("ProductStore", func(t *testing.T) { testProductStore(t, newStores) })
+	t.Run("OrderStore", func(t *testing.T) { testOrderStore(t, newStores) })
+}
+
+func testUserStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("should create a customer found by ID and email", func(t *testing.T) {
+		users := newStores(t).Users
+		id := createUser(t, users, "ada@example.com")
+
+		user, err := users.GetUserByID(id)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		if user.Email != "ada@example.com" || user.FirstName != "Ada" || user.Role != types.RoleCustomer {
+			t.Errorf("expected a customer with the created fields, but got %+v", user)
+		}
+		if user.CreatedAt.IsZero() || user.EmailVerifiedAt != nil || user.DeletedAt != nil {
+			t.Errorf("expected only the creation time to be set, but got %+v", user)
+		}
+
+		byEmail, err := users.GetUserByEmail("ada@example.com")
+		if err != nil || byEmail.ID != id {
+			t.Errorf("expected user %d by email, but got %+v, %v", id, byEmail, err)
+		}
+	})
+
+	t.Run("should return an error given a missing user", func(t *testing.T) {
+		users := newStores(t).Users
+
+		if _, err := users.GetUserByID(42); err == nil {
+			t.Errorf("expected an error given a missing ID")
+		}
+		if _, err := users.GetUserByEmail("nobody@example.com"); err == nil {
+			t.Errorf("expected an error given a missing email")
+		}
+	})
+
+	t.Run("should keep emails unique", func(t *testing.T) {
+		users := newStores(t).Users
+		createUser(t, users, "ada@example.com")
+		id := createUser(t, users, "grace@example.com")
+
+		if _, err := users.CreateUser(types.User{FirstName: "Ada", LastName: "Byron", Email: "ada@example.com", Password: "hash"}, types.AuditEvent{Action: "user.registered"}); err == nil {
+			t.Errorf("expected an error creating a user with a taken email")
+		}
+		if err := users.UpdateEmail(id, "ada@example.com", types.AuditEvent{Action: "user.email_changed"}); err == nil {
+			t.Errorf("expected an error changing to a taken email")
+		}
+
+		user, _ := users.GetUserByID(id)
+		if user.Email != "grace@example.com" {
+			t.Errorf("expected the email to be unchanged, but got %s", user.Email)
+		}
+	})
+
+	t.Run("should mark a changed email as unverified", func(t *testing.T) {
+		users := newStores(t).Users
+		id := createUser(t, users, "ada@example.com")
+		verifiedAt := time.Now()
+
+		if err := users.SetEmailVerified(id, verifiedAt, types.AuditEvent{Action: "user.email_verified"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		user, _ := users.GetUserByID(id)
+		if user.EmailVerifiedAt == nil || !closeTo(*user.EmailVerifiedAt, verifiedAt) {
+			t.Fatalf("expected the email to be verified at %v, but got %v", verifiedAt, user.EmailVerifiedAt)
+		}
+
+		if err := users.UpdateEmail(id, "ada@example.org", types.AuditEvent{Action: "user.email_changed"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		user, _ = users.GetUserByID(id)
+		if user.Email != "ada@example.org" || user.EmailVerifiedAt != nil {
+			t.Errorf("expected the new email to be unverified, but got %+v", user)
+		}
+	})
+
+	t.Run("should update the profile, password and sessions", func(t *testing.T) {
+		users := newStores(t).Users
+		id := createUser(t, users, "ada@example.com")
+		revokedAt := time.Now()
+
+		if err := users.UpdateProfile(id, "Augusta", "King", types.AuditEvent{Action: "user.profile_updated"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		if err := users.ChangePassword(id, "new-hash", revokedAt, types.AuditEvent{Action: "user.password_changed"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		user, _ := users.GetUserByID(id)
+		if user.FirstName != "Augusta" || user.LastName != "King" || user.Password != "new-hash" {
+			t.Errorf("expected the profile and password to be updated, but got %+v", user)
+		}
+		if user.SessionsRevokedAt == nil || !closeTo(*user.SessionsRevokedAt, revokedAt) {
+			t.Errorf("expected the sessions to be revoked at %v, but got %v", revokedAt, user.SessionsRevokedAt)
+		}
+	})
+
+	t.Run("should rehash the password without revoking the sessions", func(t *testing.T) {
+		users := newStores(t).Users
+		id := createUser(t, users, "ada@example.com")
+
+		if err := users.UpdatePassword(id, "rehashed"); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		user, _ := users.GetUserByID(id)
+		if user.Password != "rehashed" || user.SessionsRevokedAt != nil {
+			t.Errorf("expected only the password to change, but got %+v", user)
+		}
+	})
+
+	t.Run("should disable and enable a user", func(t *testing.T) {
+		users := newStores(t).Users
+		id := createUser(t, users, "ada@example.com")
+		disabledAt := time.Now()
+
+		if err := users.SetDisabled(id, &disabledAt, types.AuditEvent{Action: "user.disabled"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		user, _ := users.GetUserByID(id)
+		if user.DisabledAt == nil || !closeTo(*user.DisabledAt, disabledAt) {
+			t.Fatalf("expected the user to be disabled at %v, but got %v", disabledAt, user.DisabledAt)
+		}
+
+		if err := users.SetDisabled(id, nil, types.AuditEvent{Action: "user.enabled"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		user, _ = users.GetUserByID(id)
+		if user.DisabledAt != nil {
+			t.Errorf("expected the user to be enabled, but got %v", user.DisabledAt)
+		}
+	})
+
+	t.Run("should change the role", func(t *testing.T) {
+		users := newStores(t).Users
+		id := createUser(t, users, "ada@example.com")
+
+		if err := users.UpdateRole(id, types.RoleAdmin, types.AuditEvent{Action: "user.role_updated"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		user, _ := users.GetUserByID(id)
+		if user.Role != types.RoleAdmin {
+			t.Errorf("expected the role %s, but got %s", types.RoleAdmin, user.Role)
+		}
+
+		if err := users.UpdateRole(id, "superuser", types.AuditEvent{Action: "user.role_updated"}); err == nil {
+			t.Errorf("expected an error given an unknown role")
+		}
+		if err := users.UpdateRole(42, types.RoleAdmin, types.AuditEvent{Action: "user.role_updated"}); err == nil {
+			t.Errorf("expected an error given a missing user")
+		}
+	})
+
+	t.Run("should anonymize a user", func(t *testing.T) {
+		users := newStores(t).Users
+		id := createUser(t, users, "ada@example.com")
+		deletedAt := time.Now()
+
+		if err := users.AnonymizeUser(id, deletedAt, types.AuditEvent{Action: "user.deleted"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		user, _ := users.GetUserByID(id)
+		if user.FirstName != "Deleted" || user.LastName != "User" || user.Password != "" {
+			t.Errorf("expected the personal data to be replaced, but got %+v", user)
+		}
+		if user.Email != fmt.Sprintf("deleted-%d@deleted.invalid", id) {
+			t.Errorf("expected a placeholder email, but got %s", user.Email)
+		}
+		if user.DeletedAt == nil || user.SessionsRevokedAt == nil || !closeTo(*user.DeletedAt, deletedAt) {
+			t.Errorf("expected the user to be deleted and signed out, but got %+v", user)
+		}
+		if _, err := users.GetUserByEmail("ada@example.com"); err == nil {
+			t.Errorf("expected the old email to be gone")
+		}
+	})
+
+	t.Run("should search users by email or name", func(t *testing.T) {
+		users := newStores(t).Users
+		ada := createUser(t, users, "ada@example.com")
+		grace := createUser(t, users, "grace@example.org")
+		users.UpdateProfile(grace, "Grace", "Hopper", types.AuditEvent{Action: "user.profile_updated"})
+		percent := createUser(t, users, "100%@example.org")
+
+		tests := []struct {
+			query string
+			want  []int
+		}{
+			{query: "", want: []int{ada, grace, percent}},
+			{query: "EXAMPLE.ORG", want: []int{grace, percent}},
+			{query: "grace hop", want: []int{grace}},
+			{query: "%", want: []int{percent}},
+			{query: "_", want: []int{}},
+		}
+
+		for _, tt := range tests {
+			found, total, err := users.SearchUsers(types.UserSearch{Query: tt.query, Limit: 10})
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+			if got := userIDs(found); total != len(tt.want) || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("query %q: expected users %v, but got %v of %d", tt.query, tt.want, got, total)
+			}
+		}
+
+		page, total, err := users.SearchUsers(types.UserSearch{Limit: 1, Offset: 1})
+		if err != nil || total != 3 || len(page) != 1 || page[0].ID != grace {
+			t.Errorf("expected the second of 3 users, but got %v of %d, %v", userIDs(page), total, err)
+		}
+	})
+}
+
+func testProductStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("should create a product at the first version", func(t *testing.T) {
+		products := newStores(t).Products
+		id := createProduct(t, products, 5)
+
+		product, err := products.GetProductByID(id)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		if product.Name != "Jordans" || product.Price != 109.99 || product.Quantity != 5 || product.Version != 1 {
+			t.Errorf("expected the created product, but got %+v", product)
+		}
+		if product.CreatedAt.IsZero() || product.UpdatedAt.IsZero() {
+			t.Errorf("expected the timestamps to be set, but got %+v", product)
+		}
+
+		var notFound *types.NotFoundError
+		if _, err := products.GetProductByID(42); !errors.As(err, &notFound) {
+			t.Errorf("expected a not found error given a missing product, but got %v", err)
+		}
+	})
+
+	t.Run("should reject a negative quantity", func(t *testing.T) {
+		products := newStores(t).Products
+
+		_, err := products.CreateProduct(types.CreateProductRequest{Name: "Jordans", Price: 109.99, Quantity: -1}, types.AuditEvent{Action: "product.created"})
+		if err == nil {
+			t.Errorf("expected an error creating a product with a negative quantity")
+		}
+	})
+
+	t.Run("should list the products which exist", func(t *testing.T) {
+		products := newStores(t).Products
+		first := createProduct(t, products, 1)
+		second := createProduct(t, products, 2)
+
+		all, err := products.GetProducts()
+		if err != nil || fmt.Sprint(productIDs(all)) != fmt.Sprint([]int{first, second}) {
+			t.Errorf("expected products %v, but got %v, %v", []int{first, second}, productIDs(all), err)
+		}
+
+		found, err := products.GetProductsByID([]int{second, 42})
+		if err != nil || fmt.Sprint(productIDs(found)) != fmt.Sprint([]int{second}) {
+			t.Errorf("expected products %v, but got %v, %v", []int{second}, productIDs(found), err)
+		}
+	})
+
+	t.Run("should find no products given no IDs or missing IDs", func(t *testing.T) {
+		products := newStores(t).Products
+		createProduct(t, products, 1)
+
+		for _, ids := range [][]int{nil, {}, {42, 43}} {
+			found, err := products.GetProductsByID(ids)
+			if err != nil {
+				t.Errorf("IDs %v: expected no error, but got %v", ids, err)
+			}
+			if found == nil || len(found) != 0 {
+				t.Errorf("IDs %v: expected an empty list, but got %#v", ids, found)
+			}
+		}
+	})
+
+	t.Run("should update a product but its stock at the expected version", func(t *testing.T) {
+		products := newStores(t).Products
+		product, _ := products.GetProductByID(createProduct(t, products, 5))
+
+		stale := *product
+		product.Name = "Air Max"
+		product.Quantity = 7
+		if err := products.UpdateProduct(*product, types.AuditEvent{Action: "product.updated"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		updated, _ := products.GetProductByID(product.ID)
+		if updated.Name != "Air Max" || updated.Quantity != 5 || updated.Version != 2 {
+			t.Errorf("expected the update at version 2 with the stock unchanged, but got %+v", updated)
+		}
+
+		var conflict *types.ConflictError
+		if err := products.UpdateProduct(stale, types.AuditEvent{Action: "product.updated"}); !errors.As(err, &conflict) {
+			t.Errorf("expected a conflict error given a stale version, but got %v", err)
+		}
+
+		stale.ID = 42
+		if err := products.UpdateProduct(stale, types.AuditEvent{Action: "product.updated"}); err == nil {
+			t.Errorf("expected an error given a missing product")
+		}
+	})
+
+	t.Run("should adjust the stock of every product or none", func(t *testing.T) {
+		products := newStores(t).Products
+		first := createProduct(t, products, 5)
+		second := createProduct(t, products, 1)
+
+		err := products.AdjustStock([]types.StockChange{{ProductID: first, Delta: -2}, {ProductID: second, Delta: -2}}, types.AuditEvent{Action: "order.created"})
+		var insufficient *types.InsufficientStockError
+		if !errors.As(err, &insufficient) || insufficient.ProductID != second {
+			t.Fatalf("expected an insufficient stock error for product %d, but got %v", second, err)
+		}
+		if product, _ := products.GetProductByID(first); product.Quantity != 5 || product.Version != 1 {
+			t.Errorf("expected the stock of product %d to be untouched, but got %+v", first, product)
+		}
+
+		err = products.AdjustStock([]types.StockChange{{ProductID: second, Delta: -1}, {ProductID: first, Delta: 3}}, types.AuditEvent{Action: "order.created"})
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		if product, _ := products.GetProductByID(first); product.Quantity != 8 || product.Version != 2 {
+			t.Errorf("expected 8 units at version 2, but got %+v", product)
+		}
+		if product, _ := products.GetProductByID(second); product.Quantity != 0 || product.Version != 2 {
+			t.Errorf("expected 0 units at version 2, but got %+v", product)
+		}
+
+		if err := products.AdjustStock([]types.StockChange{{ProductID: 42, Delta: 1}}, types.AuditEvent{Action: "order.created"}); err == nil {
+			t.Errorf("expected an error given a missing product")
+		}
+	})
+
+	t.Run("should not oversell given concurrent adjustments", func(t *testing.T) {
+		products := newStores(t).Products
+		id := createProduct(t, products, 5)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		sold := 0
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := products.AdjustStock([]types.StockChange{{ProductID: id, Delta: -1}}, types.AuditEvent{Action: "order.created"})
+
+				var insufficient *types.InsufficientStockError
+				if err != nil && !errors.As(err, &insufficient) {
+					t.Errorf("expected no error or an insufficient stock error, but got %v", err)
+					return
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					sold++
+				}
+			}()
+		}
+		wg.Wait()
+
+		product, _ := products.GetProductByID(id)
+		if sold != 5 || product.Quantity != 0 {
+			t.Errorf("expected 5 units sold and none left, but got %d sold and %d left", sold, product.Quantity)
+		}
+	})
+}
+
+func testOrderStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("should return the orders and items of a user", func(t *testing.T) {
+		stores := newStores(t)
+		ada := createUser(t, stores.Users, "ada@example.com")
+		grace := createUser(t, stores.Users, "grace@example.com")
+		product := createProduct(t, stores.Products, 6)
+
+		first := createOrder(t, stores.Orders, ada, product)
+		createOrder(t, stores.Orders, grace, product)
+		second := createOrder(t, stores.Orders, ada, product)
+
+		orders, err := stores.Orders.GetOrdersByUserID(ada)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		if len(orders) != 2 || orders[0].ID != first || orders[1].ID != second {
+			t.Fatalf("expected orders %v, but got %+v", []int{first, second}, orders)
+		}
+		if orders[0].Status != "pending" || orders[0].Total != 219.98 || orders[0].Address != "1 Infinite Loop" || orders[0].CreatedAt.IsZero() {
+			t.Errorf("expected the created order, but got %+v", orders[0])
+		}
+
+		items, err := stores.Orders.GetOrderItemsByUserID(ada)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		if len(items) != 2 || items[0].OrderID != first || items[1].OrderID != second {
+			t.Fatalf("expected an item per order, but got %+v", items)
+		}
+		if items[0].ProductID != product || items[0].Quantity != 2 || items[0].Price != 109.99 {
+			t.Errorf("expected the created item, but got %+v", items[0])
+		}
+	})
+
+	t.Run("should take the items out of stock with the order", func(t *testing.T) {
+		stores := newStores(t)
+		user := createUser(t, stores.Users, "ada@example.com")
+		first := createProduct(t, stores.Products, 5)
+		second := createProduct(t, stores.Products, 1)
+
+		items := []types.OrderItem{{ProductID: second, Quantity: 1, Price: 1}, {ProductID: first, Quantity: 2, Price: 1}}
+		if _, err := stores.Orders.CreateOrder(pendingOrder(user), items, types.AuditEvent{Action: "order.created"}); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		for id, want := range map[int]int{first: 3, second: 0} {
+			if product, _ := stores.Products.GetProductByID(id); product.Quantity != want {
+				t.Errorf("expected %d units of product %d left, but got %d", want, id, product.Quantity)
+			}
+		}
+	})
+
+	t.Run("should create nothing given an item out of stock", func(t *testing.T) {
+		stores := newStores(t)
+		user := createUser(t, stores.Users, "ada@example.com")
+		first := createProduct(t, stores.Products, 5)
+		second := createProduct(t, stores.Products, 1)
+
+		items := []types.OrderItem{{ProductID: first, Quantity: 2, Price: 1}, {ProductID: second, Quantity: 2, Price: 1}}
+		_, err := stores.Orders.CreateOrder(pendingOrder(user), items, types.AuditEvent{Action: "order.created"})
+		var insufficient *types.InsufficientStockError
+		if !errors.As(err, &insufficient) || insufficient.ProductID != second {
+			t.Fatalf("expected an insufficient stock error for product %d, but got %v", second, err)
+		}
+
+		if product, _ := stores.Products.GetProductByID(first); product.Quantity != 5 {
+			t.Errorf("expected the stock of product %d to be untouched, but got %d", first, product.Quantity)
+		}
+		if orders, _ := stores.Orders.GetOrdersByUserID(user); len(orders) != 0 {
+			t.Errorf("expected no order, but got %+v", orders)
+		}
+	})
+
+	t.Run("should enforce the foreign keys", func(t *testing.T) {
+		stores := newStores(t)
+		user := createUser(t, stores.Users, "ada@example.com")
+		product := createProduct(t, stores.Products, 5)
+		item := []types.OrderItem{{ProductID: product, Quantity: 1, Price: 1}}
+
+		if _, err := stores.Orders.CreateOrder(pendingOrder(42), item, types.AuditEvent{Action: "order.created"}); err == nil {
+			t.Errorf("expected an error given a missing user")
+		}
+		missing := []types.OrderItem{{ProductID: product, Quantity: 1, Price: 1}, {ProductID: 42, Quantity: 1, Price: 1}}
+		if _, err := stores.Orders.CreateOrder(pendingOrder(user), missing, types.AuditEvent{Action: "order.created"}); err == nil {
+			t.Errorf("expected an error given a missing product")
+		}
+
+		if p, _ := stores.Products.GetProductByID(product); p.Quantity != 5 {
+			t.Errorf("expected the stock to be untouched, but got %d", p.Quantity)
+		}
+		if orders, _ := stores.Orders.GetOrdersByUserID(user); len(orders) != 0 {
+			t.Errorf("expected no order, but got %+v", orders)
+		}
+	})
+
+	t.Run("should reject an unknown status", func(t *testing.T) {
+		stores := newStores(t)
+		user := createUser(t, stores.Users, "ada@example.com")
+
+		order := pendingOrder(user)
+		order.Status = "shipped"
+		if _, err := stores.Orders.CreateOrder(order, nil, types.AuditEvent{Action: "order.created"}); err == nil {
+			t.Errorf("expected an error given an unknown status")
+		}
+	})
+}
+
+func createUser(t *testing.T, users types.UserStore, email string) int {
+	t.Helper()
+	id, err := users.CreateUser(
+		types.User{FirstName: "Ada", LastName: "Lovelace", Email: email, Password: "hash"},
+		types.AuditEvent{Action: "user.registered"},
+	)
+	if err != nil {
+		t.Fatalf("unable to create user %s: %v", email, err)
+	}
+	return id
+}
+
+func createProduct(t *testing.T, products types.ProductStore, quantity int) int {
+	t.Helper()
+	id, err := products.CreateProduct(
+		types.CreateProductRequest{Name: "Jordans", Description: "Shoes", Image: "jordans.png", Price: 109.99, Quantity: quantity},
+		types.AuditEvent{Action: "product.created"},
+	)
+	if err != nil {
+		t.Fatalf("unable to create product: %v", err)
+	}
+	return id
+}
+
+// createOrder creates an order of 2 units of the product.
+func createOrder(t *testing.T, orders types.OrderStore, userID int, productID int) int {
+	t.Helper()
+	id, err := orders.CreateOrder(
+		pendingOrder(userID),
+		[]types.OrderItem{{ProductID: productID, Quantity: 2, Price: 109.99}},
+		types.AuditEvent{Action: "order.created"},
+	)
+	if err != nil {
+		t.Fatalf("unable to create order: %v", err)
+	}
+	return id
+}
+
+func pendingOrder(userID int) types.Order {
+	return types.Order{UserID: userID, Total: 219.98, Status: "pending", Address: "1 Infinite Loop"}
+}
+
+func userIDs(users []types.User) []int {
+	ids := make([]int, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+func productIDs(products []types.Product) []int {
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids
+}
+
+// closeTo compares times to the second, the precision of MySQL timestamps.
+func closeTo(a time.Time, b time.Time) bool {
+	return a.Sub(b).Abs() < time.Second
+}
@@ -0,0 +1,178 @@
+package storetest
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/cmd/migrate/migrations"
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/cache"
+	"github.com/sebastian-nunez/golang-store-api/service/lockout"
+	"github.com/sebastian-nunez/golang-store-api/service/memory"
+	"github.com/sebastian-nunez/golang-store-api/service/order"
+	"github.com/sebastian-nunez/golang-store-api/service/product"
+	"github.com/sebastian-nunez/golang-store-api/service/totp"
+	"github.com/sebastian-nunez/golang-store-api/service/user"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+func TestMemoryStores(t *testing.T) {
+	Run(t, func(t *testing.T) Stores {
+		db := memory.NewDB()
+		return Stores{
+			Users:    memory.NewUserStore(db),
+			Products: memory.NewProductStore(db),
+			Orders:   memory.NewOrderStore(db),
+		}
+	})
+}
+
+func TestSQLStores(t *testing.T) {
+	Run(t, func(t *testing.T) Stores {
+		db := newSQLiteDB(t, 0)
+		return Stores{
+			Users:    user.NewStore(db),
+			Products: product.NewStore(db),
+			Orders:   order.NewStore(db),
+		}
+	})
+}
+
+func TestCachedSQLStores(t *testing.T) {
+	Run(t, func(t *testing.T) Stores {
+		db := newSQLiteDB(t, 0)
+		return Stores{
+			Users:    user.NewStore(db),
+			Products: product.NewCachedStore(product.NewStore(db), product.NewStore(db), time.Second, cache.NewLRU(100, time.Minute)),
+			Orders:   order.NewStore(db),
+		}
+	})
+}
+
+// TestReplicatedSQLStores reads the catalog from a replica which is a second pool on the same
+// file, i.e. one without any lag.
+func TestReplicatedSQLStores(t *testing.T) {
+	Run(t, func(t *testing.T) Stores {
+		db := newSQLiteDB(t, 1)
+		return Stores{
+			Users:    user.NewStore(db),
+			Products: product.NewStore(db),
+			Orders:   order.NewStore(db),
+		}
+	})
+}
+
+// TestAnonymizeUserClearsLoginFailures checks that the failed logins of the email, only kept by
+// the SQL stores, go with the account.
+func TestAnonymizeUserClearsLoginFailures(t *testing.T) {
+	db := newSQLiteDB(t, 0)
+	users := user.NewStore(db)
+	failures := lockout.NewStore(db)
+	id := createUser(t, users, "ada@example.com")
+
+	subject := lockout.EmailSubject("ada@example.com")
+	if _, err := failures.IncrementLoginFailures(subject, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.AnonymizeUser(id, time.Now(), types.AuditEvent{Action: "user.deleted"}); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	failure, err := failures.GetLoginFailure(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failure.Failures != 0 {
+		t.Errorf("expected the failed logins to be deleted, but got %d", failure.Failures)
+	}
+}
+
+// TestChangesAreAudited checks that the SQL stores record an event with every change, and none
+// with a change which fails.
+func TestChangesAreAudited(t *testing.T) {
+	db := newSQLiteDB(t, 0)
+	users := user.NewStore(db)
+	twoFactor := totp.NewStore(db)
+	events := audit.NewStore(db)
+
+	id := createUser(t, users, "ada@example.com")
+	createUser(t, users, "grace@example.com")
+	if err := users.UpdateEmail(id, "grace@example.com", types.AuditEvent{Action: "user.email_changed"}); err == nil {
+		t.Fatal("expected an error changing to a taken email")
+	}
+	if err := users.ChangePassword(id, "new-hash", time.Now(), types.AuditEvent{Action: "user.password_changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := twoFactor.EnableTOTP(id, time.Now(), []string{"code-hash"}, types.AuditEvent{Action: "user.2fa_enabled"}); err != nil {
+		t.Fatal(err)
+	}
+	productID := createProduct(t, product.NewStore(db), 5)
+	if _, err := order.NewStore(db).CreateOrder(
+		pendingOrder(id),
+		[]types.OrderItem{{ProductID: productID, Quantity: 2, Price: 109.99}},
+		types.AuditEvent{Action: "order.created"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	entityID := strconv.Itoa(id)
+	found, _, err := events.GetAuditEvents(types.AuditFilter{EntityID: entityID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"user.registered", "user.password_changed", "user.2fa_enabled"}
+	got := make([]string, 0, len(found))
+	for _, event := range found {
+		if event.EntityType == "user" {
+			got = append(got, event.Action)
+		}
+	}
+	slices.Sort(want)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected the events %v of user %d, but got %v", want, id, got)
+	}
+
+	orders, _, err := events.GetAuditEvents(types.AuditFilter{EntityType: "order", Limit: 10})
+	if err != nil || len(orders) != 1 || orders[0].Action != "order.created" {
+		t.Errorf("expected the order to be audited, but got %+v, %v", orders, err)
+	}
+
+	stock, _, err := events.GetAuditEvents(types.AuditFilter{EntityType: "product", EntityID: strconv.Itoa(productID), Limit: 10})
+	if err != nil || len(stock) != 2 || stock[0].Action != product.ActionStockChanged {
+		t.Errorf("expected the stock change to be audited, but got %+v, %v", stock, err)
+	}
+}
+
+// newSQLiteDB returns a migrated database in a file of its own, removed with the test, with
+// replicas reading the same file.
+func newSQLiteDB(t *testing.T, replicas int) *db.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "store.db")
+	replicaDSNs := make([]string, replicas)
+	for i := range replicaDSNs {
+		replicaDSNs[i] = dsn
+	}
+
+	sqlite, err := db.Open("sqlite", dsn, replicaDSNs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+
+	m, err := migrations.New(sqlite.SQL(), "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return sqlite
+}
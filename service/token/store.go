@@ -0,0 +1,128 @@
+package token
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+type Store struct {
+	db *db.DB
+}
+
+func NewStore(db *db.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateUserToken(token types.UserToken) error {
+	_, err := s.db.Exec(
+		"INSERT INTO user_tokens (userId, purpose, tokenHash, expiresAt) VALUES (?, ?, ?, ?)",
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.ExpiresAt,
+	)
+	return err
+}
+
+func (s *Store) GetUserToken(purpose string, tokenHash string) (*types.UserToken, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM user_tokens WHERE purpose = ? AND tokenHash = ? AND usedAt IS NULL AND expiresAt > ?",
+		purpose,
+		tokenHash,
+		time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	token := new(types.UserToken)
+	for rows.Next() {
+		token, err = scanRowsIntoUserToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if token.ID == 0 {
+		return nil, fmt.Errorf("token is invalid or expired")
+	}
+
+	return token, nil
+}
+
+func (s *Store) ConsumeUserToken(purpose string, tokenHash string) (*types.UserToken, error) {
+	now := time.Now()
+
+	// Marking the token as used in a single statement keeps two concurrent requests from both using it.
+	res, err := s.db.Exec(
+		"UPDATE user_tokens SET usedAt = ? WHERE purpose = ? AND tokenHash = ? AND usedAt IS NULL AND expiresAt > ?",
+		now,
+		purpose,
+		tokenHash,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, fmt.Errorf("token is invalid or expired")
+	}
+
+	rows, err := s.db.Query("SELECT * FROM user_tokens WHERE purpose = ? AND tokenHash = ?", purpose, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	token := new(types.UserToken)
+	for rows.Next() {
+		token, err = scanRowsIntoUserToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if token.ID == 0 {
+		return nil, fmt.Errorf("token is invalid or expired")
+	}
+
+	return token, nil
+}
+
+func (s *Store) DeleteUserTokens(userID int, purpose string) error {
+	_, err := s.db.Exec("DELETE FROM user_tokens WHERE userId = ? AND purpose = ?", userID, purpose)
+	return err
+}
+
+func scanRowsIntoUserToken(rows *sql.Rows) (*types.UserToken, error) {
+	token := new(types.UserToken)
+	var usedAt sql.NullTime
+	err := rows.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&usedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+
+	return token, nil
+}
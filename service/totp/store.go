@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+type Store struct {
+	db *db.DB
+}
+
+func NewStore(db *db.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) SetTOTPSecret(userID int, secret string) error {
+	_, err := s.db.Exec(
+		"UPDATE users SET totpSecret = ?, totpEnabledAt = NULL, totpLastUsedStep = NULL WHERE id = ?",
+		secret,
+		userID,
+	)
+	return err
+}
+
+func (s *Store) EnableTOTP(userID int, enabledAt time.Time, codeHashes []string, event types.AuditEvent) error {
+	return s.db.Transact(func(tx *db.Tx) error {
+		if _, err := tx.Exec("DELETE FROM recovery_codes WHERE userId = ?", userID); err != nil {
+			return err
+		}
+
+		for _, hash := range codeHashes {
+			if _, err := tx.Exec("INSERT INTO recovery_codes (userId, codeHash) VALUES (?, ?)", userID, hash); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("UPDATE users SET totpEnabledAt = ? WHERE id = ?", enabledAt, userID); err != nil {
+			return err
+		}
+
+		return recordEvent(tx, userID, event)
+	})
+}
+
+func (s *Store) DisableTOTP(userID int, event types.AuditEvent) error {
+	return s.db.Transact(func(tx *db.Tx) error {
+		_, err := tx.Exec(
+			"UPDATE users SET totpSecret = NULL, totpEnabledAt = NULL, totpLastUsedStep = NULL WHERE id = ?",
+			userID,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM recovery_codes WHERE userId = ?", userID); err != nil {
+			return err
+		}
+
+		return recordEvent(tx, userID, event)
+	})
+}
+
+func (s *Store) UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := s.db.Exec(
+		"UPDATE users SET totpLastUsedStep = ? WHERE id = ? AND (totpLastUsedStep IS NULL OR totpLastUsedStep < ?)",
+		step,
+		userID,
+		step,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *Store) ConsumeRecoveryCode(userID int, codeHash string) (bool, error) {
+	res, err := s.db.Exec(
+		"UPDATE recovery_codes SET usedAt = ? WHERE userId = ? AND codeHash = ? AND usedAt IS NULL",
+		time.Now(),
+		userID,
+		codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// recordEvent completes the event with the user and records it in the transaction.
+func recordEvent(tx *db.Tx, userID int, event types.AuditEvent) error {
+	event.EntityType = "user"
+	event.EntityID = strconv.Itoa(userID)
+	return audit.Record(tx, event)
+}
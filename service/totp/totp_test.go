@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// secret is the ASCII key "12345678901234567890" from the RFC 6238 test vectors.
+var secret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("expected code %s at %d and got %s", tt.want, tt.unix, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	t.Run("should accept codes within the allowed skew", func(t *testing.T) {
+		for _, offset := range []time.Duration{-Period, 0, Period} {
+			code, _ := Code(secret, now.Add(offset))
+			step, ok := Validate(secret, code, now)
+			if !ok {
+				t.Errorf("expected code from %v to be valid", offset)
+			}
+			if want := now.Add(offset).Unix() / 30; step != want {
+				t.Errorf("expected step %d and got %d", want, step)
+			}
+		}
+	})
+
+	t.Run("should reject codes outside the allowed skew", func(t *testing.T) {
+		code, _ := Code(secret, now.Add(-2*Period))
+		if _, ok := Validate(secret, code, now); ok {
+			t.Error("expected an old code to be invalid")
+		}
+	})
+
+	t.Run("should reject malformed codes", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			if _, ok := Validate(secret, code, now); ok {
+				t.Errorf("expected %q to be invalid", code)
+			}
+		}
+	})
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Golang Store", "user@google.com", "ABC")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Golang%20Store:user@google.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=Golang+Store") {
+		t.Errorf("expected secret and issuer in %s", uri)
+	}
+}
@@ -0,0 +1,187 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+const (
+	ActionDisabled             = "user.disabled"
+	ActionEnabled              = "user.enabled"
+	ActionRoleChanged          = "user.role_changed"
+	ActionPasswordResetForced  = "user.password_reset_forced"
+	ActionImpersonationStarted = auth.ActionImpersonationStarted
+)
+
+var (
+	errSelfManagement    = fmt.Errorf("admins can't disable themselves or change their own role")
+	errNotImpersonatable = fmt.Errorf("only active customers can be impersonated")
+)
+
+func (h *Handler) handleDisableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if err := h.store.SetDisabled(user.ID, &now, audit.FromRequest(r, ActionDisabled)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleEnableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.SetDisabled(user.ID, nil, audit.FromRequest(r, ActionEnabled)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	var payload types.UpdateRoleRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, ok := h.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.UpdateRole(user.ID, payload.Role, audit.FromRequest(r, ActionRoleChanged)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	user.Role = payload.Role
+	utils.WriteJson(w, http.StatusOK, user)
+}
+
+// handleForcePasswordReset makes the current password unusable, signs the user out and emails
+// them a password reset link, e.g. when their account is suspected to be compromised.
+func (h *Handler) handleForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// No password hash matches an empty string.
+	if err := h.store.ChangePassword(user.ID, "", time.Now(), audit.FromRequest(r, ActionPasswordResetForced)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.sendPasswordResetEmail(*user); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleImpersonateUser issues a short-lived token to act as a customer, e.g. to reproduce what
+// they see. Sensitive actions are denied with it and every request made with it is audited.
+func (h *Handler) handleImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if user.Role == types.RoleAdmin || user.DisabledAt != nil || user.DeletedAt != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, errNotImpersonatable)
+		return
+	}
+
+	ttl := time.Second * time.Duration(config.Envs.ImpersonationTTLInSeconds)
+	expiresAt := time.Now().Add(ttl)
+	actorID := auth.GetUserIDFromContext(r.Context())
+	impersonationToken, err := auth.CreateImpersonationToken([]byte(config.Envs.JWTSecret), user.ID, actorID, ttl)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// No token is handed out unless the trail is complete.
+	event := audit.FromRequest(r, ActionImpersonationStarted)
+	event.EntityType = "user"
+	event.EntityID = strconv.Itoa(user.ID)
+	event.Details = "expires " + expiresAt.UTC().Format(time.RFC3339)
+	if err := h.auditStore.CreateAuditEvent(event); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]any{"token": impersonationToken, "expiresAt": expiresAt})
+}
+
+func (h *Handler) handleGetUserOrders(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	orders, err := h.orderStore.GetOrdersByUserID(user.ID)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, orders)
+}
+
+// getManagedUser returns the user of the path unless it is the admin making the request, so an
+// admin can't lock themselves out.
+func (h *Handler) getManagedUser(w http.ResponseWriter, r *http.Request) (*types.User, bool) {
+	user, ok := h.getUserFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if user.ID == auth.GetUserIDFromContext(r.Context()) {
+		utils.WriteError(w, r, http.StatusBadRequest, errSelfManagement)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *Handler) getUserFromPath(w http.ResponseWriter, r *http.Request) (*types.User, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+		return nil, false
+	}
+
+	user, err := h.store.GetUserByID(id)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	return user, true
+}
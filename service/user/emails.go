@@ -0,0 +1,86 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/mail"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/types"
+)
+
+// sendVerificationEmail stores a new verification token for the user and emails them the link.
+func (h *Handler) sendVerificationEmail(user types.User) error {
+	ttl := time.Duration(config.Envs.EmailVerificationTTLInSeconds) * time.Second
+	link, err := h.createTokenLink(user.ID, types.TokenPurposeEmailVerification, ttl, "/verify-email")
+	if err != nil {
+		return err
+	}
+
+	h.sendEmail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease verify your email by following this link:\n\n%s\n\nThe link expires in %s.",
+			user.FirstName,
+			link,
+			ttl,
+		),
+	})
+
+	return nil
+}
+
+// sendPasswordResetEmail stores a new password reset token for the user and emails them the link.
+func (h *Handler) sendPasswordResetEmail(user types.User) error {
+	ttl := time.Duration(config.Envs.PasswordResetTTLInSeconds) * time.Second
+	link, err := h.createTokenLink(user.ID, types.TokenPurposePasswordReset, ttl, "/reset-password")
+	if err != nil {
+		return err
+	}
+
+	h.sendEmail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password of your account. If it was you, follow this link to choose a new one:\n\n%s\n\nThe link expires in %s. If it wasn't you, you can ignore this email.",
+			user.FirstName,
+			link,
+			ttl,
+		),
+	})
+
+	return nil
+}
+
+// createTokenLink stores a new single-use token and returns the frontend link which carries it.
+func (h *Handler) createTokenLink(userID int, purpose string, ttl time.Duration, path string) (string, error) {
+	plain, hash, err := token.New()
+	if err != nil {
+		return "", err
+	}
+
+	err = h.tokenStore.CreateUserToken(types.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%s?token=%s", config.Envs.FrontendURL, path, url.QueryEscape(plain)), nil
+}
+
+// sendEmail sends the email in the background so slow mail servers don't hold up the response.
+func (h *Handler) sendEmail(msg mail.Message) {
+	go func() {
+		if err := h.mailer.Send(msg); err != nil {
+			log.Printf("unable to send email %q: %v", msg.Subject, err)
+		}
+	}()
+}
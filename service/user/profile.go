@@ -0,0 +1,177 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+const (
+	ActionProfileUpdated  = "user.profile_updated"
+	ActionPasswordChanged = "user.password_changed"
+	ActionEmailChanged    = "user.email_changed"
+)
+
+var errIncorrectCurrentPassword = fmt.Errorf("current password is incorrect")
+
+func (h *Handler) handleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, user)
+}
+
+func (h *Handler) handleUpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var payload types.UpdateProfileRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if payload.FirstName != nil {
+		user.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		user.LastName = *payload.LastName
+	}
+
+	if err := h.store.UpdateProfile(user.ID, user.FirstName, user.LastName, audit.FromRequest(r, ActionProfileUpdated)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, user)
+}
+
+// handleChangePassword signs out every other session of the user and returns a new token for the
+// current one.
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ChangePasswordRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if ok, _ := h.passwords.Verify(user.Password, payload.CurrentPassword); !ok {
+		utils.WriteError(w, r, http.StatusBadRequest, errIncorrectCurrentPassword)
+		return
+	}
+
+	if !h.checkPasswordPolicy(w, r, "newPassword", payload.NewPassword, user) {
+		return
+	}
+
+	hashedPassword, err := h.passwords.Hash(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The new token is issued after the revocation, so it stays valid.
+	if err := h.store.ChangePassword(user.ID, hashedPassword, time.Now(), audit.FromRequest(r, ActionPasswordChanged)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	jwtToken, err := h.createJwtToken([]byte(config.Envs.JWTSecret), user.ID)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	session := ""
+	if auth.IsCookieSession(r.Context()) {
+		session = auth.SessionCookie
+	}
+	writeSession(w, r, session, jwtToken)
+}
+
+// handleChangeEmail changes the email of the user right away and sends a verification email to
+// the new address.
+func (h *Handler) handleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var payload types.ChangeEmailRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if ok, _ := h.passwords.Verify(user.Password, payload.CurrentPassword); !ok {
+		utils.WriteError(w, r, http.StatusBadRequest, errIncorrectCurrentPassword)
+		return
+	}
+
+	if strings.EqualFold(user.Email, payload.Email) {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("email is unchanged"))
+		return
+	}
+
+	if _, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		utils.WriteError(w, r, http.StatusConflict, fmt.Errorf("user with email %s already exists", payload.Email))
+		return
+	}
+
+	if err := h.store.UpdateEmail(user.ID, payload.Email, audit.FromRequest(r, ActionEmailChanged)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	user.Email = payload.Email
+	user.EmailVerifiedAt = nil
+
+	// Links sent to the previous address must neither verify the new one nor reset the password
+	// of whoever may still read it.
+	for _, purpose := range []string{types.TokenPurposeEmailVerification, types.TokenPurposePasswordReset} {
+		if err := h.tokenStore.DeleteUserTokens(user.ID, purpose); err != nil {
+			log.Printf("unable to delete %s tokens of user %d: %v", purpose, user.ID, err)
+		}
+	}
+	if err := h.sendVerificationEmail(*user); err != nil {
+		log.Printf("unable to send verification email to user %d: %v", user.ID, err)
+	}
+
+	utils.WriteJson(w, http.StatusOK, user)
+}
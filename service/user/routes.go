@@ -2,93 +2,259 @@ package user
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
 	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/service/lockout"
+	"github.com/sebastian-nunez/golang-store-api/service/mail"
+	"github.com/sebastian-nunez/golang-store-api/service/password"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
 	"github.com/sebastian-nunez/golang-store-api/types"
 	"github.com/sebastian-nunez/golang-store-api/utils"
 )
 
+const (
+	ActionLoggedIn      = "user.logged_in"
+	ActionRegistered    = "user.registered"
+	ActionEmailVerified = "user.email_verified"
+	ActionPasswordReset = "user.password_reset"
+)
+
+var (
+	errInvalidCredentials = fmt.Errorf("invalid email or password")
+	errAccountDisabled    = fmt.Errorf("account is disabled")
+	errInvalidResetToken  = fmt.Errorf("password reset token is invalid or expired")
+)
+
 type Handler struct {
-	store           types.UserStore
-	hashPassword    func(password string) (string, error)
-	comparePassword func(hashed string, plain string) bool
-	createJwtToken  func(secret []byte, userId int) (string, error)
+	store          types.UserStore
+	passwords      auth.PasswordHasher
+	passwordPolicy password.Policy
+	createJwtToken func(secret []byte, userId int) (string, error)
+	loginGuard     *lockout.Guard
+	tokenStore     types.UserTokenStore
+	mailer         mail.Mailer
+	twoFactorStore types.TwoFactorStore
+	orderStore     types.OrderStore
+	auditStore     types.AuditStore
 }
 
 func NewHandler(
 	store types.UserStore,
-	hashPassword func(password string) (string, error),
-	comparePassword func(hashed string, plain string) bool,
+	passwords auth.PasswordHasher,
+	passwordPolicy password.Policy,
 	createJwtToken func(secret []byte, userId int) (string, error),
+	loginGuard *lockout.Guard,
+	tokenStore types.UserTokenStore,
+	mailer mail.Mailer,
+	twoFactorStore types.TwoFactorStore,
+	orderStore types.OrderStore,
+	auditStore types.AuditStore,
 ) *Handler {
 	return &Handler{
-		store:           store,
-		hashPassword:    hashPassword,
-		comparePassword: comparePassword,
-		createJwtToken:  createJwtToken,
+		store:          store,
+		passwords:      passwords,
+		passwordPolicy: passwordPolicy,
+		createJwtToken: createJwtToken,
+		loginGuard:     loginGuard,
+		tokenStore:     tokenStore,
+		mailer:         mailer,
+		twoFactorStore: twoFactorStore,
+		orderStore:     orderStore,
+		auditStore:     auditStore,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.handleLogin).Methods(http.MethodPost)
+	router.HandleFunc("/login/2fa", h.handleLoginTwoFactor).Methods(http.MethodPost)
+	router.HandleFunc("/logout", h.handleLogout).Methods(http.MethodPost)
 	router.HandleFunc("/register", h.handleRegister).Methods(http.MethodPost)
+	router.HandleFunc("/auth/verify-email", h.handleVerifyEmail).Methods(http.MethodPost)
+	router.HandleFunc("/auth/resend-verification", h.handleResendVerification).Methods(http.MethodPost)
+	router.HandleFunc("/auth/forgot-password", h.handleForgotPassword).Methods(http.MethodPost)
+	router.HandleFunc("/auth/reset-password", h.handleResetPassword).Methods(http.MethodPost)
+
+	router.HandleFunc("/users/me", auth.WithJWTAuth(h.handleGetCurrentUser, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/users/me", auth.WithJWTAuth(h.handleUpdateCurrentUser, h.store)).Methods(http.MethodPatch)
+	router.HandleFunc("/users/me/password", auth.WithJWTAuth(auth.DenyImpersonation(h.handleChangePassword), h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/email", auth.WithJWTAuth(auth.DenyImpersonation(h.handleChangeEmail), h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/2fa/enroll", auth.WithJWTAuth(auth.DenyImpersonation(h.handleEnrollTwoFactor), h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/2fa/confirm", auth.WithJWTAuth(auth.DenyImpersonation(h.handleConfirmTwoFactor), h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/2fa", auth.WithJWTAuth(auth.DenyImpersonation(h.handleDisableTwoFactor), h.store)).Methods(http.MethodDelete)
+
+	router.HandleFunc("/users/{id}", auth.WithSelfOrAdminAuth(h.handleGetUserById, h.store, types.ScopeUsersRead)).Methods(http.MethodGet)
 
 	// Admin only routes.
-	router.HandleFunc("/users", auth.WithJWTAuth(h.handleGetUsers, h.store)).Methods(http.MethodGet)
-	router.HandleFunc("/users/{id}", auth.WithJWTAuth(h.handleGetUserById, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/users", auth.WithAdminAuth(h.handleGetUsers, h.store, types.ScopeUsersRead)).Methods(http.MethodGet)
+	router.HandleFunc("/users/{id}/unlock", auth.WithAdminAuth(h.handleUnlockUser, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/{id}/disable", auth.WithAdminAuth(h.handleDisableUser, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/{id}/enable", auth.WithAdminAuth(h.handleEnableUser, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/{id}/role", auth.WithAdminAuth(h.handleUpdateUserRole, h.store)).Methods(http.MethodPut)
+	router.HandleFunc("/users/{id}/password-reset", auth.WithAdminAuth(h.handleForcePasswordReset, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/users/{id}/orders", auth.WithAdminAuth(h.handleGetUserOrders, h.store, types.ScopeOrdersRead)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/users/{id}/impersonate", auth.WithAdminAuth(h.handleImpersonateUser, h.store)).Methods(http.MethodPost)
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	var payload types.LoginUserRequest
 	err := utils.ParseJson(r, &payload)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", errors))
+		utils.WriteValidationError(w, r, err)
 		return
 	}
 
-	user, err := h.store.GetUserByEmail(payload.Email)
+	// Locked and unknown accounts get the same response as a wrong password to avoid leaking which
+	// emails are registered.
+	ip := utils.ClientIP(r)
+	locked, err := h.loginGuard.Check(r.Context(), payload.Email, ip)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid email or password"))
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	if !h.comparePassword(user.Password, payload.Password) {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid email or password"))
+	if locked {
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidCredentials)
 		return
 	}
 
+	user, err := h.store.GetUserByEmail(payload.Email)
+	if err != nil || !h.verifyPassword(user, payload.Password) {
+		if err := h.loginGuard.Fail(payload.Email, ip); err != nil {
+			log.Printf("unable to record failed login: %v", err)
+		}
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidCredentials)
+		return
+	}
+
+	// Only tell a disabled user why they can't log in once they proved who they are.
+	if user.DisabledAt != nil {
+		utils.WriteError(w, r, http.StatusForbidden, errAccountDisabled)
+		return
+	}
+
+	// The failed logins are only reset once the second factor is checked too.
+	if user.HasTwoFactor() {
+		challengeToken, err := auth.CreateChallengeToken([]byte(config.Envs.JWTSecret), user.ID)
+		if err != nil {
+			utils.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		utils.WriteJson(w, http.StatusOK, map[string]any{
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+		})
+		return
+	}
+
+	if err := h.loginGuard.Succeed(payload.Email); err != nil {
+		log.Printf("unable to reset failed logins: %v", err)
+	}
+
 	secret := []byte(config.Envs.JWTSecret)
 	jwtToken, err := h.createJwtToken(secret, user.ID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.auditLogin(r, user.ID)
+	writeSession(w, r, payload.Session, jwtToken)
+}
+
+// writeSession returns the JWT, or sets it as a cookie for browser clients which asked for it so
+// scripts can't read it. They get the CSRF token to send with mutating requests instead.
+func writeSession(w http.ResponseWriter, r *http.Request, session string, jwtToken string) {
+	if session != auth.SessionCookie {
+		utils.WriteJson(w, http.StatusOK, map[string]string{"token": jwtToken})
+		return
+	}
+
+	csrfToken, err := auth.SetSessionCookies(w, jwtToken)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, map[string]string{"token": jwtToken})
+	utils.WriteJson(w, http.StatusOK, map[string]string{"csrfToken": csrfToken})
+}
+
+// handleLogout clears the session cookies. Tokens kept by other clients stay valid until they
+// expire, or until the sessions are revoked with a password change.
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	auth.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// auditLogin records a successful login. Failed ones are counted by the login guard instead.
+func (h *Handler) auditLogin(r *http.Request, userID int) {
+	event := audit.FromRequest(r, ActionLoggedIn)
+	event.ActorID = &userID
+	event.EntityType = "user"
+	event.EntityID = strconv.Itoa(userID)
+	if err := h.auditStore.CreateAuditEvent(event); err != nil {
+		log.Printf("unable to audit the login of user %d: %v", userID, err)
+	}
+}
+
+// verifyPassword checks the password of the user and upgrades its hash in place when it uses an
+// outdated algorithm or parameters. A failed upgrade doesn't fail the login.
+func (h *Handler) verifyPassword(user *types.User, plain string) bool {
+	ok, needsRehash := h.passwords.Verify(user.Password, plain)
+	if !ok || !needsRehash {
+		return ok
+	}
+
+	hashedPassword, err := h.passwords.Hash(plain)
+	if err == nil {
+		err = h.store.UpdatePassword(user.ID, hashedPassword)
+	}
+	if err != nil {
+		log.Printf("unable to rehash the password of user %d: %v", user.ID, err)
+	}
+
+	return true
+}
+
+// checkPasswordPolicy writes the policy violations of the password as errors on the field and returns
+// whether the password is allowed.
+func (h *Handler) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, field string, plain string, user *types.User) bool {
+	violations := h.passwordPolicy.Check(plain, user)
+	if len(violations) == 0 {
+		return true
+	}
+
+	fields := make([]utils.FieldError, len(violations))
+	for i, v := range violations {
+		fields[i] = utils.FieldError{Field: field, Rule: v.Rule, Message: v.Message}
+	}
+	utils.WriteFieldErrors(w, r, fields)
+	return false
 }
 
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	var payload types.RegisterUserRequest
 	err := utils.ParseJson(r, &payload)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", errors))
+		utils.WriteValidationError(w, r, err)
 		return
 	}
 
@@ -96,61 +262,251 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		utils.WriteError(
 			w,
+			r,
 			http.StatusBadRequest,
 			fmt.Errorf("user with email %s already exists", user.Email),
 		)
 		return
 	}
 
-	hashedPassword, err := h.hashPassword(payload.Password)
+	newUser := types.User{
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Email:     payload.Email,
+	}
+	if !h.checkPasswordPolicy(w, r, "password", payload.Password, &newUser) {
+		return
+	}
+
+	hashedPassword, err := h.passwords.Hash(payload.Password)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	id, err := h.store.CreateUser(types.User{
-		FirstName: payload.FirstName,
-		LastName:  payload.LastName,
-		Email:     payload.Email,
-		Password:  hashedPassword,
-	})
+	newUser.Password = hashedPassword
+	id, err := h.store.CreateUser(newUser, audit.FromRequest(r, ActionRegistered))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
+	// The account is created either way, the user can ask for another email if this one fails.
+	newUser.ID = id
+	if err := h.sendVerificationEmail(newUser); err != nil {
+		log.Printf("unable to send verification email to user %d: %v", id, err)
+	}
+
 	utils.WriteJson(w, http.StatusCreated, map[string]int{"id": id})
 }
 
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var payload types.VerifyEmailRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	userToken, err := h.tokenStore.ConsumeUserToken(types.TokenPurposeEmailVerification, token.Hash(payload.Token))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("verification token is invalid or expired"))
+		return
+	}
+
+	// The token stands for the user, who isn't signed in.
+	event := audit.FromRequest(r, ActionEmailVerified)
+	event.ActorID = &userToken.UserID
+	if err := h.store.SetEmailVerified(userToken.UserID, time.Now(), event); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResendVerification always accepts the request so it can't be used to find out which
+// emails are registered.
+func (h *Handler) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResendVerificationRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.store.GetUserByEmail(payload.Email)
+	if err == nil && user.EmailVerifiedAt == nil {
+		if err := h.tokenStore.DeleteUserTokens(user.ID, types.TokenPurposeEmailVerification); err != nil {
+			log.Printf("unable to delete verification tokens of user %d: %v", user.ID, err)
+		}
+		if err := h.sendVerificationEmail(*user); err != nil {
+			log.Printf("unable to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	utils.WriteJson(w, http.StatusAccepted, map[string]string{
+		"message": "if the email is registered and not verified yet, a verification link is on its way",
+	})
+}
+
+// handleForgotPassword always accepts the request so it can't be used to find out which emails
+// are registered.
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ForgotPasswordRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.store.GetUserByEmail(payload.Email)
+	if err == nil {
+		// Only the latest link works.
+		if err := h.tokenStore.DeleteUserTokens(user.ID, types.TokenPurposePasswordReset); err != nil {
+			log.Printf("unable to delete password reset tokens of user %d: %v", user.ID, err)
+		}
+		if err := h.sendPasswordResetEmail(*user); err != nil {
+			log.Printf("unable to send password reset email to user %d: %v", user.ID, err)
+		}
+	}
+
+	utils.WriteJson(w, http.StatusAccepted, map[string]string{
+		"message": "if the email is registered, a password reset link is on its way",
+	})
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResetPasswordRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	tokenHash := token.Hash(payload.Token)
+	userToken, err := h.tokenStore.GetUserToken(types.TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidResetToken)
+		return
+	}
+
+	user, err := h.store.GetUserByID(userToken.UserID)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !h.checkPasswordPolicy(w, r, "password", payload.Password, user) {
+		return
+	}
+
+	hashedPassword, err := h.passwords.Hash(payload.Password)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The single-use token is only consumed once the password is accepted, so a user whose
+	// password breaks the policy can pick another one with the same link.
+	if _, err := h.tokenStore.ConsumeUserToken(types.TokenPurposePasswordReset, tokenHash); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidResetToken)
+		return
+	}
+
+	// Whoever knew the old password may still hold a token. The reset token stands for the user,
+	// who isn't signed in.
+	event := audit.FromRequest(r, ActionPasswordReset)
+	event.ActorID = &user.ID
+	if err := h.store.ChangePassword(user.ID, hashedPassword, time.Now(), event); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Proving access to the email also lifts a login lockout.
+	if err := h.loginGuard.Succeed(user.Email); err != nil {
+		log.Printf("unable to reset failed logins of user %d: %v", user.ID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetUsers returns a page of the users whose email or name contains the `search` query param.
 func (h *Handler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.store.GetUsers()
+	page, pageSize, err := utils.ParsePagination(r)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, users)
+	users, total, err := h.store.SearchUsers(types.UserSearch{
+		Query:  strings.TrimSpace(r.URL.Query().Get("search")),
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	})
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, types.UserPage{
+		Users:    users,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
 }
 
 func (h *Handler) handleGetUserById(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	strId, ok := vars["id"]
 	if !ok {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing user id"))
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("missing user id"))
 		return
 	}
 
 	id, err := strconv.Atoi(strId)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	user, err := h.store.GetUserByID(id)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJson(w, http.StatusOK, user)
 }
+
+func (h *Handler) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	adminID := auth.GetUserIDFromContext(r.Context())
+	if err := h.loginGuard.Unlock(*user, adminID, utils.ClientIP(r)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
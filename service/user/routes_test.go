@@ -2,14 +2,27 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/service/lockout"
+	"github.com/sebastian-nunez/golang-store-api/service/mail"
+	"github.com/sebastian-nunez/golang-store-api/service/password"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/service/totp"
 	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
 )
 
 const (
@@ -17,8 +30,19 @@ const (
 	existingEmail      = "exists@google.com"
 	unhashablePassword = "unhashable password"
 	correctPassword    = "1234"
+	strongPassword     = "correct horse battery"
 	badJwtEmail        = "badjwt@google.com"
+	disabledEmail      = "disabled@google.com"
 	badUserId          = 999
+
+	twoFactorEmail         = "2fa@google.com"
+	twoFactorUserId        = 2
+	pendingTwoFactorUserId = 3
+	twoFactorSecret        = "JBSWY3DPEHPK3PXP"
+	recoveryCode           = "aaaa-bbbb"
+
+	adminUserId   = 42
+	missingUserId = 404
 )
 
 func TestUserService(t *testing.T) {
@@ -28,16 +52,22 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		payload := types.RegisterUserRequest{
 			FirstName: "Sebastian",
 			LastName:  "Nunez",
 			Email:     "snunez@gmail.com", // new email
-			Password:  "1234",
+			Password:  strongPassword,
 		}
 		marshalled, _ := json.Marshal(payload)
 
@@ -60,9 +90,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		invalidEmail := "invalid"
@@ -93,9 +129,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		payload := types.RegisterUserRequest{
@@ -125,16 +167,22 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		payload := types.RegisterUserRequest{
 			FirstName: "Sebastian",
 			LastName:  "Nunez",
 			Email:     errorEmail,
-			Password:  "1234",
+			Password:  strongPassword,
 		}
 		marshalled, _ := json.Marshal(payload)
 
@@ -153,18 +201,120 @@ func TestUserService(t *testing.T) {
 		}
 	})
 
+	t.Run("should fail to register given a password which breaks the password policy", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			password string
+			wantRule string
+		}{
+			{name: "too short", password: "x7$kq", wantRule: "min"},
+			{name: "contains the name", password: "sebastian-2024!", wantRule: "personal_info"},
+			{name: "breached", password: "password123", wantRule: "breached"},
+		}
+
+		for _, tt := range tests {
+			handler := NewHandler(
+				&mockUserStore{},
+				&mockPasswordHasher{},
+				mockPasswordPolicy,
+				mockCreateJWTToken,
+				newMockLoginGuard(),
+				&mockUserTokenStore{},
+				&mockMailer{},
+				&mockTwoFactorStore{},
+				&mockOrderStore{},
+				&mockAuditStore{},
+			)
+
+			payload := types.RegisterUserRequest{
+				FirstName: "Sebastian",
+				LastName:  "Nunez",
+				Email:     "snunez@gmail.com",
+				Password:  tt.password,
+			}
+			marshalled, _ := json.Marshal(payload)
+
+			req, err := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/register", handler.handleRegister)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: want status code %d and got %d", tt.name, http.StatusBadRequest, rr.Code)
+			}
+
+			var problem utils.Problem
+			json.NewDecoder(rr.Body).Decode(&problem)
+			if len(problem.Errors) != 1 || problem.Errors[0].Field != "password" || problem.Errors[0].Rule != tt.wantRule {
+				t.Errorf("%s: want a %q error on the password and got %v", tt.name, tt.wantRule, problem.Errors)
+			}
+		}
+	})
+
 	t.Run("should successfully login an existing user", func(t *testing.T) {
 		mockUserStore := &mockUserStore{}
+		auditStore := &mockAuditStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			auditStore,
+		)
+
+		payload := types.LoginUserRequest{
+			Email:    existingEmail,
+			Password: correctPassword,
+		}
+		marshalled, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		if len(auditStore.events) != 1 || auditStore.events[0].Action != ActionLoggedIn {
+			t.Errorf("want the login to be audited and got %v", auditStore.events)
+		}
+	})
+
+	t.Run("should set the session cookies of a browser client instead of returning the token", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		payload := types.LoginUserRequest{
 			Email:    existingEmail,
 			Password: correctPassword,
+			Session:  auth.SessionCookie,
 		}
 		marshalled, _ := json.Marshal(payload)
 
@@ -181,15 +331,98 @@ func TestUserService(t *testing.T) {
 		if rr.Code != http.StatusOK {
 			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
 		}
+
+		var res map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res["token"] != "" || res["csrfToken"] == "" {
+			t.Errorf("want only the CSRF token in the response and got %v", res)
+		}
+
+		if len(rr.Result().Cookies()) != 2 {
+			t.Errorf("want the session and CSRF cookies and got %v", rr.Result().Cookies())
+		}
+	})
+
+	t.Run("should fail to login a disabled user", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.LoginUserRequest{Email: disabledEmail, Password: correctPassword})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("want status code %d and got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should rehash an outdated password on login", func(t *testing.T) {
+		mockUserStore := &mockUserStore{}
+		handler := NewHandler(
+			mockUserStore,
+			&mockPasswordHasher{needsRehash: true},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.LoginUserRequest{Email: existingEmail, Password: correctPassword})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		if mockUserStore.updatedPassword != "hashed" {
+			t.Errorf("want the password to be rehashed and got %q", mockUserStore.updatedPassword)
+		}
 	})
 
 	t.Run("should fail to login given an invalid payload", func(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		req, err := http.NewRequest(http.MethodPost, "/login", nil)
@@ -211,9 +444,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		payload := types.LoginUserRequest{
@@ -241,9 +480,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		payload := types.LoginUserRequest{
@@ -271,9 +516,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		payload := types.LoginUserRequest{
@@ -301,9 +552,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		req, err := http.NewRequest(http.MethodGet, "/users", nil)
@@ -325,9 +582,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{err: fmt.Errorf("internal DB error")}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		req, err := http.NewRequest(http.MethodGet, "/users", nil)
@@ -349,9 +612,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		req, err := http.NewRequest(http.MethodGet, "/users/1", nil)
@@ -373,9 +642,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		req, err := http.NewRequest(http.MethodGet, "/users/invalid", nil)
@@ -397,9 +672,15 @@ func TestUserService(t *testing.T) {
 		mockUserStore := &mockUserStore{err: fmt.Errorf("internal DB error")}
 		handler := NewHandler(
 			mockUserStore,
-			mockHashPassword,
-			mockComparePassword,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
 			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
 		)
 
 		req, err := http.NewRequest(http.MethodGet, "/users/1", nil)
@@ -416,63 +697,1327 @@ func TestUserService(t *testing.T) {
 			t.Errorf("want status code %d and got %d", http.StatusInternalServerError, rr.Code)
 		}
 	})
-}
+	t.Run("should fail to login a locked account with the same response as an unknown email", func(t *testing.T) {
+		mockUserStore := &mockUserStore{}
+		handler := NewHandler(
+			mockUserStore,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
 
-type mockUserStore struct {
-	err error
-}
+		router := mux.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin)
+		login := func(email string, password string) *httptest.ResponseRecorder {
+			marshalled, _ := json.Marshal(types.LoginUserRequest{Email: email, Password: password})
+			req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
 
-func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
-	if email == existingEmail {
-		return &types.User{
-			ID:        1,
-			FirstName: "Sebastian",
-			LastName:  "Nunez",
-			Email:     existingEmail,
-			Password:  "hashed password",
-		}, nil
-	}
-	if email == badJwtEmail {
-		return &types.User{
-			ID:        badUserId,
-			FirstName: "Sebastian",
-			LastName:  "Nunez",
-			Email:     existingEmail,
-			Password:  "hashed password",
-		}, nil
-	}
-	return nil, fmt.Errorf("user does not exists")
-}
+		for i := 0; i < 3; i++ {
+			login(existingEmail, "incorrect password")
+		}
 
-func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
-	return &types.User{}, m.err
-}
+		locked := login(existingEmail, correctPassword)
+		if locked.Code != http.StatusBadRequest {
+			t.Errorf("want status code %d and got %d", http.StatusBadRequest, locked.Code)
+		}
 
-func (m *mockUserStore) CreateUser(user types.User) (int, error) {
-	if user.Email == errorEmail {
-		return 0, fmt.Errorf("unable to create user")
-	}
-	return 1, nil
-}
+		unknown := login("unknown@google.com", correctPassword)
+		if locked.Body.String() != unknown.Body.String() {
+			t.Errorf("want identical responses and got %q and %q", locked.Body.String(), unknown.Body.String())
+		}
+	})
 
-func (m *mockUserStore) GetUsers() ([]types.User, error) {
-	return nil, m.err
-}
+	t.Run("should successfully unlock a user", func(t *testing.T) {
+		mockUserStore := &mockUserStore{}
+		handler := NewHandler(
+			mockUserStore,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
 
-func mockHashPassword(password string) (string, error) {
-	if password == unhashablePassword {
-		return "", fmt.Errorf("unable to hash password")
-	}
-	return "hashed", nil
-}
+		req, err := http.NewRequest(http.MethodPost, "/users/1/unlock", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-func mockComparePassword(password string, plain string) bool {
-	return plain == correctPassword
-}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/{id}/unlock", handler.handleUnlockUser)
+		router.ServeHTTP(rr, req)
 
-func mockCreateJWTToken(secret []byte, userId int) (string, error) {
-	if userId == badUserId {
-		return "", fmt.Errorf("bad user id, unable to create token")
-	}
-	return "some token", nil
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("want status code %d and got %d", http.StatusNoContent, rr.Code)
+		}
+	})
+
+	t.Run("should fail to unlock a user that does not exist", func(t *testing.T) {
+		mockUserStore := &mockUserStore{err: fmt.Errorf("user not found")}
+		handler := NewHandler(
+			mockUserStore,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		req, err := http.NewRequest(http.MethodPost, "/users/1/unlock", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/{id}/unlock", handler.handleUnlockUser)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("want status code %d and got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+	t.Run("should successfully verify an email given a valid token", func(t *testing.T) {
+		plain, hash, _ := token.New()
+		mockTokenStore := &mockUserTokenStore{
+			created: []types.UserToken{{UserID: 1, Purpose: types.TokenPurposeEmailVerification, TokenHash: hash}},
+		}
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			mockTokenStore,
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.VerifyEmailRequest{Token: plain})
+		req, err := http.NewRequest(http.MethodPost, "/auth/verify-email", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/auth/verify-email", handler.handleVerifyEmail)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("want status code %d and got %d", http.StatusNoContent, rr.Code)
+		}
+	})
+
+	t.Run("should fail to verify an email given an unknown token", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.VerifyEmailRequest{Token: "unknown"})
+		req, err := http.NewRequest(http.MethodPost, "/auth/verify-email", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/auth/verify-email", handler.handleVerifyEmail)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("want status code %d and got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should accept a verification resend whether or not the email exists", func(t *testing.T) {
+		for _, email := range []string{existingEmail, "unknown@google.com"} {
+			mockTokenStore := &mockUserTokenStore{}
+			handler := NewHandler(
+				&mockUserStore{},
+				&mockPasswordHasher{},
+				mockPasswordPolicy,
+				mockCreateJWTToken,
+				newMockLoginGuard(),
+				mockTokenStore,
+				&mockMailer{},
+				&mockTwoFactorStore{},
+				&mockOrderStore{},
+				&mockAuditStore{},
+			)
+
+			marshalled, _ := json.Marshal(types.ResendVerificationRequest{Email: email})
+			req, err := http.NewRequest(http.MethodPost, "/auth/resend-verification", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/auth/resend-verification", handler.handleResendVerification)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusAccepted {
+				t.Errorf("want status code %d and got %d", http.StatusAccepted, rr.Code)
+			}
+
+			wantTokens := 0
+			if email == existingEmail {
+				wantTokens = 1
+			}
+			if len(mockTokenStore.created) != wantTokens {
+				t.Errorf("want %d verification tokens for %s and got %d", wantTokens, email, len(mockTokenStore.created))
+			}
+		}
+	})
+	t.Run("should accept a password reset request whether or not the email exists", func(t *testing.T) {
+		for _, email := range []string{existingEmail, "unknown@google.com"} {
+			mockTokenStore := &mockUserTokenStore{}
+			handler := NewHandler(
+				&mockUserStore{},
+				&mockPasswordHasher{},
+				mockPasswordPolicy,
+				mockCreateJWTToken,
+				newMockLoginGuard(),
+				mockTokenStore,
+				&mockMailer{},
+				&mockTwoFactorStore{},
+				&mockOrderStore{},
+				&mockAuditStore{},
+			)
+
+			marshalled, _ := json.Marshal(types.ForgotPasswordRequest{Email: email})
+			req, err := http.NewRequest(http.MethodPost, "/auth/forgot-password", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/auth/forgot-password", handler.handleForgotPassword)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusAccepted {
+				t.Errorf("want status code %d and got %d", http.StatusAccepted, rr.Code)
+			}
+
+			wantTokens := 0
+			if email == existingEmail {
+				wantTokens = 1
+			}
+			if len(mockTokenStore.created) != wantTokens {
+				t.Errorf("want %d reset tokens for %s and got %d", wantTokens, email, len(mockTokenStore.created))
+			}
+		}
+	})
+
+	t.Run("should successfully reset a password given a valid token", func(t *testing.T) {
+		plain, hash, _ := token.New()
+		mockTokenStore := &mockUserTokenStore{
+			created: []types.UserToken{{UserID: 1, Purpose: types.TokenPurposePasswordReset, TokenHash: hash}},
+		}
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			mockTokenStore,
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.ResetPasswordRequest{Token: plain, Password: "new password"})
+		req, err := http.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/auth/reset-password", handler.handleResetPassword)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("want status code %d and got %d", http.StatusNoContent, rr.Code)
+		}
+	})
+
+	t.Run("should fail to reset a password given a verification token", func(t *testing.T) {
+		plain, hash, _ := token.New()
+		mockTokenStore := &mockUserTokenStore{
+			created: []types.UserToken{{UserID: 1, Purpose: types.TokenPurposeEmailVerification, TokenHash: hash}},
+		}
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			mockTokenStore,
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.ResetPasswordRequest{Token: plain, Password: "new password"})
+		req, err := http.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/auth/reset-password", handler.handleResetPassword)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("want status code %d and got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should fail to reset a password which breaks the password policy", func(t *testing.T) {
+		plain, hash, _ := token.New()
+		mockTokenStore := &mockUserTokenStore{
+			created: []types.UserToken{{UserID: 1, Purpose: types.TokenPurposePasswordReset, TokenHash: hash}},
+		}
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			mockTokenStore,
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.ResetPasswordRequest{Token: plain, Password: "password123"})
+		req, err := http.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/auth/reset-password", handler.handleResetPassword)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("want status code %d and got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should keep the reset token usable after a password containing personal info", func(t *testing.T) {
+		plain, hash, _ := token.New()
+		mockTokenStore := &mockUserTokenStore{
+			created: []types.UserToken{{UserID: twoFactorUserId, Purpose: types.TokenPurposePasswordReset, TokenHash: hash}},
+		}
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			mockTokenStore,
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+		router := mux.NewRouter()
+		router.HandleFunc("/auth/reset-password", handler.handleResetPassword)
+
+		for _, tc := range []struct {
+			password string
+			wantCode int
+		}{
+			{password: "my-2fa-horse-staple", wantCode: http.StatusBadRequest},
+			{password: "correct-horse-staple", wantCode: http.StatusNoContent},
+			{password: "another-horse-staple", wantCode: http.StatusBadRequest},
+		} {
+			marshalled, _ := json.Marshal(types.ResetPasswordRequest{Token: plain, Password: tc.password})
+			req, err := http.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("%s: want status code %d and got %d", tc.password, tc.wantCode, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should return a challenge token when logging in a user with 2FA", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.LoginUserRequest{Email: twoFactorEmail, Password: correctPassword})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		var body map[string]any
+		json.NewDecoder(rr.Body).Decode(&body)
+		if body["twoFactorRequired"] != true || body["challengeToken"] == "" || body["token"] != nil {
+			t.Errorf("want a challenge token instead of a session token and got %v", body)
+		}
+	})
+
+	t.Run("should exchange a challenge token and a second factor for a session token", func(t *testing.T) {
+		code, _ := totp.Code(twoFactorSecret, time.Now())
+
+		tests := []struct {
+			name       string
+			code       string
+			wantStatus int
+		}{
+			{name: "valid TOTP code", code: code, wantStatus: http.StatusOK},
+			{name: "valid recovery code", code: "AAAABBBB", wantStatus: http.StatusOK},
+			{name: "invalid code", code: "000000", wantStatus: http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			handler := NewHandler(
+				&mockUserStore{},
+				&mockPasswordHasher{},
+				mockPasswordPolicy,
+				mockCreateJWTToken,
+				newMockLoginGuard(),
+				&mockUserTokenStore{},
+				&mockMailer{},
+				&mockTwoFactorStore{},
+				&mockOrderStore{},
+				&mockAuditStore{},
+			)
+
+			challengeToken, _ := auth.CreateChallengeToken([]byte(config.Envs.JWTSecret), twoFactorUserId)
+			marshalled, _ := json.Marshal(types.LoginTwoFactorRequest{ChallengeToken: challengeToken, Code: tt.code})
+			req, err := http.NewRequest(http.MethodPost, "/login/2fa", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/login/2fa", handler.handleLoginTwoFactor)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("%s: want status code %d and got %d", tt.name, tt.wantStatus, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should fail to exchange a session token for another one", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		sessionToken, _ := auth.CreateJWTToken([]byte(config.Envs.JWTSecret), twoFactorUserId)
+		code, _ := totp.Code(twoFactorSecret, time.Now())
+		marshalled, _ := json.Marshal(types.LoginTwoFactorRequest{ChallengeToken: sessionToken, Code: code})
+		req, err := http.NewRequest(http.MethodPost, "/login/2fa", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/login/2fa", handler.handleLoginTwoFactor)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("want status code %d and got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should successfully start a 2FA enrollment", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		req, err := http.NewRequest(http.MethodPost, "/users/me/2fa/enroll", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/2fa/enroll", handler.handleEnrollTwoFactor)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		var body map[string]string
+		json.NewDecoder(rr.Body).Decode(&body)
+		if !strings.HasPrefix(body["otpauthUri"], "otpauth://totp/") {
+			t.Errorf("want an otpauth URI and got %q", body["otpauthUri"])
+		}
+	})
+
+	t.Run("should confirm a 2FA enrollment and return recovery codes", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		code, _ := totp.Code(twoFactorSecret, time.Now())
+		marshalled, _ := json.Marshal(types.TwoFactorCodeRequest{Code: code})
+		req, err := http.NewRequest(http.MethodPost, "/users/me/2fa/confirm", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, pendingTwoFactorUserId))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/2fa/confirm", handler.handleConfirmTwoFactor)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		var body map[string][]string
+		json.NewDecoder(rr.Body).Decode(&body)
+		if len(body["recoveryCodes"]) != recoveryCodesCount {
+			t.Errorf("want %d recovery codes and got %v", recoveryCodesCount, body["recoveryCodes"])
+		}
+	})
+
+	t.Run("should fail to enroll a user who already has 2FA", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		req, err := http.NewRequest(http.MethodPost, "/users/me/2fa/enroll", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, twoFactorUserId))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/2fa/enroll", handler.handleEnrollTwoFactor)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("want status code %d and got %d", http.StatusConflict, rr.Code)
+		}
+	})
+	t.Run("should return the current user", func(t *testing.T) {
+		handler := NewHandler(
+			&mockUserStore{},
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		req, err := http.NewRequest(http.MethodGet, "/users/me", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, twoFactorUserId))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me", handler.handleGetCurrentUser)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		var user types.User
+		json.NewDecoder(rr.Body).Decode(&user)
+		if user.Email != twoFactorEmail {
+			t.Errorf("want the current user and got %q", user.Email)
+		}
+	})
+
+	t.Run("should update the name of the current user", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			payload    string
+			wantStatus int
+		}{
+			{name: "both names", payload: `{"firstName": "Ada", "lastName": "Lovelace"}`, wantStatus: http.StatusOK},
+			{name: "first name only", payload: `{"firstName": "Ada"}`, wantStatus: http.StatusOK},
+			{name: "empty last name", payload: `{"lastName": ""}`, wantStatus: http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			handler := NewHandler(
+				&mockUserStore{},
+				&mockPasswordHasher{},
+				mockPasswordPolicy,
+				mockCreateJWTToken,
+				newMockLoginGuard(),
+				&mockUserTokenStore{},
+				&mockMailer{},
+				&mockTwoFactorStore{},
+				&mockOrderStore{},
+				&mockAuditStore{},
+			)
+
+			req, err := http.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/users/me", handler.handleUpdateCurrentUser)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("%s: want status code %d and got %d", tt.name, tt.wantStatus, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should change the password and revoke the other sessions", func(t *testing.T) {
+		mockUserStore := &mockUserStore{}
+		handler := NewHandler(
+			mockUserStore,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.ChangePasswordRequest{CurrentPassword: correctPassword, NewPassword: strongPassword})
+		req, err := http.NewRequest(http.MethodPost, "/users/me/password", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/password", handler.handleChangePassword)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		if mockUserStore.updatedPassword != "hashed" || !mockUserStore.revokedSessions {
+			t.Error("want the password to be updated and the sessions to be revoked")
+		}
+
+		var body map[string]string
+		json.NewDecoder(rr.Body).Decode(&body)
+		if body["token"] == "" {
+			t.Error("want a new token for the current session")
+		}
+	})
+
+	t.Run("should fail to change the password", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			payload types.ChangePasswordRequest
+		}{
+			{name: "incorrect current password", payload: types.ChangePasswordRequest{CurrentPassword: "incorrect password", NewPassword: strongPassword}},
+			{name: "breached new password", payload: types.ChangePasswordRequest{CurrentPassword: correctPassword, NewPassword: "password123"}},
+		}
+
+		for _, tt := range tests {
+			mockUserStore := &mockUserStore{}
+			handler := NewHandler(
+				mockUserStore,
+				&mockPasswordHasher{},
+				mockPasswordPolicy,
+				mockCreateJWTToken,
+				newMockLoginGuard(),
+				&mockUserTokenStore{},
+				&mockMailer{},
+				&mockTwoFactorStore{},
+				&mockOrderStore{},
+				&mockAuditStore{},
+			)
+
+			marshalled, _ := json.Marshal(tt.payload)
+			req, err := http.NewRequest(http.MethodPost, "/users/me/password", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/users/me/password", handler.handleChangePassword)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: want status code %d and got %d", tt.name, http.StatusBadRequest, rr.Code)
+			}
+
+			if mockUserStore.updatedPassword != "" {
+				t.Errorf("%s: want the password to be unchanged", tt.name)
+			}
+		}
+	})
+
+	t.Run("should change the email and send a verification email", func(t *testing.T) {
+		mockUserStore := &mockUserStore{}
+		mockTokenStore := &mockUserTokenStore{
+			created: []types.UserToken{
+				{UserID: twoFactorUserId, Purpose: types.TokenPurposeEmailVerification, TokenHash: "sent to the old address"},
+				{UserID: twoFactorUserId, Purpose: types.TokenPurposePasswordReset, TokenHash: "sent to the old address"},
+			},
+		}
+		handler := NewHandler(
+			mockUserStore,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			mockTokenStore,
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.ChangeEmailRequest{Email: "new@google.com", CurrentPassword: correctPassword})
+		req, err := http.NewRequest(http.MethodPost, "/users/me/email", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, twoFactorUserId))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/email", handler.handleChangeEmail)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status code %d and got %d", http.StatusOK, rr.Code)
+		}
+
+		if mockUserStore.updatedEmail != "new@google.com" {
+			t.Errorf("want the email to be updated and got %q", mockUserStore.updatedEmail)
+		}
+
+		// Only the new verification token is left, the links sent to the old address are gone.
+		created := mockTokenStore.created
+		if len(created) != 1 || created[0].Purpose != types.TokenPurposeEmailVerification || created[0].TokenHash == "sent to the old address" {
+			t.Errorf("want only a new verification token and got %v", mockTokenStore.created)
+		}
+	})
+
+	t.Run("should fail to change the email to one which is taken", func(t *testing.T) {
+		mockUserStore := &mockUserStore{}
+		handler := NewHandler(
+			mockUserStore,
+			&mockPasswordHasher{},
+			mockPasswordPolicy,
+			mockCreateJWTToken,
+			newMockLoginGuard(),
+			&mockUserTokenStore{},
+			&mockMailer{},
+			&mockTwoFactorStore{},
+			&mockOrderStore{},
+			&mockAuditStore{},
+		)
+
+		marshalled, _ := json.Marshal(types.ChangeEmailRequest{Email: existingEmail, CurrentPassword: correctPassword})
+		req, err := http.NewRequest(http.MethodPost, "/users/me/email", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/users/me/email", handler.handleChangeEmail)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("want status code %d and got %d", http.StatusConflict, rr.Code)
+		}
+
+		if mockUserStore.updatedEmail != "" {
+			t.Error("want the email to be unchanged")
+		}
+	})
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		method     string
+		endpoint   string
+		payload    any
+		mockErr    error
+		wantStatus int
+		wantAudit  string
+	}{
+		{
+			name:       "should list the first page of users",
+			method:     http.MethodGet,
+			endpoint:   "/users?search=nunez",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should fail to list users given an invalid page",
+			method:     http.MethodGet,
+			endpoint:   "/users?page=0",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail to list users given a page size over the max",
+			method:     http.MethodGet,
+			endpoint:   "/users?pageSize=1000",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail to list users if there was a database error",
+			method:     http.MethodGet,
+			endpoint:   "/users",
+			mockErr:    fmt.Errorf("internal DB error"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "should disable a user",
+			method:     http.MethodPost,
+			endpoint:   "/users/1/disable",
+			wantStatus: http.StatusNoContent,
+			wantAudit:  ActionDisabled,
+		},
+		{
+			name:       "should fail to disable the admin making the request",
+			method:     http.MethodPost,
+			endpoint:   fmt.Sprintf("/users/%d/disable", adminUserId),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail to disable a user who doesn't exist",
+			method:     http.MethodPost,
+			endpoint:   fmt.Sprintf("/users/%d/disable", missingUserId),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "should enable a user",
+			method:     http.MethodPost,
+			endpoint:   "/users/1/enable",
+			wantStatus: http.StatusNoContent,
+			wantAudit:  ActionEnabled,
+		},
+		{
+			name:       "should change the role of a user",
+			method:     http.MethodPut,
+			endpoint:   "/users/1/role",
+			payload:    types.UpdateRoleRequest{Role: types.RoleAdmin},
+			wantStatus: http.StatusOK,
+			wantAudit:  ActionRoleChanged,
+		},
+		{
+			name:       "should fail to change the role of a user given an unknown role",
+			method:     http.MethodPut,
+			endpoint:   "/users/1/role",
+			payload:    types.UpdateRoleRequest{Role: "superuser"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail to change the role of the admin making the request",
+			method:     http.MethodPut,
+			endpoint:   fmt.Sprintf("/users/%d/role", adminUserId),
+			payload:    types.UpdateRoleRequest{Role: types.RoleCustomer},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should force a password reset",
+			method:     http.MethodPost,
+			endpoint:   "/users/1/password-reset",
+			wantStatus: http.StatusAccepted,
+			wantAudit:  ActionPasswordResetForced,
+		},
+		{
+			name:       "should list the orders of a user",
+			method:     http.MethodGet,
+			endpoint:   "/users/1/orders",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should fail to list the orders of a user given an invalid id",
+			method:     http.MethodGet,
+			endpoint:   "/users/invalid/orders",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should impersonate a customer",
+			method:     http.MethodPost,
+			endpoint:   "/admin/users/1/impersonate",
+			wantStatus: http.StatusOK,
+			wantAudit:  ActionImpersonationStarted,
+		},
+		{
+			name:       "should fail to impersonate an admin",
+			method:     http.MethodPost,
+			endpoint:   fmt.Sprintf("/admin/users/%d/impersonate", adminUserId),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should fail to impersonate a user who doesn't exist",
+			method:     http.MethodPost,
+			endpoint:   fmt.Sprintf("/admin/users/%d/impersonate", missingUserId),
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			userStore := &mockUserStore{err: tc.mockErr}
+			auditStore := &mockAuditStore{}
+			handler := NewHandler(
+				userStore,
+				&mockPasswordHasher{},
+				mockPasswordPolicy,
+				mockCreateJWTToken,
+				newMockLoginGuard(),
+				&mockUserTokenStore{},
+				&mockMailer{},
+				&mockTwoFactorStore{},
+				&mockOrderStore{},
+				auditStore,
+			)
+
+			var bodyBytes []byte
+			if tc.payload != nil {
+				var err error
+				bodyBytes, err = json.Marshal(tc.payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req, err := http.NewRequest(tc.method, tc.endpoint, bytes.NewBuffer(bodyBytes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, adminUserId))
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/users", handler.handleGetUsers).Methods(http.MethodGet)
+			router.HandleFunc("/users/{id}/disable", handler.handleDisableUser).Methods(http.MethodPost)
+			router.HandleFunc("/users/{id}/enable", handler.handleEnableUser).Methods(http.MethodPost)
+			router.HandleFunc("/users/{id}/role", handler.handleUpdateUserRole).Methods(http.MethodPut)
+			router.HandleFunc("/users/{id}/password-reset", handler.handleForcePasswordReset).Methods(http.MethodPost)
+			router.HandleFunc("/users/{id}/orders", handler.handleGetUserOrders).Methods(http.MethodGet)
+			router.HandleFunc("/admin/users/{id}/impersonate", handler.handleImpersonateUser).Methods(http.MethodPost)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Errorf("want status code %d and got %d", tc.wantStatus, rr.Code)
+			}
+
+			events := append(auditStore.events, userStore.events...)
+			if tc.wantAudit != "" && (len(events) != 1 || events[0].Action != tc.wantAudit || *events[0].ActorID != adminUserId) {
+				t.Errorf("want a %q audit event by the admin and got %v", tc.wantAudit, events)
+			}
+		})
+	}
+}
+
+type mockUserStore struct {
+	err             error
+	updatedPassword string
+	updatedEmail    string
+	revokedSessions bool
+	// events are the audit events recorded along with a change.
+	events []types.AuditEvent
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	if email == twoFactorEmail {
+		return m.GetUserByID(twoFactorUserId)
+	}
+	if email == existingEmail {
+		return &types.User{
+			ID:        1,
+			FirstName: "Sebastian",
+			LastName:  "Nunez",
+			Email:     existingEmail,
+			Password:  "hashed password",
+		}, nil
+	}
+	if email == disabledEmail {
+		disabledAt := time.Now()
+		return &types.User{ID: 5, Email: disabledEmail, Password: "hashed password", DisabledAt: &disabledAt}, nil
+	}
+	if email == badJwtEmail {
+		return &types.User{
+			ID:        badUserId,
+			FirstName: "Sebastian",
+			LastName:  "Nunez",
+			Email:     existingEmail,
+			Password:  "hashed password",
+		}, nil
+	}
+	return nil, fmt.Errorf("user does not exists")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if id == twoFactorUserId {
+		enabledAt := time.Now()
+		return &types.User{
+			ID:            twoFactorUserId,
+			Email:         twoFactorEmail,
+			Password:      "hashed password",
+			TOTPSecret:    twoFactorSecret,
+			TOTPEnabledAt: &enabledAt,
+		}, m.err
+	}
+	if id == pendingTwoFactorUserId {
+		return &types.User{ID: pendingTwoFactorUserId, TOTPSecret: twoFactorSecret}, m.err
+	}
+	if id == missingUserId {
+		return nil, fmt.Errorf("user does not exists")
+	}
+	if id == adminUserId {
+		return &types.User{ID: adminUserId, Role: types.RoleAdmin}, m.err
+	}
+	return &types.User{ID: id}, m.err
+}
+
+func (m *mockUserStore) CreateUser(user types.User, event types.AuditEvent) (int, error) {
+	if user.Email == errorEmail {
+		return 0, fmt.Errorf("unable to create user")
+	}
+	m.events = append(m.events, event)
+	return 1, nil
+}
+
+func (m *mockUserStore) SearchUsers(search types.UserSearch) ([]types.User, int, error) {
+	return []types.User{}, 0, m.err
+}
+
+func (m *mockUserStore) SetEmailVerified(id int, verifiedAt time.Time, event types.AuditEvent) error {
+	return m.record(event)
+}
+
+func (m *mockUserStore) UpdatePassword(id int, hashedPassword string) error {
+	m.updatedPassword = hashedPassword
+	return m.err
+}
+
+func (m *mockUserStore) ChangePassword(id int, hashedPassword string, revokedAt time.Time, event types.AuditEvent) error {
+	m.updatedPassword = hashedPassword
+	m.revokedSessions = true
+	return m.record(event)
+}
+
+func (m *mockUserStore) UpdateProfile(id int, firstName string, lastName string, event types.AuditEvent) error {
+	return m.record(event)
+}
+
+func (m *mockUserStore) UpdateEmail(id int, email string, event types.AuditEvent) error {
+	m.updatedEmail = email
+	return m.record(event)
+}
+
+func (m *mockUserStore) AnonymizeUser(id int, deletedAt time.Time, event types.AuditEvent) error {
+	return m.record(event)
+}
+
+func (m *mockUserStore) SetDisabled(id int, disabledAt *time.Time, event types.AuditEvent) error {
+	return m.record(event)
+}
+
+func (m *mockUserStore) UpdateRole(id int, role string, event types.AuditEvent) error {
+	return m.record(event)
+}
+
+// record keeps the event of a change unless the change fails.
+func (m *mockUserStore) record(event types.AuditEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+var mockPasswordPolicy = password.Policy{MinLength: 8, Breached: password.BundledBreachedList()}
+
+type mockPasswordHasher struct {
+	// needsRehash makes every matching password ask for a rehash.
+	needsRehash bool
+}
+
+func (m *mockPasswordHasher) Hash(password string) (string, error) {
+	if password == unhashablePassword {
+		return "", fmt.Errorf("unable to hash password")
+	}
+	return "hashed", nil
+}
+
+func (m *mockPasswordHasher) Verify(hashed string, plain string) (bool, bool) {
+	ok := plain == correctPassword
+	return ok, ok && m.needsRehash
+}
+
+func mockCreateJWTToken(secret []byte, userId int) (string, error) {
+	if userId == badUserId {
+		return "", fmt.Errorf("bad user id, unable to create token")
+	}
+	return "some token", nil
+}
+
+type mockUserTokenStore struct {
+	created []types.UserToken
+}
+
+func (m *mockUserTokenStore) CreateUserToken(token types.UserToken) error {
+	m.created = append(m.created, token)
+	return nil
+}
+
+func (m *mockUserTokenStore) GetUserToken(purpose string, tokenHash string) (*types.UserToken, error) {
+	for _, t := range m.created {
+		if t.Purpose == purpose && t.TokenHash == tokenHash && t.UsedAt == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("token is invalid or expired")
+}
+
+func (m *mockUserTokenStore) ConsumeUserToken(purpose string, tokenHash string) (*types.UserToken, error) {
+	for i, t := range m.created {
+		if t.Purpose == purpose && t.TokenHash == tokenHash && t.UsedAt == nil {
+			usedAt := time.Now()
+			m.created[i].UsedAt = &usedAt
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("token is invalid or expired")
+}
+
+func (m *mockUserTokenStore) DeleteUserTokens(userID int, purpose string) error {
+	m.created = slices.DeleteFunc(m.created, func(t types.UserToken) bool {
+		return t.UserID == userID && t.Purpose == purpose
+	})
+	return nil
+}
+
+type mockTwoFactorStore struct {
+	// events are the audit events recorded along with a change.
+	events []types.AuditEvent
+}
+
+func (m *mockTwoFactorStore) SetTOTPSecret(userID int, secret string) error {
+	return nil
+}
+
+func (m *mockTwoFactorStore) EnableTOTP(userID int, enabledAt time.Time, codeHashes []string, event types.AuditEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockTwoFactorStore) DisableTOTP(userID int, event types.AuditEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockTwoFactorStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	return true, nil
+}
+
+func (m *mockTwoFactorStore) ConsumeRecoveryCode(userID int, codeHash string) (bool, error) {
+	return codeHash == token.Hash(recoveryCode), nil
+}
+
+type mockMailer struct{}
+
+func (m *mockMailer) Send(msg mail.Message) error {
+	return nil
+}
+
+func newMockLoginGuard() *lockout.Guard {
+	return lockout.NewGuard(&mockLoginFailureStore{}, &mockAuditStore{}, lockout.Policy{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      10,
+		Window:             time.Minute,
+		LockoutDuration:    time.Minute,
+	})
+}
+
+type mockLoginFailureStore struct {
+	mu       sync.Mutex
+	failures map[string]*types.LoginFailure
+}
+
+func (m *mockLoginFailureStore) GetLoginFailure(subject string) (*types.LoginFailure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if failure, ok := m.failures[subject]; ok {
+		copied := *failure
+		return &copied, nil
+	}
+	return &types.LoginFailure{Subject: subject}, nil
+}
+
+func (m *mockLoginFailureStore) IncrementLoginFailures(subject string, window time.Duration) (*types.LoginFailure, error) {
+	m.mu.Lock()
+	if m.failures == nil {
+		m.failures = make(map[string]*types.LoginFailure)
+	}
+	failure, ok := m.failures[subject]
+	if !ok {
+		failure = &types.LoginFailure{Subject: subject}
+		m.failures[subject] = failure
+	}
+	failure.Failures++
+	failure.LastFailureAt = time.Now()
+	m.mu.Unlock()
+
+	return m.GetLoginFailure(subject)
+}
+
+func (m *mockLoginFailureStore) LockLogin(subject string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[subject].LockedUntil = &until
+	return nil
+}
+
+func (m *mockLoginFailureStore) ResetLoginFailures(subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, subject)
+	return nil
+}
+
+type mockOrderStore struct {
+	types.OrderStore
+}
+
+func (m *mockOrderStore) GetOrdersByUserID(userID int) ([]types.Order, error) {
+	return []types.Order{{ID: 1, UserID: userID}}, nil
+}
+
+type mockAuditStore struct {
+	types.AuditStore
+	events []types.AuditEvent
+}
+
+func (m *mockAuditStore) CreateAuditEvent(event types.AuditEvent) error {
+	m.events = append(m.events, event)
+	return nil
 }
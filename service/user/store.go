@@ -2,16 +2,23 @@ package user
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/sebastian-nunez/golang-store-api/db"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/lockout"
 	"github.com/sebastian-nunez/golang-store-api/types"
 )
 
 type Store struct {
-	db *sql.DB
+	db *db.DB
 }
 
-func NewStore(db *sql.DB) *Store {
+func NewStore(db *db.DB) *Store {
 	return &Store{db: db}
 }
 
@@ -57,44 +64,184 @@ func (s *Store) GetUserByID(id int) (*types.User, error) {
 	return user, nil
 }
 
-func (s *Store) CreateUser(user types.User) (int, error) {
-	res, err := s.db.Exec(
-		"INSERT INTO users (firstName, lastName, email, password) VALUES (?, ?, ?, ?)",
-		user.FirstName, user.LastName, user.Email, user.Password,
-	)
+// CreateUser records the new user as the actor of a registration, which has none yet.
+func (s *Store) CreateUser(user types.User, event types.AuditEvent) (int, error) {
+	var id int
+	err := s.db.Transact(func(tx *db.Tx) error {
+		inserted, err := tx.Insert(
+			"INSERT INTO users (firstName, lastName, email, password) VALUES (?, ?, ?, ?)",
+			user.FirstName, user.LastName, user.Email, user.Password,
+		)
+		if err != nil {
+			return err
+		}
+
+		id = int(inserted)
+		if event.ActorID == nil {
+			event.ActorID = &id
+		}
+		return recordEvent(tx, id, event)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return 0, nil
+	return id, nil
+}
+
+func (s *Store) SearchUsers(search types.UserSearch) ([]types.User, int, error) {
+	where := ""
+	args := make([]any, 0)
+	if search.Query != "" {
+		pattern := "%" + escapeLike(search.Query) + "%"
+		dialect := s.db.Dialect()
+		where = " WHERE " + dialect.Like("email", "?") + " OR " + dialect.Like(dialect.Concat("firstName", "' '", "lastName"), "?")
+		args = append(args, pattern, pattern)
 	}
 
-	return int(id), nil
-}
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
 
-func (s *Store) GetUsers() ([]types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users")
+	rows, err := s.db.Query(
+		"SELECT * FROM users"+where+" ORDER BY id LIMIT ? OFFSET ?",
+		append(args, search.Limit, search.Offset)...,
+	)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	defer rows.Close()
 
 	users := make([]types.User, 0)
 	for rows.Next() {
 		user, err := scanRowsIntoUser(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		users = append(users, *user)
 	}
 
-	return users, nil
+	return users, total, nil
+}
+
+func (s *Store) SetDisabled(id int, disabledAt *time.Time, event types.AuditEvent) error {
+	return s.update(id, event, "UPDATE users SET disabledAt = ? WHERE id = ?", disabledAt, id)
+}
+
+func (s *Store) UpdateRole(id int, role string, event types.AuditEvent) error {
+	return s.db.Transact(func(tx *db.Tx) error {
+		var previous string
+		if err := tx.QueryRow("SELECT role FROM users WHERE id = ? FOR UPDATE", id).Scan(&previous); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, id); err != nil {
+			return err
+		}
+
+		var err error
+		event.Before, event.After, err = audit.Changes(map[string]string{"role": previous}, map[string]string{"role": role})
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(tx, id, event)
+	})
+}
+
+func (s *Store) SetEmailVerified(id int, verifiedAt time.Time, event types.AuditEvent) error {
+	return s.update(id, event, "UPDATE users SET emailVerifiedAt = ? WHERE id = ?", verifiedAt, id)
+}
+
+func (s *Store) UpdatePassword(id int, hashedPassword string) error {
+	_, err := s.db.Exec("UPDATE users SET password = ? WHERE id = ?", hashedPassword, id)
+	return err
+}
+
+func (s *Store) ChangePassword(id int, hashedPassword string, revokedAt time.Time, event types.AuditEvent) error {
+	return s.update(id, event, "UPDATE users SET password = ?, sessionsRevokedAt = ? WHERE id = ?", hashedPassword, revokedAt, id)
+}
+
+// UpdateProfile doesn't record the names in the event, which outlives their anonymization.
+func (s *Store) UpdateProfile(id int, firstName string, lastName string, event types.AuditEvent) error {
+	return s.update(id, event, "UPDATE users SET firstName = ?, lastName = ? WHERE id = ?", firstName, lastName, id)
+}
+
+// UpdateEmail doesn't record the emails in the event, which outlives their anonymization.
+func (s *Store) UpdateEmail(id int, email string, event types.AuditEvent) error {
+	return s.update(id, event, "UPDATE users SET email = ?, emailVerifiedAt = NULL WHERE id = ?", email, id)
+}
+
+func (s *Store) AnonymizeUser(id int, deletedAt time.Time, event types.AuditEvent) error {
+	return s.db.Transact(func(tx *db.Tx) error {
+		var email string
+		err := tx.QueryRow("SELECT email FROM users WHERE id = ?", id).Scan(&email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM login_failures WHERE subject = ?", lockout.EmailSubject(email)); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM recovery_codes WHERE userId = ?", id); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM user_tokens WHERE userId = ?", id); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("UPDATE api_keys SET revokedAt = ? WHERE userId = ? AND revokedAt IS NULL", deletedAt, id); err != nil {
+			return err
+		}
+
+		// The email stays unique and can't receive mail, and the empty password never matches.
+		_, err = tx.Exec(
+			`UPDATE users SET firstName = 'Deleted', lastName = 'User', email = ?, password = '',
+			emailVerifiedAt = NULL, totpSecret = NULL, totpEnabledAt = NULL, totpLastUsedStep = NULL,
+			sessionsRevokedAt = ?, deletedAt = ? WHERE id = ?`,
+			fmt.Sprintf("deleted-%d@deleted.invalid", id),
+			deletedAt,
+			deletedAt,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(tx, id, event)
+	})
+}
+
+// update runs the statement and records the event in one transaction.
+func (s *Store) update(id int, event types.AuditEvent, query string, args ...any) error {
+	return s.db.Transact(func(tx *db.Tx) error {
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+
+		return recordEvent(tx, id, event)
+	})
+}
+
+// recordEvent completes the event with the user and records it in the transaction.
+func recordEvent(tx *db.Tx, id int, event types.AuditEvent) error {
+	event.EntityType = "user"
+	event.EntityID = strconv.Itoa(id)
+	return audit.Record(tx, event)
 }
 
 func scanRowsIntoUser(rows *sql.Rows) (*types.User, error) {
 	user := new(types.User)
+	var emailVerifiedAt, sessionsRevokedAt, totpEnabledAt, deletedAt, disabledAt sql.NullTime
+	var totpSecret sql.NullString
+	var totpLastUsedStep sql.NullInt64
 	err := rows.Scan(
 		&user.ID,
 		&user.FirstName,
@@ -102,10 +249,41 @@ func scanRowsIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.Email,
 		&user.Password,
 		&user.CreatedAt,
+		&user.Role,
+		&emailVerifiedAt,
+		&sessionsRevokedAt,
+		&totpSecret,
+		&totpEnabledAt,
+		&totpLastUsedStep,
+		&deletedAt,
+		&disabledAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if sessionsRevokedAt.Valid {
+		user.SessionsRevokedAt = &sessionsRevokedAt.Time
+	}
+	if totpEnabledAt.Valid {
+		user.TOTPEnabledAt = &totpEnabledAt.Time
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	user.TOTPSecret = totpSecret.String
+	user.TOTPLastUsedStep = totpLastUsedStep.Int64
+
 	return user, nil
 }
+
+// escapeLike escapes the wildcards of a LIKE pattern so they match literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,250 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+	"github.com/sebastian-nunez/golang-store-api/service/audit"
+	"github.com/sebastian-nunez/golang-store-api/service/auth"
+	"github.com/sebastian-nunez/golang-store-api/service/token"
+	"github.com/sebastian-nunez/golang-store-api/service/totp"
+	"github.com/sebastian-nunez/golang-store-api/types"
+	"github.com/sebastian-nunez/golang-store-api/utils"
+)
+
+const (
+	Action2FAEnabled  = "user.2fa_enabled"
+	Action2FADisabled = "user.2fa_disabled"
+)
+
+const recoveryCodesCount = 10
+
+var errInvalidTwoFactorCode = fmt.Errorf("invalid two-factor code")
+
+// handleLoginTwoFactor exchanges the challenge token from `/login` and a TOTP or recovery code for
+// a session token.
+func (h *Handler) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var payload types.LoginTwoFactorRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	userID, err := auth.ParseChallengeToken(payload.ChallengeToken)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("challenge token is invalid or expired"))
+		return
+	}
+
+	user, err := h.store.GetUserByID(userID)
+	if err != nil || !user.HasTwoFactor() {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("challenge token is invalid or expired"))
+		return
+	}
+
+	if user.DisabledAt != nil {
+		utils.WriteError(w, r, http.StatusForbidden, errAccountDisabled)
+		return
+	}
+
+	// Guessing codes counts towards the same lockout as guessing passwords.
+	ip := utils.ClientIP(r)
+	locked, err := h.loginGuard.Check(r.Context(), user.Email, ip)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if locked {
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidTwoFactorCode)
+		return
+	}
+
+	ok, err := h.verifySecondFactor(*user, payload.Code)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !ok {
+		if err := h.loginGuard.Fail(user.Email, ip); err != nil {
+			log.Printf("unable to record failed login: %v", err)
+		}
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidTwoFactorCode)
+		return
+	}
+
+	if err := h.loginGuard.Succeed(user.Email); err != nil {
+		log.Printf("unable to reset failed logins: %v", err)
+	}
+
+	jwtToken, err := h.createJwtToken([]byte(config.Envs.JWTSecret), user.ID)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.auditLogin(r, user.ID)
+	writeSession(w, r, payload.Session, jwtToken)
+}
+
+// handleEnrollTwoFactor starts the enrollment with a new secret, which only takes effect once a
+// code is confirmed.
+func (h *Handler) handleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if user.HasTwoFactor() {
+		utils.WriteError(w, r, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.twoFactorStore.SetTOTPSecret(user.ID, secret); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]string{
+		"secret":     secret,
+		"otpauthUri": totp.URI(config.Envs.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// handleConfirmTwoFactor enables 2FA once the user proves their app generates valid codes, and
+// returns the recovery codes. They are only shown this once.
+func (h *Handler) handleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var payload types.TwoFactorCodeRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if user.HasTwoFactor() {
+		utils.WriteError(w, r, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("two-factor enrollment has not been started"))
+		return
+	}
+
+	ok, err := h.verifyTOTP(*user, payload.Code)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !ok {
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidTwoFactorCode)
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = token.Hash(code)
+	}
+
+	if err := h.twoFactorStore.EnableTOTP(user.ID, time.Now(), hashes, audit.FromRequest(r, Action2FAEnabled)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string][]string{"recoveryCodes": codes})
+}
+
+func (h *Handler) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var payload types.TwoFactorCodeRequest
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !user.HasTwoFactor() {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("two-factor authentication is not enabled"))
+		return
+	}
+
+	ok, err := h.verifySecondFactor(*user, payload.Code)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !ok {
+		utils.WriteError(w, r, http.StatusBadRequest, errInvalidTwoFactorCode)
+		return
+	}
+
+	if err := h.twoFactorStore.DisableTOTP(user.ID, audit.FromRequest(r, Action2FADisabled)); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (h *Handler) verifySecondFactor(user types.User, code string) (bool, error) {
+	ok, err := h.verifyTOTP(user, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	return h.twoFactorStore.ConsumeRecoveryCode(user.ID, token.Hash(totp.NormalizeRecoveryCode(code)))
+}
+
+// verifyTOTP checks the code and makes sure it can't be replayed.
+func (h *Handler) verifyTOTP(user types.User, code string) (bool, error) {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return h.twoFactorStore.UseTOTPStep(user.ID, step)
+}
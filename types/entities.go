@@ -1,6 +1,15 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+)
 
 type User struct {
 	ID        int       `json:"id"`
@@ -9,6 +18,33 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  string    `json:"-"`
 	CreatedAt time.Time `json:"createdAt"`
+	Role      string    `json:"role"`
+	// EmailVerifiedAt is nil until the user follows the link sent to their email.
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	// SessionsRevokedAt invalidates every token issued before it, e.g. after a password reset.
+	SessionsRevokedAt *time.Time `json:"-"`
+	// TOTPSecret is set as soon as the user starts enrolling, but 2FA is only required once
+	// TOTPEnabledAt is set.
+	TOTPSecret       string     `json:"-"`
+	TOTPEnabledAt    *time.Time `json:"twoFactorEnabledAt"`
+	TOTPLastUsedStep int64      `json:"-"`
+	// DeletedAt is set once the personal data of the user has been anonymized.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// DisabledAt is set while an admin has disabled the account.
+	DisabledAt *time.Time `json:"disabledAt"`
+}
+
+// HasTwoFactor returns whether the user must enter a TOTP code to log in.
+func (u User) HasTwoFactor() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// UserPage is a page of users matching a search.
+type UserPage struct {
+	Users    []User `json:"users"`
+	Total    int    `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
 }
 
 type Product struct {
@@ -19,6 +55,15 @@ type Product struct {
 	Price       float64   `json:"price"`
 	Quantity    int       `json:"quantity"`
 	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// Version is incremented by every change, see `ProductStore.UpdateProduct`.
+	Version int `json:"version"`
+}
+
+// StockChange adds Delta units to the stock of a product, e.g. -2 for two units sold.
+type StockChange struct {
+	ProductID int
+	Delta     int
 }
 
 type Order struct {
@@ -39,7 +84,105 @@ type OrderItem struct {
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+// UserDataExport is everything stored about a user, returned for data subject access requests.
+type UserDataExport struct {
+	ExportedAt time.Time `json:"exportedAt"`
+	Profile    User      `json:"profile"`
+	// Addresses are the distinct shipping addresses of the orders.
+	Addresses []string         `json:"addresses"`
+	Orders    []OrderWithItems `json:"orders"`
+}
+
+type OrderWithItems struct {
+	Order
+	Items []OrderItem `json:"items"`
+}
+
 type CartCheckoutItem struct {
 	ProductID int `json:"productId"`
 	Quantity  int `json:"quantity"`
 }
+
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+// UserToken is a single-use token sent to the user, e.g. to verify their email. Only the hash is stored.
+type UserToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Scopes of API keys. Each route guarded by `auth` lists the scopes it needs from an API key.
+const (
+	ScopeProductsWrite = "products:write"
+	ScopeOrdersRead    = "orders:read"
+	ScopeUsersRead     = "users:read"
+	ScopeAuditRead     = "audit:read"
+	ScopeMetricsRead   = "metrics:read"
+)
+
+// APIKey lets an integration call the API on behalf of the user who created it, limited to its
+// scopes. Only the hash of the key is stored, the prefix identifies it in listings.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// HasScopes reports whether the key was granted every one of the scopes.
+func (k APIKey) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(k.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoginFailure counts the failed logins of a subject, e.g. an email or an IP address.
+type LoginFailure struct {
+	Subject       string     `json:"subject"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+}
+
+// AuditEvent records who did what to which entity. ActorID is nil for anonymous requests, and
+// is the admin rather than the user while impersonating.
+type AuditEvent struct {
+	ID         int    `json:"id"`
+	ActorID    *int   `json:"actorId"`
+	Action     string `json:"action"`
+	EntityType string `json:"entityType"`
+	EntityID   string `json:"entityId"`
+	IP         string `json:"ip"`
+	// Details is free-form context, e.g. the request made while impersonating a user.
+	Details string `json:"details"`
+	// Before and After hold the fields of the entity changed by the action, as JSON objects.
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"requestId"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// AuditEventPage is a page of audit events matching a filter, newest first.
+type AuditEventPage struct {
+	Events   []AuditEvent `json:"events"`
+	Total    int          `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"pageSize"`
+}
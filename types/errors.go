@@ -0,0 +1,35 @@
+package types
+
+import "fmt"
+
+// NotFoundError is returned when an entity doesn't exist, e.g. by `GetProductByID`.
+type NotFoundError struct {
+	EntityType string
+	ID         int
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s with id %d not found", e.EntityType, e.ID)
+}
+
+// ConflictError is returned when an entity changed since it was read, e.g. by `UpdateProduct`
+// given an outdated version.
+type ConflictError struct {
+	EntityType string
+	ID         int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %d was modified since it was read", e.EntityType, e.ID)
+}
+
+// InsufficientStockError is returned by `AdjustStock` when a product has fewer units than the
+// change takes out.
+type InsufficientStockError struct {
+	ProductID int
+	Requested int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("product %d does not have %d units in stock", e.ProductID, e.Requested)
+}
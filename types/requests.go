@@ -1,15 +1,77 @@
 package types
 
+import "time"
+
 type RegisterUserRequest struct {
 	FirstName string `json:"firstName" validate:"required"`
 	LastName  string `json:"lastName" validate:"required"`
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required,min=4,max=128"`
+	Password  string `json:"password" validate:"required,max=128"`
 }
 
 type LoginUserRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	// Session is `cookie` for browser clients which keep the JWT in an HttpOnly cookie.
+	Session string `json:"session" validate:"omitempty,oneof=token cookie"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,max=128"`
+}
+
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	// Code is either a TOTP code or a recovery code.
+	Code    string `json:"code" validate:"required"`
+	Session string `json:"session" validate:"omitempty,oneof=token cookie"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// UpdateProfileRequest only changes the fields which are set.
+type UpdateProfileRequest struct {
+	FirstName *string `json:"firstName" validate:"omitnil,min=1,max=255"`
+	LastName  *string `json:"lastName" validate:"omitnil,min=1,max=255"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,max=128"`
+}
+
+type ChangeEmailRequest struct {
+	Email           string `json:"email" validate:"required,email,max=255"`
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+}
+
+type DeleteAccountRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=customer admin"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=products:write orders:read users:read audit:read metrics:read"`
+	ExpiresAt *time.Time `json:"expiresAt"`
 }
 
 type CreateProductRequest struct {
@@ -20,6 +82,21 @@ type CreateProductRequest struct {
 	Quantity    int     `json:"quantity" validate:"required"`
 }
 
+// UpdateProductRequest replaces every field of a product but its stock, at the version of the
+// product the client read.
+type UpdateProductRequest struct {
+	Name        string  `json:"name" validate:"required"`
+	Description string  `json:"description"`
+	Image       string  `json:"image"`
+	Price       float64 `json:"price" validate:"required"`
+	Version     int     `json:"version" validate:"required,min=1"`
+}
+
+// AdjustStockRequest adds units to the stock of a product, or takes them out given a negative delta.
+type AdjustStockRequest struct {
+	Delta int `json:"delta" validate:"required"`
+}
+
 type CartCheckoutRequest struct {
-	Items []CartCheckoutItem `json:"items" validate:"required"`
+	Items []CartCheckoutItem `json:"items" validate:"required,min=1,dive"`
 }
@@ -1,21 +1,117 @@
 package types
 
+import "time"
+
+// UserStore records the event of every change but `UpdatePassword`, completed with the user, in
+// the same transaction as the change.
 type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
-	CreateUser(user User) (int, error)
-	GetUsers() ([]User, error)
+	CreateUser(user User, event AuditEvent) (int, error)
+	// SearchUsers returns a page of the users matching the search, and the number of matching users.
+	SearchUsers(search UserSearch) ([]User, int, error)
+	SetEmailVerified(id int, verifiedAt time.Time, event AuditEvent) error
+	// UpdatePassword replaces the hash of the same password, e.g. after a rehash on login, so it
+	// isn't audited and keeps the sessions.
+	UpdatePassword(id int, hashedPassword string) error
+	// ChangePassword replaces the password and revokes the sessions issued before revokedAt.
+	ChangePassword(id int, hashedPassword string, revokedAt time.Time, event AuditEvent) error
+	UpdateProfile(id int, firstName string, lastName string, event AuditEvent) error
+	// UpdateEmail changes the email of the user and marks it as unverified.
+	UpdateEmail(id int, email string, event AuditEvent) error
+	// AnonymizeUser replaces the personal data of the user, signs them out, revokes their API keys
+	// and deletes their tokens and recovery codes. Orders are kept.
+	AnonymizeUser(id int, deletedAt time.Time, event AuditEvent) error
+	// SetDisabled disables the user, or enables them again when disabledAt is nil.
+	SetDisabled(id int, disabledAt *time.Time, event AuditEvent) error
+	UpdateRole(id int, role string, event AuditEvent) error
+}
+
+// UserSearch matches users by email or name. An empty query matches every user.
+type UserSearch struct {
+	Query  string
+	Limit  int
+	Offset int
 }
 
 type ProductStore interface {
 	GetProducts() ([]Product, error)
+	// GetProductByID returns a `*NotFoundError` if the product doesn't exist.
 	GetProductByID(id int) (*Product, error)
 	GetProductsByID(productIDs []int) ([]Product, error)
-	CreateProduct(product CreateProductRequest) (int, error)
-	UpdateProduct(product Product) error
+	// CreateProduct, UpdateProduct and AdjustStock record the event, completed with the entity
+	// and its changes, in the same transaction as the product.
+	CreateProduct(product CreateProductRequest, event AuditEvent) (int, error)
+	// UpdateProduct replaces every field but the stock, which only `AdjustStock` changes. It only
+	// applies if the product is still at `product.Version`, and returns a `*ConflictError` otherwise.
+	UpdateProduct(product Product, event AuditEvent) error
+	// AdjustStock applies every change or none, without a read-modify-write of the stock. It
+	// returns an `*InsufficientStockError` if a change would take the stock below zero.
+	AdjustStock(changes []StockChange, event AuditEvent) error
 }
 
 type OrderStore interface {
-	CreateOrder(Order) (int, error)
-	CreateOrderItem(OrderItem) error
+	// CreateOrder takes the items out of stock and creates the order with its items, all or
+	// nothing. It records the event, completed with the order, and a copy of it for every stock
+	// change in the same transaction. It returns an `*InsufficientStockError` if a product has
+	// fewer units than its item takes.
+	CreateOrder(order Order, items []OrderItem, event AuditEvent) (int, error)
+	GetOrdersByUserID(userID int) ([]Order, error)
+	GetOrderItemsByUserID(userID int) ([]OrderItem, error)
+}
+
+type LoginFailureStore interface {
+	GetLoginFailure(subject string) (*LoginFailure, error)
+	// IncrementLoginFailures restarts the count when the last failure is older than the window.
+	IncrementLoginFailures(subject string, window time.Duration) (*LoginFailure, error)
+	LockLogin(subject string, until time.Time) error
+	ResetLoginFailures(subject string) error
+}
+
+type AuditStore interface {
+	CreateAuditEvent(event AuditEvent) error
+	// GetAuditEvents returns a page of the events matching the filter, and the number of matching events.
+	GetAuditEvents(filter AuditFilter) ([]AuditEvent, int, error)
+}
+
+// AuditFilter matches audit events. Zero fields match every event.
+type AuditFilter struct {
+	ActorID    *int
+	EntityType string
+	EntityID   string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+type UserTokenStore interface {
+	CreateUserToken(token UserToken) error
+	// GetUserToken returns an unused and unexpired token without using it.
+	GetUserToken(purpose string, tokenHash string) (*UserToken, error)
+	// ConsumeUserToken marks an unused and unexpired token as used and returns it.
+	ConsumeUserToken(purpose string, tokenHash string) (*UserToken, error)
+	DeleteUserTokens(userID int, purpose string) error
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) (int, error)
+	GetAPIKeyByHash(keyHash string) (*APIKey, error)
+	GetAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id int, revokedAt time.Time) error
+	TouchAPIKey(id int, usedAt time.Time) error
+}
+
+type TwoFactorStore interface {
+	// SetTOTPSecret starts a new enrollment, 2FA stays disabled until it is enabled.
+	SetTOTPSecret(userID int, secret string) error
+	// EnableTOTP replaces the recovery codes of the user and enables 2FA. It records the event,
+	// completed with the user, in the same transaction, as does `DisableTOTP`.
+	EnableTOTP(userID int, enabledAt time.Time, codeHashes []string, event AuditEvent) error
+	// DisableTOTP removes the secret and the recovery codes of the user.
+	DisableTOTP(userID int, event AuditEvent) error
+	// UseTOTPStep records the time step of a valid code and returns false if it, or a later one, was already used.
+	UseTOTPStep(userID int, step int64) (bool, error)
+	// ConsumeRecoveryCode marks an unused recovery code as used and returns whether it was found.
+	ConsumeRecoveryCode(userID int, codeHash string) (bool, error)
 }
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WriteConditionalJson writes the payload as a `200` JSON response with a strong ETag and, when
+// not zero, the time it was last modified. A GET or HEAD request whose `If-None-Match`, or else
+// `If-Modified-Since`, shows the client already has this version gets `304 Not Modified` instead.
+func WriteConditionalJson(w http.ResponseWriter, r *http.Request, payload any, lastModified time.Time) error {
+	body, err := encodeJson(payload)
+	if err != nil {
+		return err
+	}
+
+	etag := ETag(body)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	return err
+}
+
+// ETag returns a strong ETag of the response body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ETagOf returns the ETag `WriteConditionalJson` sends for the payload, e.g. to check `If-Match`
+// against the current version of an entity.
+func ETagOf(payload any) (string, error) {
+	body, err := encodeJson(payload)
+	if err != nil {
+		return "", err
+	}
+	return ETag(body), nil
+}
+
+// IfMatch reports whether the request may change the entity with the given ETag: either it has
+// no `If-Match` header, or one of the listed ETags, or `*`, matches.
+func IfMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range splitETags(header) {
+		// Weak ETags never match, `If-Match` uses the strong comparison.
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range splitETags(header) {
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have a resolution of a second.
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+func splitETags(header string) []string {
+	var etags []string
+	for _, etag := range strings.Split(header, ",") {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+	return etags
+}
+
+// encodeJson encodes the payload exactly as `WriteJson` does.
+func encodeJson(payload any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sebastian-nunez/golang-store-api/config"
+)
+
+var trustedProxies = parseCIDRs(config.Envs.TrustedProxies)
+
+// ClientIP returns the IP address of the client, honoring `X-Forwarded-For` only when the
+// request comes through a trusted proxy.
+func ClientIP(r *http.Request) string {
+	return clientIP(r, trustedProxies)
+}
+
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	if !isTrusted(remoteIP, proxies) {
+		return remoteIP
+	}
+
+	// Walk the chain from the closest hop and stop at the first address we don't trust, so a
+	// client can't spoof its IP by sending its own `X-Forwarded-For` header.
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !isTrusted(hop, proxies) {
+			return hop
+		}
+		remoteIP = hop
+	}
+
+	return remoteIP
+}
+
+func isTrusted(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("ignoring invalid trusted proxy %q: %v", cidr, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ParsePagination reads the `page` and `pageSize` query params, starting at page 1.
+func ParsePagination(r *http.Request) (int, int, error) {
+	page, pageSize := 1, DefaultPageSize
+
+	query := r.URL.Query()
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive number")
+		}
+		page = n
+	}
+
+	if v := query.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return 0, 0, fmt.Errorf("pageSize must be between 1 and %d", MaxPageSize)
+		}
+		pageSize = n
+	}
+
+	return page, pageSize, nil
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+
+	// ProblemTypeDefault is used when the status code alone describes the problem.
+	ProblemTypeDefault = "about:blank"
+	// ProblemTypeValidation is used when the request payload fails validation.
+	ProblemTypeValidation = "/problems/validation-error"
+)
+
+// Problem is a RFC 7807 problem details response.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a single field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// uni holds the translators for validation messages. English is the fallback.
+var uni = newUniversalTranslator()
+
+func newUniversalTranslator() *ut.UniversalTranslator {
+	fallback := en.New()
+	uni := ut.New(fallback, fallback)
+
+	trans, _ := uni.GetTranslator(fallback.Locale())
+	if err := enTranslations.RegisterDefaultTranslations(Validate, trans); err != nil {
+		panic(err)
+	}
+
+	return uni
+}
+
+// newValidator returns a validator which reports fields by their JSON name.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// WriteProblem writes the problem as a `application/problem+json` response.
+func WriteProblem(w http.ResponseWriter, problem Problem) error {
+	if problem.Type == "" {
+		problem.Type = ProblemTypeDefault
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	return json.NewEncoder(w).Encode(problem)
+}
+
+// WriteValidationError writes the validation errors as a problem response with one entry per field.
+func WriteValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	trans := translatorFor(r)
+	fields := make([]FieldError, len(validationErrors))
+	for i, fe := range validationErrors {
+		fields[i] = FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Message: fe.Translate(trans),
+		}
+	}
+
+	WriteFieldErrors(w, r, fields)
+}
+
+// WriteFieldErrors writes a validation problem response for checks done outside of the validator.
+func WriteFieldErrors(w http.ResponseWriter, r *http.Request, fields []FieldError) {
+	WriteProblem(w, Problem{
+		Type:     ProblemTypeValidation,
+		Title:    "Your request parameters didn't validate.",
+		Status:   http.StatusBadRequest,
+		Detail:   "one or more fields are invalid",
+		Instance: r.URL.Path,
+		Errors:   fields,
+	})
+}
+
+// fieldPath returns the JSON path of the field without the top-level struct name, e.g. `items[0].quantity`.
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+// translatorFor picks a translator based on the `Accept-Language` header of the request.
+func translatorFor(r *http.Request) ut.Translator {
+	var locales []string
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		locale, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if locale != "" {
+			locales = append(locales, strings.ReplaceAll(locale, "-", "_"))
+		}
+	}
+
+	trans, _ := uni.FindTranslator(locales...)
+	return trans
+}
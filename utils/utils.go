@@ -2,23 +2,44 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/sebastian-nunez/golang-store-api/config"
 )
 
 type HttpStatus int
 
 // Validate acts a single, cached validator across the app.
-var Validate = validator.New()
+var Validate = newValidator()
 
-// ParseJson decodes the request body into the payload.
+// ParseJson decodes the request body into the payload. Unknown fields and anything following the
+// JSON value are rejected, so typos in field names don't go unnoticed.
 func ParseJson(r *http.Request, payload any) error {
 	if r.Body == nil {
 		return fmt.Errorf("missing request body")
 	}
-	return json.NewDecoder(r.Body).Decode(payload)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("missing request body")
+		}
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if err := dec.Decode(&json.RawMessage{}); errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	} else if !errors.Is(err, io.EOF) {
+		return fmt.Errorf("request body must only contain a single JSON value")
+	}
+
+	return nil
 }
 
 // WriteJson writes the payload as a JSON response.
@@ -28,20 +49,43 @@ func WriteJson(w http.ResponseWriter, status HttpStatus, payload any) error {
 	return json.NewEncoder(w).Encode(payload)
 }
 
-// WriteError writes a HTTP error as a JSON response.
-func WriteError(w http.ResponseWriter, status HttpStatus, err error) {
-	WriteJson(w, status, map[string]string{"error": err.Error()})
+// WriteError writes a HTTP error as a problem response. A body over the limit set with
+// `http.MaxBytesReader` is reported as `413`, whatever the status given by the handler.
+func WriteError(w http.ResponseWriter, r *http.Request, status HttpStatus, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		status = http.StatusRequestEntityTooLarge
+		err = fmt.Errorf("request body must not be larger than %d bytes", maxBytesErr.Limit)
+	}
+
+	WriteProblem(w, Problem{
+		Status:   int(status),
+		Detail:   err.Error(),
+		Instance: r.URL.Path,
+	})
 }
 
+// GetTokenFromRequest returns the JWT of the `Authorization: Bearer <token>` header. A bare token
+// in the header is still accepted for older clients, while other schemes, e.g. `ApiKey`, are not.
+// The `token` query param is only read when `ALLOW_TOKEN_IN_QUERY` is set.
 func GetTokenFromRequest(r *http.Request) string {
-	tokenAuth := r.Header.Get("Authorization")
-	tokenQuery := r.URL.Query().Get("token")
+	return getTokenFromRequest(r, config.Envs.AllowTokenInQuery)
+}
 
-	if tokenAuth != "" {
-		return tokenAuth
+func getTokenFromRequest(r *http.Request, allowQuery bool) string {
+	if header := strings.TrimSpace(r.Header.Get("Authorization")); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found {
+			return header
+		}
+		if strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
 	}
-	if tokenQuery != "" {
-		return tokenQuery
+
+	if allowQuery {
+		return r.URL.Query().Get("token")
 	}
 	return ""
 }
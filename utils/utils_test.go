@@ -3,6 +3,8 @@ package utils
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -47,6 +49,38 @@ func TestParseJson(t *testing.T) {
 			t.Errorf("expected %+v and got %+v", expected, payload)
 		}
 	})
+
+	t.Run("should return error given unknown fields", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/some-endpoint", bytes.NewBufferString(`{"email":"snunez@google.com","isAdmin":true}`))
+
+		var payload types.LoginUserRequest
+		if err := ParseJson(req, &payload); err == nil {
+			t.Errorf("expected error given an unknown field")
+		}
+	})
+
+	t.Run("should return error given trailing data", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/some-endpoint", bytes.NewBufferString(`{"email":"snunez@google.com"} {}`))
+
+		var payload types.LoginUserRequest
+		if err := ParseJson(req, &payload); err == nil {
+			t.Errorf("expected error given trailing data")
+		}
+	})
+
+	t.Run("should return a 413 error given a body over the limit", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/some-endpoint", nil)
+		req.Body = http.MaxBytesReader(rr, io.NopCloser(bytes.NewBufferString(`{"email":"snunez@google.com"}`)), 8)
+
+		var payload types.LoginUserRequest
+		err := ParseJson(req, &payload)
+		WriteError(rr, req, http.StatusBadRequest, err)
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status code %d and got %d", http.StatusRequestEntityTooLarge, rr.Code)
+		}
+	})
 }
 
 func TestWriteJson(t *testing.T) {
@@ -93,3 +127,227 @@ func TestWriteJson(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteError(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/some-endpoint", nil)
+	rr := httptest.NewRecorder()
+
+	WriteError(rr, req, http.StatusNotFound, fmt.Errorf("product not found"))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %v, but got %v", http.StatusNotFound, rr.Code)
+	}
+
+	if rr.Header().Get("Content-Type") != ProblemContentType {
+		t.Errorf("expected Content-Type %s, but got %v", ProblemContentType, rr.Header().Get("Content-Type"))
+	}
+
+	var problem Problem
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Problem{
+		Type:     ProblemTypeDefault,
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "product not found",
+		Instance: "/some-endpoint",
+	}
+	if !reflect.DeepEqual(expected, problem) {
+		t.Errorf("expected %+v and got %+v", expected, problem)
+	}
+}
+
+func TestWriteValidationError(t *testing.T) {
+	t.Run("should return one error per invalid field using the JSON field name", func(t *testing.T) {
+		payload := types.RegisterUserRequest{
+			FirstName: "Sebastian",
+			Email:     "invalid",
+			Password:  "1234",
+		}
+		req, _ := http.NewRequest(http.MethodPost, "/register", nil)
+		rr := httptest.NewRecorder()
+
+		WriteValidationError(rr, req, Validate.Struct(payload))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %v, but got %v", http.StatusBadRequest, rr.Code)
+		}
+
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+
+		if problem.Type != ProblemTypeValidation {
+			t.Errorf("expected type %s, but got %s", ProblemTypeValidation, problem.Type)
+		}
+
+		expected := []FieldError{
+			{Field: "lastName", Rule: "required", Message: "lastName is a required field"},
+			{Field: "email", Rule: "email", Message: "email must be a valid email address"},
+		}
+		if !reflect.DeepEqual(expected, problem.Errors) {
+			t.Errorf("expected %+v and got %+v", expected, problem.Errors)
+		}
+	})
+
+	t.Run("should report the path of nested fields", func(t *testing.T) {
+		type item struct {
+			Quantity int `json:"quantity" validate:"gt=0"`
+		}
+		type request struct {
+			Items []item `json:"items" validate:"dive"`
+		}
+		req, _ := http.NewRequest(http.MethodPost, "/cart/checkout", nil)
+		rr := httptest.NewRecorder()
+
+		WriteValidationError(rr, req, Validate.Struct(request{Items: []item{{Quantity: 1}, {Quantity: 0}}}))
+
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "items[1].quantity" {
+			t.Errorf("expected a single error for items[1].quantity and got %+v", problem.Errors)
+		}
+	})
+
+	t.Run("should fall back to a plain problem given a non validation error", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/register", nil)
+		rr := httptest.NewRecorder()
+
+		WriteValidationError(rr, req, fmt.Errorf("some error"))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %v, but got %v", http.StatusBadRequest, rr.Code)
+		}
+
+		if rr.Header().Get("Content-Type") != ProblemContentType {
+			t.Errorf("expected Content-Type %s, but got %v", ProblemContentType, rr.Header().Get("Content-Type"))
+		}
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := parseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"})
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor string
+		want          string
+	}{
+		{
+			name:       "direct connection",
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:          "ignores forwarded header from an untrusted peer",
+			remoteAddr:    "203.0.113.7:1234",
+			xForwardedFor: "198.51.100.1",
+			want:          "203.0.113.7",
+		},
+		{
+			name:          "uses forwarded header from a trusted proxy",
+			remoteAddr:    "10.1.2.3:1234",
+			xForwardedFor: "198.51.100.1",
+			want:          "198.51.100.1",
+		},
+		{
+			name:          "skips chained trusted proxies and ignores spoofed entries",
+			remoteAddr:    "10.1.2.3:1234",
+			xForwardedFor: "1.1.1.1, 198.51.100.1, 192.168.1.1",
+			want:          "198.51.100.1",
+		},
+		{
+			name:          "stops at malformed entries",
+			remoteAddr:    "10.1.2.3:1234",
+			xForwardedFor: "not-an-ip",
+			want:          "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/some-endpoint", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xForwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.xForwardedFor)
+			}
+
+			if got := clientIP(req, proxies); got != tt.want {
+				t.Errorf("expected %s, but got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantKept bool
+	}{
+		{name: "generates an ID", incoming: ""},
+		{name: "keeps a well-formed ID", incoming: "abc-123", wantKept: true},
+		{name: "replaces a malformed ID", incoming: "abc 123\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetRequestID(r.Context())
+			}))
+
+			req, _ := http.NewRequest(http.MethodGet, "/some-endpoint", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if got == "" || got != rr.Header().Get(RequestIDHeader) {
+				t.Errorf("expected the request ID %q in the context and the response", got)
+			}
+			if (got == tt.incoming) != tt.wantKept {
+				t.Errorf("expected the incoming ID to be kept: %v, but got %q", tt.wantKept, got)
+			}
+		})
+	}
+}
+
+func TestGetTokenFromRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		query         string
+		allowQuery    bool
+		want          string
+	}{
+		{name: "bearer scheme", authorization: "Bearer abc.def.ghi", want: "abc.def.ghi"},
+		{name: "case-insensitive scheme", authorization: "bearer abc.def.ghi", want: "abc.def.ghi"},
+		{name: "bare token", authorization: "abc.def.ghi", want: "abc.def.ghi"},
+		{name: "other scheme", authorization: "ApiKey sk_abc", want: ""},
+		{name: "ignores the query param by default", query: "abc.def.ghi", want: ""},
+		{name: "reads the query param when allowed", query: "abc.def.ghi", allowQuery: true, want: "abc.def.ghi"},
+		{name: "prefers the header to the query param", authorization: "Bearer header", query: "query", allowQuery: true, want: "header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/some-endpoint?token="+tt.query, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			if got := getTokenFromRequest(req, tt.allowQuery); got != tt.want {
+				t.Errorf("expected %q, but got %q", tt.want, got)
+			}
+		})
+	}
+}